@@ -0,0 +1,15 @@
+#!/bin/sh
+# Runs all benchmarks with both execution engines.
+set -e
+
+cd "$(dirname "$0")"
+go build -o ./crab ..
+
+for benchmark in *.cb; do
+	for engine in tree vm; do
+		printf "%-16s %-5s " "$benchmark" "$engine"
+		./crab -engine="$engine" "$benchmark"
+	done
+done
+
+rm ./crab
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Bananenpro/crab/interpreter"
+)
+
+// runCover executes the 'cover' subcommand and returns the exit code.
+func runCover(args []string) int {
+	flags := flag.NewFlagSet("cover", flag.ExitOnError)
+	text := flags.Bool("text", false, "Print the source code annotated with the number of executions of each line.")
+	htmlPath := flags.String("html", "", "Write the annotated source code as HTML to this file.")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s cover [options] coverage-file\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nPrints the statement and branch coverage of every file recorded with -coverage.\n")
+		fmt.Fprintf(os.Stderr, "\nOptions:\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 1
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open coverage file: %s\n", err)
+		return 1
+	}
+	coverage, err := interpreter.ReadCoverage(file)
+	file.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid coverage file: %s\n", err)
+		return 1
+	}
+	files := coverage.Files()
+
+	if *htmlPath != "" {
+		err = writeCoverageHTML(files, *htmlPath)
+	} else if *text {
+		err = writeCoverageText(files, os.Stdout)
+	} else {
+		err = writeCoverageSummary(files, os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// writeCoverage writes coverage to the file at path.
+func writeCoverage(coverage *interpreter.Coverage, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("Failed to write coverage: %s", err)
+	}
+	err = coverage.Write(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to write coverage: %s", err)
+	}
+	return nil
+}
+
+// coverageSummary counts the executed statements and branch directions of one or more files.
+// Every branch has two directions: the condition being true and being false.
+type coverageSummary struct {
+	statements, coveredStatements int
+	branches, coveredBranches     int
+}
+
+func summarizeCoverage(files ...interpreter.FileCoverage) coverageSummary {
+	var s coverageSummary
+	for _, f := range files {
+		for _, statement := range f.Statements {
+			s.statements++
+			if statement.Count > 0 {
+				s.coveredStatements++
+			}
+		}
+		for _, branch := range f.Branches {
+			s.branches += 2
+			if branch.Taken > 0 {
+				s.coveredBranches++
+			}
+			if branch.NotTaken > 0 {
+				s.coveredBranches++
+			}
+		}
+	}
+	return s
+}
+
+func (s coverageSummary) String() string {
+	return fmt.Sprintf("statements %s, branches %s", formatCoverage(s.coveredStatements, s.statements), formatCoverage(s.coveredBranches, s.branches))
+}
+
+func formatCoverage(covered, total int) string {
+	percent := 100.0
+	if total > 0 {
+		percent = float64(covered) / float64(total) * 100
+	}
+	return fmt.Sprintf("%.1f%% (%d/%d)", percent, covered, total)
+}
+
+func writeCoverageSummary(files []interpreter.FileCoverage, w io.Writer) error {
+	width := len("total")
+	for _, f := range files {
+		if len(f.Path) > width {
+			width = len(f.Path)
+		}
+	}
+	var b strings.Builder
+	for _, f := range files {
+		fmt.Fprintf(&b, "%-*s  %s\n", width, f.Path, summarizeCoverage(f))
+	}
+	fmt.Fprintf(&b, "%-*s  %s\n", width, "total", summarizeCoverage(files...))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// coverageLine is the coverage of a single line of a file.
+type coverageLine struct {
+	text string
+	// whether the line contains a statement
+	code bool
+	// the number of executions of the first statement on the line
+	count int
+	// set if a statement on the line was not executed
+	missed bool
+	// set if the condition of a branch on the line was always true or always false
+	partial  bool
+	branches []string
+}
+
+// annotateCoverage reads the source code of file and attaches the coverage to its lines.
+func annotateCoverage(file interpreter.FileCoverage) ([]coverageLine, error) {
+	source, err := os.Open(file.Path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open source file: %s", err)
+	}
+	tokens, err := interpreter.Scan(source, file.Path)
+	source.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var sourceLines [][]rune
+	if len(tokens) > 0 && tokens[len(tokens)-1].File != nil {
+		sourceLines = tokens[len(tokens)-1].File.Lines
+	}
+	lines := make([]coverageLine, len(sourceLines))
+	for index, line := range sourceLines {
+		lines[index].text = string(line)
+	}
+	for _, s := range file.Statements {
+		if s.Line < 1 || s.Line > len(lines) {
+			continue
+		}
+		line := &lines[s.Line-1]
+		if !line.code {
+			line.count = s.Count
+		}
+		line.code = true
+		line.missed = line.missed || s.Count == 0
+	}
+	for _, b := range file.Branches {
+		if b.Line < 1 || b.Line > len(lines) {
+			continue
+		}
+		line := &lines[b.Line-1]
+		line.partial = line.partial || b.Taken == 0 || b.NotTaken == 0
+		line.branches = append(line.branches, fmt.Sprintf("%s: %d true, %d false", b.Kind, b.Taken, b.NotTaken))
+	}
+	return lines, nil
+}
+
+// writeCoverageText writes the source code of files to w. Every line is prefixed with its number of executions and
+// a marker: '!' if it contains a statement which was never executed, '~' if it contains a branch which was only partially taken.
+func writeCoverageText(files []interpreter.FileCoverage, w io.Writer) error {
+	var b strings.Builder
+	for index, f := range files {
+		if index > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%s: %s\n", f.Path, summarizeCoverage(f))
+		lines, err := annotateCoverage(f)
+		if err != nil {
+			fmt.Fprintf(&b, "%s\n", err)
+			continue
+		}
+		for number, line := range lines {
+			marker := " "
+			if line.missed {
+				marker = "!"
+			} else if line.partial {
+				marker = "~"
+			}
+			count := ""
+			if line.code {
+				count = fmt.Sprint(line.count)
+			}
+			text := strings.ReplaceAll(line.text, "\t", "    ")
+			if len(line.branches) > 0 {
+				text = fmt.Sprintf("%s  [%s]", text, strings.Join(line.branches, "; "))
+			}
+			fmt.Fprintf(&b, "%5d %s%8s | %s\n", number+1, marker, count, text)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+const coverageHTMLHeader = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>crab coverage</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table.summary td { padding: 0 1em 0 0; }
+pre { font-family: monospace; line-height: 1.3; tab-size: 4; }
+.line { display: block; }
+.number, .count { display: inline-block; text-align: right; color: #888; padding-right: 1em; user-select: none; }
+.number { width: 4em; }
+.count { width: 6em; }
+.covered { background: #dcf5dc; }
+.missed { background: #f8d7d7; }
+.partial { background: #fcf1c7; }
+</style>
+</head>
+<body>
+`
+
+// writeCoverageHTML writes a summary of files followed by their source code to the file at path.
+// Lines are colored green if they were executed, red if they contain a statement which was never executed
+// and yellow if they contain a branch which was only partially taken.
+func writeCoverageHTML(files []interpreter.FileCoverage, path string) error {
+	var b strings.Builder
+	b.WriteString(coverageHTMLHeader)
+
+	b.WriteString("<h1>Coverage</h1>\n<table class=\"summary\">\n")
+	for index, f := range files {
+		fmt.Fprintf(&b, "<tr><td><a href=\"#file%d\">%s</a></td><td>%s</td></tr>\n", index, html.EscapeString(f.Path), html.EscapeString(summarizeCoverage(f).String()))
+	}
+	fmt.Fprintf(&b, "<tr><td><b>total</b></td><td><b>%s</b></td></tr>\n</table>\n", html.EscapeString(summarizeCoverage(files...).String()))
+
+	for index, f := range files {
+		fmt.Fprintf(&b, "<h2 id=\"file%d\">%s</h2>\n", index, html.EscapeString(f.Path))
+		lines, err := annotateCoverage(f)
+		if err != nil {
+			fmt.Fprintf(&b, "<p>%s</p>\n", html.EscapeString(err.Error()))
+			continue
+		}
+		b.WriteString("<pre>")
+		for number, line := range lines {
+			class := "line"
+			if line.missed {
+				class += " missed"
+			} else if line.partial {
+				class += " partial"
+			} else if line.code {
+				class += " covered"
+			}
+			count := ""
+			if line.code {
+				count = fmt.Sprint(line.count)
+			}
+			title := ""
+			if len(line.branches) > 0 {
+				title = fmt.Sprintf(" title=\"%s\"", html.EscapeString(strings.Join(line.branches, "; ")))
+			}
+			fmt.Fprintf(&b, "<span class=\"%s\"%s><span class=\"number\">%d</span><span class=\"count\">%s</span>%s</span>", class, title, number+1, count, html.EscapeString(line.text))
+		}
+		b.WriteString("</pre>\n")
+	}
+	b.WriteString("</body>\n</html>\n")
+
+	err := os.WriteFile(path, []byte(b.String()), 0644)
+	if err != nil {
+		return fmt.Errorf("Failed to write HTML: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,510 @@
+// Package dap implements a debug adapter for crab, which lets editors control the debugger of the interpreter
+// as specified by the Debug Adapter Protocol.
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Bananenpro/crab/interpreter"
+)
+
+type server struct {
+	reader *bufio.Reader
+	writer io.Writer
+	// guards writer and seq, because the events of the program are sent by another goroutine
+	mu  sync.Mutex
+	seq int
+	// held while a request is handled, so that the events caused by the request are sent after its response
+	responding sync.Mutex
+
+	limits          interpreter.Limits
+	linesStartAt1   bool
+	columnsStartAt1 bool
+
+	// set by the launch request
+	debugger    *interpreter.Debugger
+	stopOnEntry bool
+	// set by the configurationDone request, the program is started once it is launched and configured
+	configured bool
+	// set once the program is started
+	started bool
+	// set by the terminate request, a terminated program is never started
+	terminated bool
+	// breakpoints received before the launch request, by path
+	breakpoints map[string][]int
+	// the variables which can be expanded while the program is paused, the reference of a variable is its index + 1
+	references []func() ([]interpreter.DebugVariable, error)
+}
+
+// Serve reads requests from in and writes responses and events to out until the client disconnects.
+// The debugged program is executed by the tree-walking interpreter with limits. Its output is sent as output events.
+func Serve(in io.Reader, out io.Writer, limits interpreter.Limits) error {
+	s := &server{
+		reader:          bufio.NewReader(in),
+		writer:          out,
+		limits:          limits,
+		linesStartAt1:   true,
+		columnsStartAt1: true,
+		breakpoints:     make(map[string][]int),
+	}
+
+	for {
+		content, err := s.read()
+		if err != nil {
+			return err
+		}
+
+		var req request
+		err = json.Unmarshal(content, &req)
+		if err != nil || req.Type != "request" {
+			err = s.event("output", outputEvent{
+				Category: "stderr",
+				Output:   fmt.Sprintf("Invalid message: %s\n", content),
+			})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		s.responding.Lock()
+		body, err := s.handle(req)
+		res := response{
+			Type:       "response",
+			RequestSeq: req.Seq,
+			Success:    err == nil,
+			Command:    req.Command,
+			Body:       body,
+		}
+		if err != nil {
+			res.Message = err.Error()
+		}
+		err = s.write(&res.Seq, &res)
+		s.responding.Unlock()
+		if err != nil {
+			return err
+		}
+
+		switch req.Command {
+		case "initialize":
+			if err := s.event("initialized", nil); err != nil {
+				return err
+			}
+		case "terminate":
+			if !s.started {
+				// otherwise the event is sent once the program exited
+				if err := s.event("terminated", nil); err != nil {
+					return err
+				}
+			}
+		case "disconnect":
+			return nil
+		}
+	}
+}
+
+func (s *server) handle(req request) (any, error) {
+	switch req.Command {
+	case "initialize":
+		var args initializeArguments
+		if err := unmarshalArguments(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		if args.LinesStartAt1 != nil {
+			s.linesStartAt1 = *args.LinesStartAt1
+		}
+		if args.ColumnsStartAt1 != nil {
+			s.columnsStartAt1 = *args.ColumnsStartAt1
+		}
+		return capabilities{
+			SupportsConfigurationDoneRequest: true,
+			SupportsEvaluateForHovers:        true,
+			SupportsTerminateRequest:         true,
+		}, nil
+	case "launch":
+		var args launchArguments
+		if err := unmarshalArguments(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return nil, s.launch(args)
+	case "setBreakpoints":
+		var args setBreakpointsArguments
+		if err := unmarshalArguments(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.setBreakpoints(args), nil
+	case "setExceptionBreakpoints":
+		return nil, nil
+	case "configurationDone":
+		s.configured = true
+		return nil, s.start()
+	case "threads":
+		return threadsResponse{
+			Threads: []thread{{ID: threadID, Name: "main"}},
+		}, nil
+	case "stackTrace":
+		return s.stackTrace()
+	case "scopes":
+		var args frameArguments
+		if err := unmarshalArguments(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.scopes(args.FrameID - 1), nil
+	case "variables":
+		var args variablesArguments
+		if err := unmarshalArguments(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.variables(args.VariablesReference)
+	case "evaluate":
+		var args evaluateArguments
+		if err := unmarshalArguments(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.evaluate(args)
+	case "continue":
+		return continueResponse{AllThreadsContinued: true}, s.resume((*interpreter.Debugger).Continue)
+	case "next":
+		return nil, s.resume((*interpreter.Debugger).StepOver)
+	case "stepIn":
+		return nil, s.resume((*interpreter.Debugger).StepIn)
+	case "stepOut":
+		return nil, s.resume((*interpreter.Debugger).StepOut)
+	case "pause":
+		if s.debugger != nil {
+			s.debugger.Pause()
+		}
+		return nil, nil
+	case "terminate", "disconnect":
+		s.terminated = true
+		if s.started {
+			s.debugger.Terminate()
+		}
+		return nil, nil
+	}
+	return nil, fmt.Errorf("Unsupported command '%s'.", req.Command)
+}
+
+// launch loads the program, which is started as soon as the client sent its configuration.
+func (s *server) launch(args launchArguments) error {
+	if s.debugger != nil {
+		return errors.New("A program is already launched.")
+	}
+
+	_, program, diagnostics := interpreter.LoadFile(args.Program, false)
+	s.report(diagnostics)
+	if interpreter.Errors(diagnostics) != nil {
+		return errors.New("The program contains errors.")
+	}
+
+	s.debugger = interpreter.NewDebugger(program, strings.NewReader(""), outputWriter{server: s, category: "stdout"}, s.limits)
+	for path, lines := range s.breakpoints {
+		s.debugger.SetBreakpoints(path, lines)
+	}
+	s.stopOnEntry = args.StopOnEntry
+	return s.start()
+}
+
+// start starts the program if it is launched and configured.
+func (s *server) start() error {
+	if s.debugger == nil || !s.configured || s.terminated {
+		return nil
+	}
+	err := s.debugger.Start(s.stopOnEntry)
+	if err != nil {
+		return err
+	}
+	s.started = true
+	go s.forwardEvents()
+	return nil
+}
+
+// forwardEvents sends the events of the debugger to the client until the program exits.
+func (s *server) forwardEvents() {
+	for e := range s.debugger.Events() {
+		s.responding.Lock()
+		s.forwardEvent(e)
+		s.responding.Unlock()
+	}
+}
+
+func (s *server) forwardEvent(e interpreter.DebugEvent) {
+	if e.Reason != "" {
+		s.event("stopped", stoppedEvent{
+			Reason:            e.Reason,
+			ThreadID:          threadID,
+			AllThreadsStopped: true,
+		})
+		return
+	}
+
+	if errors.Is(e.Err, interpreter.ErrTerminated) {
+		s.event("terminated", nil)
+		return
+	}
+	exitCode := 0
+	if e.Err != nil {
+		s.report(interpreter.Diagnostics(e.Err))
+		exitCode = 1
+	}
+	s.event("exited", exitedEvent{ExitCode: exitCode})
+	s.event("terminated", nil)
+}
+
+func (s *server) setBreakpoints(args setBreakpointsArguments) setBreakpointsResponse {
+	lines := make([]int, len(args.Breakpoints))
+	breakpoints := make([]breakpoint, len(args.Breakpoints))
+	for index, b := range args.Breakpoints {
+		lines[index] = s.line(b.Line)
+		breakpoints[index] = breakpoint{
+			Verified: true,
+			Line:     b.Line,
+		}
+	}
+	if s.debugger != nil {
+		s.debugger.SetBreakpoints(args.Source.Path, lines)
+	} else {
+		s.breakpoints[args.Source.Path] = lines
+	}
+	return setBreakpointsResponse{Breakpoints: breakpoints}
+}
+
+func (s *server) stackTrace() (any, error) {
+	if s.debugger == nil {
+		return nil, interpreter.ErrNotPaused
+	}
+	frames, err := s.debugger.StackTrace()
+	if err != nil {
+		return nil, err
+	}
+
+	stackFrames := make([]stackFrame, len(frames))
+	for index, frame := range frames {
+		stackFrames[index] = stackFrame{
+			ID:     index + 1,
+			Name:   frame.Function,
+			Line:   s.clientLine(frame.Location.Line),
+			Column: s.clientColumn(frame.Location.Column),
+		}
+		if frame.Location.File != nil {
+			path := frame.Location.File.Path
+			if abs, err := filepath.Abs(path); err == nil {
+				path = abs
+			}
+			stackFrames[index].Source = &source{
+				Name: filepath.Base(path),
+				Path: path,
+			}
+		}
+	}
+	return stackTraceResponse{
+		StackFrames: stackFrames,
+		TotalFrames: len(stackFrames),
+	}, nil
+}
+
+func (s *server) scopes(frame int) scopesResponse {
+	locals := s.reference(func() ([]interpreter.DebugVariable, error) {
+		locals, _, err := s.debugger.Variables(frame)
+		return locals, err
+	})
+	globals := s.reference(func() ([]interpreter.DebugVariable, error) {
+		_, globals, err := s.debugger.Variables(frame)
+		return globals, err
+	})
+	return scopesResponse{
+		Scopes: []scope{
+			{Name: "Locals", VariablesReference: locals},
+			{Name: "Globals", VariablesReference: globals},
+		},
+	}
+}
+
+func (s *server) variables(reference int) (any, error) {
+	if reference < 1 || reference > len(s.references) {
+		return nil, fmt.Errorf("Invalid variables reference %d.", reference)
+	}
+	debugVariables, err := s.references[reference-1]()
+	if err != nil {
+		return nil, err
+	}
+	variables := make([]variable, len(debugVariables))
+	for index, v := range debugVariables {
+		variables[index] = variable{
+			Name:               v.Name,
+			Value:              v.Value,
+			Type:               v.Type,
+			VariablesReference: s.childrenReference(v),
+		}
+	}
+	return variablesResponse{Variables: variables}, nil
+}
+
+func (s *server) evaluate(args evaluateArguments) (any, error) {
+	if s.debugger == nil {
+		return nil, interpreter.ErrNotPaused
+	}
+	frame := 0
+	if args.FrameID > 0 {
+		frame = args.FrameID - 1
+	}
+	result, err := s.debugger.Evaluate(args.Expression, frame)
+	if err != nil {
+		return nil, err
+	}
+	return evaluateResponse{
+		Result:             result.Value,
+		Type:               result.Type,
+		VariablesReference: s.childrenReference(result),
+	}, nil
+}
+
+// resume continues the paused program with step. All variable references become invalid.
+func (s *server) resume(step func(d *interpreter.Debugger) error) error {
+	if s.debugger == nil {
+		return interpreter.ErrNotPaused
+	}
+	s.references = s.references[:0]
+	return step(s.debugger)
+}
+
+// reference returns a new variables reference, whose variables are returned by variables.
+func (s *server) reference(variables func() ([]interpreter.DebugVariable, error)) int {
+	s.references = append(s.references, variables)
+	return len(s.references)
+}
+
+// childrenReference returns the variables reference of the children of v or 0 if v has no children.
+func (s *server) childrenReference(v interpreter.DebugVariable) int {
+	if !v.HasChildren() {
+		return 0
+	}
+	return s.reference(func() ([]interpreter.DebugVariable, error) {
+		return s.debugger.Children(v)
+	})
+}
+
+// report sends diagnostics to the client as output.
+func (s *server) report(diagnostics []interpreter.Diagnostic) {
+	for _, d := range diagnostics {
+		text := fmt.Sprintf("%s: %s\n", d.Severity, d.Message)
+		if d.Line >= 0 {
+			text = fmt.Sprintf("%s:%d:%d: %s", d.Path, d.Line+1, d.Column+1, text)
+		}
+		s.event("output", outputEvent{
+			Category: "stderr",
+			Output:   text,
+		})
+	}
+}
+
+// line converts a line of the client to a line of the interpreter, which start at 0.
+func (s *server) line(line int) int {
+	if s.linesStartAt1 {
+		return line - 1
+	}
+	return line
+}
+
+func (s *server) clientLine(line int) int {
+	if s.linesStartAt1 {
+		return line + 1
+	}
+	return line
+}
+
+func (s *server) clientColumn(column int) int {
+	if s.columnsStartAt1 {
+		return column + 1
+	}
+	return column
+}
+
+// read returns the content of the next message.
+func (s *server) read() ([]byte, error) {
+	length := -1
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		name, value, found := strings.Cut(line, ":")
+		if found && strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("Invalid Content-Length header: %s", err)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, errors.New("Missing Content-Length header.")
+	}
+
+	content := make([]byte, length)
+	_, err := io.ReadFull(s.reader, content)
+	return content, err
+}
+
+// write assigns the next sequence number to seq and writes message.
+func (s *server) write(seq *int, message any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	*seq = s.seq
+	content, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.writer, "Content-Length: %d\r\n\r\n%s", len(content), content)
+	return err
+}
+
+func (s *server) event(name string, body any) error {
+	e := event{
+		Type:  "event",
+		Event: name,
+		Body:  body,
+	}
+	return s.write(&e.Seq, &e)
+}
+
+func unmarshalArguments(arguments json.RawMessage, v any) error {
+	if len(arguments) == 0 {
+		return nil
+	}
+	err := json.Unmarshal(arguments, v)
+	if err != nil {
+		return fmt.Errorf("Invalid arguments: %s", err)
+	}
+	return nil
+}
+
+// outputWriter sends everything written to it as output events.
+type outputWriter struct {
+	server   *server
+	category string
+}
+
+func (o outputWriter) Write(p []byte) (int, error) {
+	err := o.server.event("output", outputEvent{
+		Category: o.category,
+		Output:   string(p),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
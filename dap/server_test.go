@@ -0,0 +1,205 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Bananenpro/crab/interpreter"
+)
+
+const testProgram = `func main() {
+	var sum = 0;
+	for (var i = 0; i < 3; i++) {
+		sum += i;
+	}
+	while (true) {
+		sum++;
+	}
+}
+`
+
+type message struct {
+	Type       string          `json:"type"`
+	Command    string          `json:"command"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Message    string          `json:"message"`
+	Event      string          `json:"event"`
+	Body       json.RawMessage `json:"body"`
+}
+
+func (m message) String() string {
+	if m.Type == "event" {
+		return "event " + m.Event
+	}
+	return "response " + m.Command
+}
+
+// client sends requests to a server started with Serve and receives its responses and events.
+type client struct {
+	t        *testing.T
+	writer   io.Writer
+	messages chan message
+	seq      int
+}
+
+func startServer(t *testing.T) *client {
+	clientIn, serverOut := io.Pipe()
+	serverIn, clientOut := io.Pipe()
+	go func() {
+		Serve(serverIn, serverOut, interpreter.Limits{})
+		serverOut.Close()
+	}()
+	c := &client{
+		t:        t,
+		writer:   clientOut,
+		messages: make(chan message, 100),
+	}
+	go c.read(bufio.NewReader(clientIn))
+	t.Cleanup(func() {
+		clientOut.Close()
+		clientIn.Close()
+	})
+	return c
+}
+
+// read sends all messages of the server to c.messages until the connection is closed.
+func (c *client) read(reader *bufio.Reader) {
+	defer close(c.messages)
+	for {
+		length := -1
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimSpace(line)
+			if line == "" {
+				break
+			}
+			if value := strings.TrimPrefix(line, "Content-Length: "); value != line {
+				length, _ = strconv.Atoi(value)
+			}
+		}
+		content := make([]byte, length)
+		if _, err := io.ReadFull(reader, content); err != nil {
+			return
+		}
+		var msg message
+		if err := json.Unmarshal(content, &msg); err != nil {
+			return
+		}
+		c.messages <- msg
+	}
+}
+
+func (c *client) send(command string, arguments any) {
+	c.t.Helper()
+	c.seq++
+	content, err := json.Marshal(map[string]any{
+		"seq":       c.seq,
+		"type":      "request",
+		"command":   command,
+		"arguments": arguments,
+	})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if _, err := fmt.Fprintf(c.writer, "Content-Length: %d\r\n\r\n%s", len(content), content); err != nil {
+		c.t.Fatalf("send %s: %s", command, err)
+	}
+}
+
+func (c *client) receive() message {
+	c.t.Helper()
+	select {
+	case msg, ok := <-c.messages:
+		if !ok {
+			c.t.Fatal("the server closed the connection")
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("timed out waiting for a message")
+	}
+	return message{}
+}
+
+// expect receives the next messages, which must be the described responses and events in this order.
+// Output events are skipped.
+func (c *client) expect(messages ...string) {
+	c.t.Helper()
+	for _, want := range messages {
+		msg := c.receive()
+		for msg.Event == "output" {
+			msg = c.receive()
+		}
+		if msg.String() != want {
+			c.t.Fatalf("expected %s, got %s", want, msg)
+		}
+		if msg.Type == "response" && !msg.Success {
+			c.t.Fatalf("%s failed: %s", msg.Command, msg.Message)
+		}
+	}
+}
+
+func launch(t *testing.T, stopOnEntry bool) *client {
+	path := filepath.Join(t.TempDir(), "main.cb")
+	if err := os.WriteFile(path, []byte(testProgram), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := startServer(t)
+	c.send("initialize", map[string]any{"adapterID": "crab"})
+	c.expect("response initialize", "event initialized")
+	c.send("launch", launchArguments{Program: path, StopOnEntry: stopOnEntry})
+	c.expect("response launch")
+	c.send("configurationDone", nil)
+	c.expect("response configurationDone")
+	return c
+}
+
+func TestStepResponsesPrecedeStoppedEvents(t *testing.T) {
+	c := launch(t, true)
+	c.expect("event stopped")
+
+	// the entry is the declaration of main, whose body is only entered with stepIn
+	c.send("stepIn", map[string]any{"threadId": threadID})
+	c.expect("response stepIn", "event stopped")
+	for i := 0; i < 20; i++ {
+		c.send("next", map[string]any{"threadId": threadID})
+		c.expect("response next", "event stopped")
+	}
+
+	c.send("terminate", nil)
+	c.expect("response terminate", "event terminated")
+	c.send("disconnect", nil)
+	c.expect("response disconnect")
+}
+
+func TestTerminateRunningProgram(t *testing.T) {
+	c := launch(t, false)
+
+	c.send("terminate", nil)
+	c.expect("response terminate", "event terminated")
+	c.send("disconnect", nil)
+	c.expect("response disconnect")
+}
+
+func TestTerminateBeforeStart(t *testing.T) {
+	c := startServer(t)
+	c.send("initialize", map[string]any{"adapterID": "crab"})
+	c.expect("response initialize", "event initialized")
+
+	c.send("terminate", nil)
+	c.expect("response terminate", "event terminated")
+	c.send("disconnect", nil)
+	c.expect("response disconnect")
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Bananenpro/crab/dap"
+	"github.com/Bananenpro/crab/interpreter"
+)
+
+const debugHelp = `Commands:
+  c, continue          continue until the next breakpoint
+  s, step              step to the next statement, entering called functions
+  n, next              step to the next statement of the current function
+  o, out               continue until the current function returns
+  b, break [file:]line set a breakpoint
+  clear [file:]line    remove a breakpoint
+  breakpoints          list all breakpoints
+  bt, stack            print the call stack
+  f, frame index       select a frame of the call stack
+  l, locals            print the local variables of the selected frame
+  g, globals           print the global variables of the selected frame
+  p, print expression  evaluate an expression in the selected frame
+  w, watch expression  evaluate an expression every time the program pauses
+  unwatch index        remove a watch expression
+  h, help              print this help
+  q, quit              stop the program
+An empty line repeats the last command.`
+
+// runDebug executes the 'debug' subcommand and returns the exit code.
+func runDebug(args []string) int {
+	flags := flag.NewFlagSet("debug", flag.ExitOnError)
+	useDAP := flags.Bool("dap", false, "Communicate with an editor over the Debug Adapter Protocol on stdin and stdout.")
+	breakLines := flags.String("break", "", "Comma-separated lines of the program at which it is paused.")
+	limits := limitFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s debug [options] file\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s debug -dap\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nExecutes the program with the tree-walking interpreter and pauses it before its first statement.\n")
+		fmt.Fprintf(os.Stderr, "Type 'help' while the program is paused to list all commands.\n")
+		fmt.Fprintf(os.Stderr, "\nOptions:\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *useDAP {
+		err := dap.Serve(os.Stdin, os.Stdout, *limits)
+		if err != nil && err != io.EOF {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 1
+	}
+	path := flags.Arg(0)
+	program, err := loadProgram(path)
+	if err != nil {
+		return 1
+	}
+
+	// the program and the debugger share the input, so neither of them buffers input meant for the other
+	input := bufio.NewReader(os.Stdin)
+	t := &terminalDebugger{
+		debugger:    interpreter.NewDebugger(program, input, os.Stdout, *limits),
+		input:       input,
+		path:        path,
+		breakpoints: make(map[string][]int),
+		watches:     make([]string, 0),
+	}
+	if *breakLines != "" {
+		for _, line := range strings.Split(*breakLines, ",") {
+			if err := t.setBreakpoint(strings.TrimSpace(line), true); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+		}
+	}
+	return t.run()
+}
+
+// loadProgram scans, parses and checks the program in path and prints its errors and warnings to stderr.
+func loadProgram(path string) ([]interpreter.Stmt, error) {
+	diagnostics, _ := newDiagnosticsPrinter(diagnosticsText, os.Stderr)
+	_, program, loadDiagnostics := interpreter.LoadFile(path, false)
+	diagnostics.print(loadDiagnostics...)
+	if err := interpreter.Errors(loadDiagnostics); err != nil {
+		return nil, err
+	}
+	return program, nil
+}
+
+// terminalDebugger lets the user control a debugger with commands typed into the terminal.
+type terminalDebugger struct {
+	debugger *interpreter.Debugger
+	input    *bufio.Reader
+	// the path of the program, used for breakpoints without a file
+	path string
+	// lines starting at 0 by path
+	breakpoints map[string][]int
+	watches     []string
+	// the index of the selected frame in the call stack
+	frame       int
+	lastCommand string
+}
+
+func (t *terminalDebugger) run() int {
+	t.debugger.Start(true)
+	for e := range t.debugger.Events() {
+		if e.Reason == "" {
+			if e.Err != nil {
+				fmt.Fprintln(os.Stderr, e.Err)
+				return 1
+			}
+			return 0
+		}
+
+		t.frame = 0
+		fmt.Printf("Paused (%s) at %s\n", e.Reason, formatLocation(e.Location))
+		printSourceLine(e.Location)
+		t.printWatches()
+		if !t.prompt() {
+			return 0
+		}
+	}
+	return 0
+}
+
+// prompt executes commands until one of them continues the program. It returns false if the user wants to quit.
+func (t *terminalDebugger) prompt() bool {
+	for {
+		fmt.Print("(crab) ")
+		line, err := t.input.ReadString('\n')
+		if err != nil {
+			fmt.Println()
+			return false
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			line = t.lastCommand
+		}
+		t.lastCommand = line
+
+		command, argument, _ := strings.Cut(line, " ")
+		argument = strings.TrimSpace(argument)
+		switch command {
+		case "":
+		case "c", "continue":
+			return t.resume(t.debugger.Continue)
+		case "s", "step":
+			return t.resume(t.debugger.StepIn)
+		case "n", "next":
+			return t.resume(t.debugger.StepOver)
+		case "o", "out":
+			return t.resume(t.debugger.StepOut)
+		case "b", "break":
+			err = t.setBreakpoint(argument, true)
+		case "clear":
+			err = t.setBreakpoint(argument, false)
+		case "breakpoints":
+			t.printBreakpoints()
+		case "bt", "stack":
+			err = t.printStack()
+		case "f", "frame":
+			err = t.selectFrame(argument)
+		case "l", "locals":
+			err = t.printVariables(true)
+		case "g", "globals":
+			err = t.printVariables(false)
+		case "p", "print":
+			var result interpreter.DebugVariable
+			result, err = t.debugger.Evaluate(argument, t.frame)
+			if err == nil {
+				fmt.Println(result.Value)
+			}
+		case "w", "watch":
+			if argument == "" {
+				err = errors.New("Missing expression.")
+				break
+			}
+			t.watches = append(t.watches, argument)
+			t.printWatches()
+		case "unwatch":
+			var index int
+			index, err = strconv.Atoi(argument)
+			if err != nil || index < 1 || index > len(t.watches) {
+				err = fmt.Errorf("Invalid watch expression '%s'.", argument)
+				break
+			}
+			t.watches = append(t.watches[:index-1], t.watches[index:]...)
+		case "h", "help":
+			fmt.Println(debugHelp)
+		case "q", "quit":
+			return false
+		default:
+			err = fmt.Errorf("Unknown command '%s'. Type 'help' to list all commands.", command)
+		}
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+func (t *terminalDebugger) resume(step func() error) bool {
+	if err := step(); err != nil {
+		fmt.Println(err)
+	}
+	return true
+}
+
+// setBreakpoint sets or removes the breakpoint at location, which is a line of the program or a file and a line separated by ':'.
+func (t *terminalDebugger) setBreakpoint(location string, set bool) error {
+	path := t.path
+	lineText := location
+	if index := strings.LastIndex(location, ":"); index >= 0 {
+		path, lineText = location[:index], location[index+1:]
+	}
+	line, err := strconv.Atoi(lineText)
+	if err != nil || line < 1 {
+		return fmt.Errorf("Invalid breakpoint '%s'. Expected [file:]line.", location)
+	}
+	line--
+
+	lines := make([]int, 0, len(t.breakpoints[path])+1)
+	for _, l := range t.breakpoints[path] {
+		if l != line {
+			lines = append(lines, l)
+		}
+	}
+	if set {
+		lines = append(lines, line)
+		sort.Ints(lines)
+	}
+	t.breakpoints[path] = lines
+	t.debugger.SetBreakpoints(path, lines)
+	return nil
+}
+
+func (t *terminalDebugger) printBreakpoints() {
+	paths := make([]string, 0, len(t.breakpoints))
+	for path := range t.breakpoints {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		for _, line := range t.breakpoints[path] {
+			fmt.Printf("%s:%d\n", path, line+1)
+		}
+	}
+}
+
+func (t *terminalDebugger) printStack() error {
+	frames, err := t.debugger.StackTrace()
+	if err != nil {
+		return err
+	}
+	for index, frame := range frames {
+		marker := " "
+		if index == t.frame {
+			marker = "*"
+		}
+		fmt.Printf("%s %d %s (%s)\n", marker, index, frame.Function, formatLocation(frame.Location))
+	}
+	return nil
+}
+
+func (t *terminalDebugger) selectFrame(argument string) error {
+	frames, err := t.debugger.StackTrace()
+	if err != nil {
+		return err
+	}
+	index, err := strconv.Atoi(argument)
+	if err != nil || index < 0 || index >= len(frames) {
+		return fmt.Errorf("Invalid frame '%s'.", argument)
+	}
+	t.frame = index
+	fmt.Printf("%s (%s)\n", frames[index].Function, formatLocation(frames[index].Location))
+	printSourceLine(frames[index].Location)
+	return nil
+}
+
+func (t *terminalDebugger) printVariables(locals bool) error {
+	localVariables, globalVariables, err := t.debugger.Variables(t.frame)
+	if err != nil {
+		return err
+	}
+	variables := globalVariables
+	if locals {
+		variables = localVariables
+	}
+	for _, v := range variables {
+		fmt.Printf("%s = %s\n", v.Name, v.Value)
+	}
+	return nil
+}
+
+func (t *terminalDebugger) printWatches() {
+	for index, watch := range t.watches {
+		result, err := t.debugger.Evaluate(watch, t.frame)
+		if err != nil {
+			fmt.Printf("%d: %s: %s\n", index+1, watch, err)
+			continue
+		}
+		fmt.Printf("%d: %s = %s\n", index+1, watch, result.Value)
+	}
+}
+
+func formatLocation(location interpreter.Token) string {
+	if location.File == nil {
+		return fmt.Sprintf("%d:%d", location.Line+1, location.Column+1)
+	}
+	return fmt.Sprintf("%s:%d:%d", location.File.Path, location.Line+1, location.Column+1)
+}
+
+func printSourceLine(location interpreter.Token) {
+	if location.File == nil || location.Line < 0 || location.Line >= len(location.File.Lines) {
+		return
+	}
+	fmt.Printf("[%d]  %s\n", location.Line+1, strings.TrimSpace(string(location.File.Lines[location.Line])))
+}
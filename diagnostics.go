@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/Bananenpro/crab/interpreter"
+)
+
+// diagnostics formats supported by the -diagnostics flag
+const (
+	diagnosticsText  = "text"
+	diagnosticsJSON  = "json"
+	diagnosticsSARIF = "sarif"
+)
+
+// diagnosticsPrinter writes errors and warnings in the format selected by the -diagnostics flag.
+type diagnosticsPrinter struct {
+	format string
+	writer io.Writer
+	// SARIF logs are a single document, so they are collected until flush is called
+	results []interpreter.Diagnostic
+}
+
+func newDiagnosticsPrinter(format string, writer io.Writer) (*diagnosticsPrinter, error) {
+	if format != diagnosticsText && format != diagnosticsJSON && format != diagnosticsSARIF {
+		return nil, fmt.Errorf("Unknown diagnostics format '%s'.", format)
+	}
+	return &diagnosticsPrinter{
+		format:  format,
+		writer:  writer,
+		results: make([]interpreter.Diagnostic, 0),
+	}, nil
+}
+
+// printError writes the errors contained in err.
+// The text format keeps the text of err, which includes the stack trace of uncaught exceptions.
+func (p *diagnosticsPrinter) printError(err error) {
+	if p.format == diagnosticsText {
+		fmt.Fprintln(p.writer, err)
+		return
+	}
+	p.print(interpreter.Diagnostics(err)...)
+}
+
+func (p *diagnosticsPrinter) print(diagnostics ...interpreter.Diagnostic) {
+	switch p.format {
+	case diagnosticsText:
+		for _, d := range diagnostics {
+			fmt.Fprintln(p.writer, d)
+		}
+	case diagnosticsJSON:
+		// one record per line, because errors of the running program are only known when they occur
+		encoder := json.NewEncoder(p.writer)
+		for _, d := range diagnostics {
+			encoder.Encode(newDiagnosticRecord(d))
+		}
+	case diagnosticsSARIF:
+		p.results = append(p.results, diagnostics...)
+	}
+}
+
+// flush writes the SARIF log. It must be called before the program exits.
+func (p *diagnosticsPrinter) flush() {
+	if p.format != diagnosticsSARIF {
+		return
+	}
+	log := sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs: []sarifRun{{
+			Tool: sarifTool{
+				Driver: sarifDriver{
+					Name:           "crab",
+					InformationURI: "https://github.com/Bananenpro/crab",
+				},
+			},
+			Results: make([]sarifResult, 0, len(p.results)),
+		}},
+	}
+	for _, d := range p.results {
+		result := sarifResult{
+			RuleID:  d.Code,
+			Level:   d.Severity.String(),
+			Message: sarifMessage{Text: d.Message},
+		}
+		if d.Line >= 0 {
+			result.Locations = []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(d.Path)},
+					Region: sarifRegion{
+						StartLine:   d.Line + 1,
+						StartColumn: d.Column + 1,
+						EndColumn:   d.EndColumn + 1,
+					},
+				},
+			}}
+		}
+		log.Runs[0].Results = append(log.Runs[0].Results, result)
+	}
+	encoder := json.NewEncoder(p.writer)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(log)
+	p.results = p.results[:0]
+}
+
+// diagnosticRecord is a diagnostic in the JSON format.
+// Lines and columns start at 1, EndColumn is the column after the last character. The position is omitted if it is unknown.
+type diagnosticRecord struct {
+	File      string `json:"file,omitempty"`
+	Line      int    `json:"line,omitempty"`
+	Column    int    `json:"column,omitempty"`
+	EndColumn int    `json:"endColumn,omitempty"`
+	Severity  string `json:"severity"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+}
+
+func newDiagnosticRecord(d interpreter.Diagnostic) diagnosticRecord {
+	record := diagnosticRecord{
+		Severity: d.Severity.String(),
+		Code:     d.Code,
+		Message:  d.Message,
+	}
+	if d.Line >= 0 {
+		record.File = d.Path
+		record.Line = d.Line + 1
+		record.Column = d.Column + 1
+		record.EndColumn = d.EndColumn + 1
+	}
+	return record
+}
+
+// The following types are the parts of the SARIF 2.1.0 format used by crab.
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string `json:"name"`
+	InformationURI string `json:"informationUri"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndColumn   int `json:"endColumn"`
+}
+
+// useColors reports whether colored text should be written to file.
+// Colors are disabled by the NO_COLOR environment variable and if file is not a terminal.
+func useColors(file *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
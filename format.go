@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Bananenpro/crab/interpreter"
+)
+
+// runFormat executes the 'fmt' subcommand and returns the exit code.
+func runFormat(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "Write the result to the source file instead of stdout.")
+	diff := flags.Bool("d", false, "Print a diff instead of the formatted source.")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s fmt [options] [files or directories]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nFormats crab source code. Reads from stdin if no file is provided.\n")
+		fmt.Fprintf(os.Stderr, "Directories are searched recursively for files ending with '.cb'.\n")
+		fmt.Fprintf(os.Stderr, "\nOptions:\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(os.Stderr, "Cannot use -w with stdin.")
+			return 1
+		}
+		source, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		err = formatSource(source, "<stdin>", false, *diff)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	files, err := findFiles(flags.Args(), ".cb")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	exitCode := 0
+	for _, file := range files {
+		source, err := os.ReadFile(file)
+		if err == nil {
+			err = formatSource(source, file, *write, *diff)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 1
+		}
+	}
+	return exitCode
+}
+
+func formatSource(source []byte, path string, write, diff bool) error {
+	formatted, err := interpreter.Format(bytes.NewReader(source), path)
+	if err != nil {
+		return err
+	}
+
+	if diff {
+		if formatted != string(source) {
+			fmt.Print(unifiedDiff(path, string(source), formatted))
+		}
+	} else if !write {
+		fmt.Print(formatted)
+	}
+
+	if write && formatted != string(source) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, []byte(formatted), info.Mode().Perm())
+	}
+	return nil
+}
+
+type diffOperation byte
+
+const (
+	diffEqual  diffOperation = ' '
+	diffDelete diffOperation = '-'
+	diffInsert diffOperation = '+'
+)
+
+type diffLine struct {
+	operation diffOperation
+	text      string
+}
+
+// unifiedDiff returns the changes from a to b in the unified diff format with three lines of context.
+func unifiedDiff(path, a, b string) string {
+	lines := diffLines(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s (original)\n+++ %s (formatted)\n", path, path)
+
+	const context = 3
+	for start := 0; start < len(lines); {
+		if lines[start].operation == diffEqual {
+			start++
+			continue
+		}
+
+		// extend the hunk until there are more than 2*context equal lines in a row
+		hunkStart := start - context
+		if hunkStart < 0 {
+			hunkStart = 0
+		}
+		end := start
+		for equal := 0; end < len(lines) && equal <= 2*context; end++ {
+			if lines[end].operation == diffEqual {
+				equal++
+			} else {
+				equal = 0
+			}
+		}
+		for end > start && lines[end-1].operation == diffEqual {
+			end--
+		}
+		hunkEnd := end + context
+		if hunkEnd > len(lines) {
+			hunkEnd = len(lines)
+		}
+
+		lineA, lineB := 1, 1
+		for _, l := range lines[:hunkStart] {
+			if l.operation != diffInsert {
+				lineA++
+			}
+			if l.operation != diffDelete {
+				lineB++
+			}
+		}
+		countA, countB := 0, 0
+		for _, l := range lines[hunkStart:hunkEnd] {
+			if l.operation != diffInsert {
+				countA++
+			}
+			if l.operation != diffDelete {
+				countB++
+			}
+		}
+
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", lineA, countA, lineB, countB)
+		for _, l := range lines[hunkStart:hunkEnd] {
+			fmt.Fprintf(&out, "%c%s\n", l.operation, l.text)
+		}
+		start = hunkEnd
+	}
+	return out.String()
+}
+
+// diffLines computes the shortest edit script from a to b using the longest common subsequence.
+func diffLines(a, b []string) []diffLine {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]diffLine, 0, len(a)+len(b))
+	for _, l := range a[:prefix] {
+		lines = append(lines, diffLine{diffEqual, l})
+	}
+
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	// lcs[i][j] is the length of the longest common subsequence of midA[i:] and midB[j:]
+	lcs := make([][]int32, len(midA)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(midB)+1)
+	}
+	for i := len(midA) - 1; i >= 0; i-- {
+		for j := len(midB) - 1; j >= 0; j-- {
+			if midA[i] == midB[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(midA) || j < len(midB) {
+		switch {
+		case i < len(midA) && j < len(midB) && midA[i] == midB[j]:
+			lines = append(lines, diffLine{diffEqual, midA[i]})
+			i++
+			j++
+		case j == len(midB) || i < len(midA) && lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, diffLine{diffDelete, midA[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{diffInsert, midB[j]})
+			j++
+		}
+	}
+
+	for _, l := range a[len(a)-suffix:] {
+		lines = append(lines, diffLine{diffEqual, l})
+	}
+	return lines
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
@@ -0,0 +1,214 @@
+package interpreter
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Symbol is a declared name.
+type Symbol struct {
+	// Line is -1 for builtin functions.
+	Name Token
+	// variable, parameter, function, class, field, method or module
+	Kind string
+	// Detail is a short description of the symbol, e.g. the signature of a function.
+	Detail string
+	// the last token of the scope the symbol was declared in, Line is -1 for global symbols
+	scopeEnd Token
+	// fields and methods are only accessible through an instance
+	member bool
+}
+
+// Reference is a name in the source code which refers to a symbol.
+type Reference struct {
+	Name   Token
+	Symbol *Symbol
+}
+
+// Analysis contains everything the checker knows about a program without executing it.
+type Analysis struct {
+	Diagnostics []Diagnostic
+	// all symbols including those of imported modules
+	Symbols    []*Symbol
+	References []Reference
+	path       string
+	members    map[*StmtClass]map[string]*Symbol
+}
+
+// Analyze scans, parses and checks source like Check.
+// Additionally it records all symbols and references, which is useful for editor tooling.
+func Analyze(source io.Reader, path string) *Analysis {
+	analysis := &Analysis{
+		Diagnostics: make([]Diagnostic, 0),
+		Symbols:     make([]*Symbol, 0),
+		References:  make([]Reference, 0),
+		path:        path,
+		members:     make(map[*StmtClass]map[string]*Symbol),
+	}
+
+	tokens, err := Scan(source, path)
+	if err != nil {
+		analysis.Diagnostics = Diagnostics(err)
+		return analysis
+	}
+
+	program, errs := Parse(tokens)
+
+	checker := newChecker(newModuleLoader())
+	checker.testFile = strings.HasSuffix(path, "_test.cb")
+	checker.analysis = analysis
+	for name, v := range checker.scopes[0] {
+		v.symbol = checker.newSymbol(v.functionDecl.Name, "function", nativeSignature(name, nativeFunctions[name]))
+		checker.scopes[0][name] = v
+	}
+
+	checker.check(program, true)
+	if len(errs) > 0 {
+		// declarations with syntax errors are missing, so only the syntax errors are reliable
+		analysis.Diagnostics = Diagnostics(errorList(errs))
+		return analysis
+	}
+	analysis.Diagnostics = checker.diagnostics
+	return analysis
+}
+
+// ReferenceAt returns the name at the position in the analysed file and the symbol it refers to.
+// Declarations refer to their own symbol.
+func (a *Analysis) ReferenceAt(line, column int) (Reference, bool) {
+	for _, r := range a.References {
+		if a.contains(r.Name, line, column) {
+			return r, true
+		}
+	}
+	for _, s := range a.Symbols {
+		if a.contains(s.Name, line, column) {
+			return Reference{
+				Name:   s.Name,
+				Symbol: s,
+			}, true
+		}
+	}
+	return Reference{}, false
+}
+
+// SymbolsInScope returns all symbols accessible by name at the position in the analysed file, including builtin functions.
+// Shadowed symbols are omitted. The result is sorted by name.
+func (a *Analysis) SymbolsInScope(line, column int) []*Symbol {
+	symbols := make(map[string]*Symbol)
+	for _, s := range a.Symbols {
+		if s.member || (s.Name.Line >= 0 && s.Name.path() != a.path) {
+			continue
+		}
+		if s.Name.Line >= 0 && !before(s.Name.Line, s.Name.Column, line, column) {
+			continue
+		}
+		if s.scopeEnd.Line >= 0 && before(s.scopeEnd.Line, s.scopeEnd.Column, line, column) {
+			continue
+		}
+		// inner scopes are checked after outer ones
+		symbols[s.Name.Lexeme] = s
+	}
+
+	result := make([]*Symbol, 0, len(symbols))
+	for _, s := range symbols {
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name.Lexeme < result[j].Name.Lexeme
+	})
+	return result
+}
+
+func (a *Analysis) contains(token Token, line, column int) bool {
+	return token.Line == line && token.path() == a.path && column >= token.Column && column <= token.Column+len([]rune(token.Lexeme))
+}
+
+// before reports whether position a is before position b.
+func before(lineA, columnA, lineB, columnB int) bool {
+	return lineA < lineB || lineA == lineB && columnA < columnB
+}
+
+func (c *checker) newSymbol(name Token, kind, detail string) *Symbol {
+	if c.analysis == nil {
+		return nil
+	}
+	symbol := &Symbol{
+		Name:     name,
+		Kind:     kind,
+		Detail:   detail,
+		scopeEnd: c.ends[c.scope],
+	}
+	c.analysis.Symbols = append(c.analysis.Symbols, symbol)
+	return symbol
+}
+
+func (c *checker) newMemberSymbols(class *StmtClass) {
+	if c.analysis == nil {
+		return
+	}
+	members := make(map[string]*Symbol)
+	for _, field := range class.Fields {
+		for _, name := range field.Names {
+			members[name.Lexeme] = c.newSymbol(name, "field", fmt.Sprintf("var %s.%s", class.Name.Lexeme, name.Lexeme))
+			members[name.Lexeme].member = true
+		}
+	}
+	for _, method := range class.Methods {
+		members[method.Name.Lexeme] = c.newSymbol(method.Name, "method", class.Name.Lexeme+"."+signature(method.Name.Lexeme, method.Parameters, method.ReturnValueCount, method.Throws))
+		members[method.Name.Lexeme].member = true
+	}
+	c.analysis.members[class] = members
+}
+
+func (c *checker) reference(name Token, symbol *Symbol) {
+	if c.analysis == nil || symbol == nil {
+		return
+	}
+	c.analysis.References = append(c.analysis.References, Reference{
+		Name:   name,
+		Symbol: symbol,
+	})
+}
+
+func (c *checker) referenceMember(class *StmtClass, name Token) {
+	if c.analysis == nil {
+		return
+	}
+	c.reference(name, c.analysis.members[class][name.Lexeme])
+}
+
+func signature(name string, parameters []Token, returnValueCount int, throws bool) string {
+	names := make([]string, len(parameters))
+	for i, p := range parameters {
+		names[i] = p.Lexeme
+	}
+	text := fmt.Sprintf("func %s(%s)", name, strings.Join(names, ", "))
+	if returnValueCount > 0 {
+		text = fmt.Sprintf("%s %d", text, returnValueCount)
+	}
+	if throws {
+		text += " throws"
+	}
+	return text
+}
+
+func nativeSignature(name string, callable Callable) string {
+	parameters := "..."
+	if callable.ArgumentCount() >= 0 {
+		names := make([]string, callable.ArgumentCount())
+		for i := range names {
+			names[i] = "_"
+		}
+		parameters = strings.Join(names, ", ")
+	}
+	text := fmt.Sprintf("func %s(%s)", name, parameters)
+	if callable.ReturnValueCount() > 0 {
+		text = fmt.Sprintf("%s %d", text, callable.ReturnValueCount())
+	}
+	if callable.Throws() {
+		text += " throws"
+	}
+	return text
+}
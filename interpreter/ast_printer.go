@@ -48,6 +48,17 @@ func (a ASTPrinter) VisitFuncDecl(stmt *StmtFuncDecl) error {
 	return PrinterResult(fmt.Sprintf("[fn] func %s() %d %s %s", stmt.Name.Lexeme, stmt.ReturnValueCount, throws, body))
 }
 
+func (a ASTPrinter) VisitClass(stmt *StmtClass) error {
+	str := fmt.Sprintf("[cl] class %s {\n", stmt.Name.Lexeme)
+	for _, f := range stmt.Fields {
+		str = fmt.Sprintf("%s%v\n", str, f.Accept(a))
+	}
+	for _, m := range stmt.Methods {
+		str = fmt.Sprintf("%s%v\n", str, m.Accept(a))
+	}
+	return PrinterResult(fmt.Sprintf("%s}", str))
+}
+
 func (a ASTPrinter) VisitIf(stmt *StmtIf) error {
 	condition, _ := stmt.Condition.Accept(a)
 
@@ -74,17 +85,32 @@ func (a ASTPrinter) VisitTry(stmt *StmtTry) error {
 		body = fmt.Sprintf("{\n%v\n}", body)
 	}
 
-	catchBody := stmt.CatchBody.Accept(a).Error()
-	if !strings.HasPrefix(catchBody, "{") {
-		catchBody = fmt.Sprintf("{\n%v\n}", catchBody)
+	catches := ""
+	for _, clause := range stmt.Catches {
+		catchBody := clause.Body.Accept(a).Error()
+		if !strings.HasPrefix(catchBody, "{") {
+			catchBody = fmt.Sprintf("{\n%v\n}", catchBody)
+		}
+		switch {
+		case clause.Name.Lexeme == "":
+			catches += fmt.Sprintf("\ncatch\n%s", catchBody)
+		case clause.Kind.Lexeme == "":
+			catches += fmt.Sprintf("\ncatch (%s)\n%s", clause.Name.Lexeme, catchBody)
+		default:
+			catches += fmt.Sprintf("\ncatch (%s: %s)\n%s", clause.Name.Lexeme, clause.Kind.Lexeme, catchBody)
+		}
 	}
-	if stmt.ExceptionName.Lexeme == "" {
-		catchBody = fmt.Sprintf("\ncatch\n%s", catchBody)
-	} else {
-		catchBody = fmt.Sprintf("\ncatch (%s)\n%s", stmt.ExceptionName.Lexeme, catchBody)
+
+	if stmt.Finally != nil {
+		catches += fmt.Sprintf("\nfinally\n%s", stmt.Finally.Accept(a).Error())
 	}
 
-	return PrinterResult(fmt.Sprintf("[tr] try\n%s%s", body, catchBody))
+	return PrinterResult(fmt.Sprintf("[tr] try\n%s%s", body, catches))
+}
+
+func (a ASTPrinter) VisitDefer(stmt *StmtDefer) error {
+	call, _ := stmt.Call.Accept(a)
+	return PrinterResult(fmt.Sprintf("[de] defer %v;", call))
 }
 
 func (a ASTPrinter) VisitWhile(stmt *StmtWhile) error {
@@ -111,6 +137,41 @@ func (a ASTPrinter) VisitFor(stmt *StmtFor) error {
 	return PrinterResult(fmt.Sprintf("[fo] for (%v;%v;%v)\n%s", initializer, condition, increment, body))
 }
 
+func (a ASTPrinter) VisitForEach(stmt *StmtForEach) error {
+	collection, _ := stmt.Collection.Accept(a)
+
+	body := stmt.Body.Accept(a).Error()
+	if !strings.HasPrefix(body, "{") {
+		body = fmt.Sprintf("{\n%v\n}", body)
+	}
+
+	variables := stmt.Element.Lexeme
+	if stmt.Index.Lexeme != "" {
+		variables = fmt.Sprintf("%s, %s", stmt.Index.Lexeme, stmt.Element.Lexeme)
+	}
+	return PrinterResult(fmt.Sprintf("[fe] for (var %s in %v)\n%s", variables, collection, body))
+}
+
+func (a ASTPrinter) VisitMatch(stmt *StmtMatch) error {
+	value, _ := stmt.Value.Accept(a)
+
+	cases := ""
+	for _, matchCase := range stmt.Cases {
+		patterns := make([]string, len(matchCase.Patterns))
+		for index, pattern := range matchCase.Patterns {
+			patterns[index] = pattern.String()
+		}
+		guard := ""
+		if matchCase.Guard != nil {
+			g, _ := matchCase.Guard.Accept(a)
+			guard = fmt.Sprintf(" if %v", g)
+		}
+		body := matchCase.Body.Accept(a).Error()
+		cases = fmt.Sprintf("%scase %s%s:\n%s\n", cases, strings.Join(patterns, ", "), guard, body)
+	}
+	return PrinterResult(fmt.Sprintf("[ma] match (%v) {\n%s}", value, cases))
+}
+
 func (a ASTPrinter) VisitLoopControl(stmt *StmtLoopControl) error {
 	return PrinterResult(fmt.Sprintf("[lc] %s;", stmt.Keyword.Lexeme))
 }
@@ -133,6 +194,10 @@ func (a ASTPrinter) VisitThrow(stmt *StmtThrow) error {
 	return PrinterResult(fmt.Sprintf("throw %v;", stmt.Value))
 }
 
+func (a ASTPrinter) VisitImport(stmt *StmtImport) error {
+	return PrinterResult(fmt.Sprintf("[im] import %s as %s;", toString(stmt.Path.Literal), stmt.Namespace.Lexeme))
+}
+
 func (a ASTPrinter) VisitBlock(stmt *StmtBlock) error {
 	str := fmt.Sprintf("{\n")
 	for _, s := range stmt.Statements {
@@ -146,6 +211,16 @@ func (a ASTPrinter) VisitLiteral(literal *ExprLiteral) (any, error) {
 	return toString(literal.Value), nil
 }
 
+func (a ASTPrinter) VisitTemplate(expr *ExprTemplate) (any, error) {
+	parts := ""
+	for _, part := range expr.Parts {
+		p, _ := part.Accept(a)
+		parts = fmt.Sprintf("%s%v,", parts, p)
+	}
+	parts = strings.Trim(parts, ",")
+	return fmt.Sprintf("(${%v})", parts), nil
+}
+
 func (a ASTPrinter) VisitGrouping(grouping *ExprGrouping) (any, error) {
 	expr, _ := grouping.Expr.Accept(a)
 	return fmt.Sprintf("%v", expr), nil
@@ -161,6 +236,17 @@ func (a ASTPrinter) VisitList(list *ExprList) (any, error) {
 	return fmt.Sprintf("([%v])", values), nil
 }
 
+func (a ASTPrinter) VisitMap(expr *ExprMap) (any, error) {
+	entries := ""
+	for index, key := range expr.Keys {
+		k, _ := key.Accept(a)
+		v, _ := expr.Values[index].Accept(a)
+		entries = fmt.Sprintf("%s%v:%v,", entries, k, v)
+	}
+	entries = strings.Trim(entries, ",")
+	return fmt.Sprintf("({%v})", entries), nil
+}
+
 func (a ASTPrinter) VisitVariable(variable *ExprVariable) (any, error) {
 	return fmt.Sprintf("(%s:%d)", variable.Name.Lexeme, variable.NestingLevel), nil
 }
@@ -182,6 +268,15 @@ func (a ASTPrinter) VisitSubscript(expr *ExprSubscript) (any, error) {
 	return fmt.Sprintf("(%v[%v])", object, subscript), nil
 }
 
+func (a ASTPrinter) VisitProperty(expr *ExprProperty) (any, error) {
+	object, _ := expr.Object.Accept(a)
+	return fmt.Sprintf("(%v.%s)", object, expr.Name.Lexeme), nil
+}
+
+func (a ASTPrinter) VisitThis(expr *ExprThis) (any, error) {
+	return "this", nil
+}
+
 func (a ASTPrinter) VisitUnary(unary *ExprUnary) (any, error) {
 	right, _ := unary.Right.Accept(a)
 	return fmt.Sprintf("(%s%v)", unary.Operator.Lexeme, right), nil
@@ -0,0 +1,43 @@
+package interpreter_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Bananenpro/crab/interpreter"
+)
+
+// BenchmarkPrograms runs the main function of every program in the benchmarks directory with both engines.
+func BenchmarkPrograms(b *testing.B) {
+	paths, err := filepath.Glob(filepath.Join("..", "benchmarks", "*.cb"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		name := strings.TrimSuffix(filepath.Base(path), ".cb")
+		for _, engine := range []interpreter.Engine{interpreter.EngineTree, interpreter.EngineVM} {
+			engine := engine
+			b.Run(name+"/"+string(engine), func(b *testing.B) {
+				r := interpreter.NewRuntime(interpreter.WithEngine(engine), interpreter.WithStdout(io.Discard), interpreter.WithStderr(io.Discard))
+				if err := r.Load(bytes.NewReader(source), path); err != nil {
+					b.Fatal(err)
+				}
+				b.ReportAllocs()
+				b.ResetTimer()
+				for n := 0; n < b.N; n++ {
+					if _, err := r.Call("main"); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
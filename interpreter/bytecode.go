@@ -0,0 +1,273 @@
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+)
+
+type opcode byte
+
+const (
+	opConstant opcode = iota
+	opNull
+	opTrue
+	opFalse
+	opPop
+	opDup
+	opDefineGlobal
+	opGetGlobal
+	opSetGlobal
+	opGetLocal
+	opSetLocal
+	opGetUpvalue
+	opSetUpvalue
+	opCloseUpvalue
+	opGetSubscript
+	opSetSubscript
+	opGetProperty
+	opList
+	opMap
+	opTemplate
+	opUnpack
+	opAdd
+	opSubtract
+	opMultiply
+	opDivide
+	opModulo
+	opPower
+	opEqual
+	opNotEqual
+	opLess
+	opLessEqual
+	opGreater
+	opGreaterEqual
+	opNegate
+	opNot
+	opToBoolean
+	opXor
+	opJump
+	opJumpIfFalse
+	opLoop
+	opIterator
+	opNext
+	opMatch
+	opCall
+	opClosure
+	opReturn
+	opThrow
+	opTry
+	opEndTry
+	opIsKind
+	opRethrow
+	opDefer
+	opImport
+	opClass
+	opMethod
+	opSetProperty
+	opInitField
+	opStep
+)
+
+var opcodeNames = map[opcode]string{
+	opConstant:     "CONSTANT",
+	opNull:         "NULL",
+	opTrue:         "TRUE",
+	opFalse:        "FALSE",
+	opPop:          "POP",
+	opDup:          "DUP",
+	opDefineGlobal: "DEFINE_GLOBAL",
+	opGetGlobal:    "GET_GLOBAL",
+	opSetGlobal:    "SET_GLOBAL",
+	opGetLocal:     "GET_LOCAL",
+	opSetLocal:     "SET_LOCAL",
+	opGetUpvalue:   "GET_UPVALUE",
+	opSetUpvalue:   "SET_UPVALUE",
+	opCloseUpvalue: "CLOSE_UPVALUE",
+	opGetSubscript: "GET_SUBSCRIPT",
+	opSetSubscript: "SET_SUBSCRIPT",
+	opGetProperty:  "GET_PROPERTY",
+	opList:         "LIST",
+	opMap:          "MAP",
+	opTemplate:     "TEMPLATE",
+	opUnpack:       "UNPACK",
+	opAdd:          "ADD",
+	opSubtract:     "SUBTRACT",
+	opMultiply:     "MULTIPLY",
+	opDivide:       "DIVIDE",
+	opModulo:       "MODULO",
+	opPower:        "POWER",
+	opEqual:        "EQUAL",
+	opNotEqual:     "NOT_EQUAL",
+	opLess:         "LESS",
+	opLessEqual:    "LESS_EQUAL",
+	opGreater:      "GREATER",
+	opGreaterEqual: "GREATER_EQUAL",
+	opNegate:       "NEGATE",
+	opNot:          "NOT",
+	opToBoolean:    "TO_BOOLEAN",
+	opXor:          "XOR",
+	opJump:         "JUMP",
+	opJumpIfFalse:  "JUMP_IF_FALSE",
+	opLoop:         "LOOP",
+	opIterator:     "ITERATOR",
+	opNext:         "NEXT",
+	opMatch:        "MATCH",
+	opCall:         "CALL",
+	opClosure:      "CLOSURE",
+	opReturn:       "RETURN",
+	opThrow:        "THROW",
+	opTry:          "TRY",
+	opEndTry:       "END_TRY",
+	opIsKind:       "IS_KIND",
+	opRethrow:      "RETHROW",
+	opDefer:        "DEFER",
+	opImport:       "IMPORT",
+	opClass:        "CLASS",
+	opMethod:       "METHOD",
+	opSetProperty:  "SET_PROPERTY",
+	opInitField:    "INIT_FIELD",
+	opStep:         "STEP",
+}
+
+// operandCounts contains the number of 2 byte operands of every opcode.
+// The operands of opClosure depend on the number of upvalues of the function.
+var operandCounts = map[opcode]int{
+	opConstant:     1,
+	opDefineGlobal: 1,
+	opGetGlobal:    1,
+	opSetGlobal:    1,
+	opGetLocal:     1,
+	opSetLocal:     1,
+	opGetUpvalue:   1,
+	opSetUpvalue:   1,
+	opGetProperty:  1,
+	opList:         1,
+	opMap:          1,
+	opTemplate:     1,
+	opUnpack:       1,
+	opJump:         1,
+	opJumpIfFalse:  1,
+	opLoop:         1,
+	opNext:         2,
+	opMatch:        1,
+	opCall:         1,
+	opClosure:      1,
+	opReturn:       1,
+	opTry:          1,
+	opIsKind:       1,
+	opDefer:        1,
+	opImport:       1,
+	opClass:        1,
+	opMethod:       1,
+	opSetProperty:  1,
+	opInitField:    1,
+	opStep:         1,
+}
+
+type chunk struct {
+	code      []byte
+	constants []any
+	// the token of the instruction each byte belongs to, used for error messages
+	tokens []Token
+}
+
+func (c *chunk) write(b byte, token Token) {
+	c.code = append(c.code, b)
+	c.tokens = append(c.tokens, token)
+}
+
+func (c *chunk) readShort(offset int) int {
+	return int(c.code[offset])<<8 | int(c.code[offset+1])
+}
+
+// prototype is a compiled function.
+type prototype struct {
+	name             string
+	arity            int
+	returnValueCount int
+	throws           bool
+	upvalueCount     int
+	chunk            chunk
+	// the top-level code of a program or module, which doesn't count as a function call
+	script bool
+}
+
+// classPrototype describes a class, whose methods are added by opMethod.
+type classPrototype struct {
+	name   string
+	fields []string
+}
+
+func (c *classPrototype) String() string {
+	return c.name
+}
+
+type compiledModule struct {
+	module *module
+	script *prototype
+}
+
+// Bytecode is a compiled program, which can be executed with RunBytecode.
+type Bytecode struct {
+	script *prototype
+}
+
+// String returns a human readable listing of all instructions.
+func (b *Bytecode) String() string {
+	builder := &strings.Builder{}
+	disassemble(builder, b.script, make(map[*prototype]bool))
+	return strings.TrimSuffix(builder.String(), "\n")
+}
+
+func disassemble(builder *strings.Builder, proto *prototype, visited map[*prototype]bool) {
+	visited[proto] = true
+	fmt.Fprintf(builder, "== %s ==\n", proto.name)
+
+	nested := make([]*prototype, 0)
+	code := proto.chunk.code
+	for offset := 0; offset < len(code); {
+		op := opcode(code[offset])
+		token := proto.chunk.tokens[offset]
+		fmt.Fprintf(builder, "%04d %4d %-14s", offset, token.Line+1, opcodeNames[op])
+		offset++
+
+		operands := operandCounts[op]
+		for i := 0; i < operands; i++ {
+			fmt.Fprintf(builder, " %d", proto.chunk.readShort(offset))
+			offset += 2
+		}
+
+		switch op {
+		case opConstant, opDefineGlobal, opGetGlobal, opSetGlobal, opGetProperty, opSetProperty, opInitField, opMethod, opClass, opIsKind, opMatch:
+			fmt.Fprintf(builder, " (%s)", toString(proto.chunk.constants[proto.chunk.readShort(offset-2)]))
+		case opJump, opJumpIfFalse, opTry, opNext:
+			fmt.Fprintf(builder, " (-> %04d)", offset+proto.chunk.readShort(offset-2))
+		case opLoop:
+			fmt.Fprintf(builder, " (-> %04d)", offset-proto.chunk.readShort(offset-2))
+		case opImport:
+			mod := proto.chunk.constants[proto.chunk.readShort(offset-2)].(*compiledModule)
+			fmt.Fprintf(builder, " (%s)", mod.module.path)
+			nested = append(nested, mod.script)
+		case opClosure:
+			function := proto.chunk.constants[proto.chunk.readShort(offset-2)].(*prototype)
+			fmt.Fprintf(builder, " (%s)", function.name)
+			nested = append(nested, function)
+			for i := 0; i < function.upvalueCount; i++ {
+				kind := "upvalue"
+				if proto.chunk.readShort(offset) == 1 {
+					kind = "local"
+				}
+				fmt.Fprintf(builder, " [%s %d]", kind, proto.chunk.readShort(offset+2))
+				offset += 4
+			}
+		}
+		builder.WriteString("\n")
+	}
+
+	for _, n := range nested {
+		if !visited[n] {
+			builder.WriteString("\n")
+			disassemble(builder, n, visited)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package interpreter
 
-import "fmt"
+import (
+	"fmt"
+	"os"
+	"strings"
+)
 
 type variableState int
 
@@ -15,6 +19,8 @@ type nameType string
 const (
 	nameTypeVariable nameType = "variable"
 	nameTypeFunction nameType = "function"
+	nameTypeModule   nameType = "module"
+	nameTypeClass    nameType = "class"
 )
 
 type variable struct {
@@ -22,13 +28,36 @@ type variable struct {
 	name         Token
 	nameType     nameType
 	functionDecl *StmtFuncDecl
+	// set for builtin functions, whose parameters are unknown
+	native    Callable
+	module    *module
+	classDecl *StmtClass
+	// the class of the instance the variable holds, if it is known statically
+	instanceOf *StmtClass
+	// the function or loop body the variable was declared in
+	context int
+	// the index of the variable in the values of its scope at runtime, see Environment
+	slot int
+	// only set while analysing for editor tooling
+	symbol *Symbol
 }
 
 type checker struct {
-	lines  [][]rune
 	scopes []map[string]variable
+	// the last token of each scope, used to determine where symbols are visible
+	ends   []Token
 	scope  int
 	state  map[string]any
+	loader *moduleLoader
+	unused []variable
+	// errors and warnings of the last check, including the warnings of imported modules
+	diagnostics []Diagnostic
+	// records symbols and references if not nil
+	analysis *Analysis
+	// the number of function and loop bodies visited so far
+	contexts int
+	// test functions are called by the test runner and therefore always used
+	testFile bool
 }
 
 func (c *checker) copyState() map[string]any {
@@ -40,11 +69,58 @@ func (c *checker) copyState() map[string]any {
 	return oldState
 }
 
-func Check(program []Stmt, lines [][]rune) error {
+// Check analyses program and returns all errors and warnings sorted by their position.
+// Use Errors to find out whether the program can be executed.
+func Check(program []Stmt) []Diagnostic {
+	checker := newChecker(newModuleLoader())
+	checker.check(program, true)
+	return checker.diagnostics
+}
+
+// CheckTestFile is like Check but treats test functions as used.
+func CheckTestFile(program []Stmt) []Diagnostic {
+	checker := newChecker(newModuleLoader())
+	checker.testFile = true
+	checker.check(program, true)
+	return checker.diagnostics
+}
+
+// LoadFile scans, parses and checks the program in the file at path like Check or like CheckTestFile if testFile is set.
+// It returns the tokens and statements of the program with all errors and warnings found. The program must not be
+// executed if the diagnostics contain errors.
+func LoadFile(path string, testFile bool) ([]Token, []Stmt, []Diagnostic) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, Diagnostics(fmt.Errorf("Failed to open source file: %s", err))
+	}
+	tokens, err := Scan(file, path)
+	file.Close()
+	if err != nil {
+		return nil, nil, Diagnostics(err)
+	}
+
+	program, errs := Parse(tokens)
+	if len(errs) > 0 {
+		return tokens, nil, Diagnostics(errorList(errs))
+	}
+
+	if testFile {
+		return tokens, program, CheckTestFile(program)
+	}
+	return tokens, program, Check(program)
+}
+
+// IsTestFunction reports whether the test runner calls stmt.
+func IsTestFunction(stmt *StmtFuncDecl) bool {
+	return strings.HasPrefix(stmt.Name.Lexeme, "test") && len(stmt.Parameters) == 0
+}
+
+func newChecker(loader *moduleLoader) *checker {
 	checker := &checker{
-		lines:  lines,
 		scopes: make([]map[string]variable, 0),
+		ends:   make([]Token, 0),
 		scope:  -1,
+		loader: loader,
 	}
 	checker.beginScope()
 
@@ -53,42 +129,79 @@ func Check(program []Stmt, lines [][]rune) error {
 		"returnValueCount": 0,
 		"canThrow":         false,
 		"inTry":            false,
+		"inFinally":        false,
+		"context":          0,
 	}
 
 	for name, callable := range nativeFunctions {
-		checker.scopes[checker.scope][name] = variable{
-			state:    variableStateUsed,
-			nameType: nameTypeFunction,
-			functionDecl: &StmtFuncDecl{
-				Name: Token{
-					Lexeme: name,
-					Line:   -1,
-					Column: -1,
-					Type:   IDENTIFIER,
-				},
-				ReturnValueCount: callable.ArgumentCount(),
-				Throws:           callable.Throws(),
+		checker.defineNative(name, callable)
+	}
+	for name, callable := range loader.natives {
+		checker.defineNative(name, callable)
+	}
+
+	return checker
+}
+
+func (c *checker) defineNative(name string, callable Callable) {
+	c.scopes[0][name] = variable{
+		state:    variableStateUsed,
+		nameType: nameTypeFunction,
+		functionDecl: &StmtFuncDecl{
+			Name: Token{
+				Lexeme: name,
+				Line:   -1,
+				Column: -1,
+				Type:   IDENTIFIER,
 			},
-		}
+			ReturnValueCount: callable.ReturnValueCount(),
+			Throws:           callable.Throws(),
+		},
+		native: callable,
 	}
+}
 
-	for _, stmt := range program {
-		err := stmt.Accept(checker)
-		if err != nil {
-			return err
-		}
+// check analyses program and collects its errors and warnings in c.diagnostics.
+// Errors are reported where they are found and the analysis continues with the rest of the statement, e.g. the
+// remaining arguments of a call or the other branches of an if statement, so every name is still marked as used.
+// Global names are only reported as unused if warnGlobals is set, because modules export them
+// and interactive sessions might still use them later.
+func (c *checker) check(program []Stmt, warnGlobals bool) {
+	c.unused = make([]variable, 0)
+	c.diagnostics = make([]Diagnostic, 0)
+
+	c.statements(program)
+
+	if warnGlobals {
+		c.collectUnused(c.scopes[0])
+	}
+	for _, v := range c.unused {
+		c.warn(fmt.Sprintf("unused-%s", v.nameType), fmt.Sprintf("Unused %s.", v.nameType), v.name)
 	}
 
-	checker.scopes = checker.scopes[0:cap(checker.scopes)]
-	for _, scope := range checker.scopes {
-		for _, v := range scope {
-			if v.state != variableStateUsed {
-				fmt.Println(generateWarningText(fmt.Sprintf("Unused %s.", v.nameType), lines[v.name.Line], v.name.Line, v.name.Column, v.name.Column+len([]byte(v.name.Lexeme))))
-			}
-		}
+	sortDiagnostics(c.diagnostics)
+	c.diagnostics = uniqueDiagnostics(c.diagnostics)
+}
+
+// statements checks all stmts and reports their errors.
+func (c *checker) statements(stmts []Stmt) {
+	for _, stmt := range stmts {
+		c.report(stmt.Accept(c))
 	}
+}
 
-	return nil
+// report adds err to the diagnostics if it is not nil.
+func (c *checker) report(err error) {
+	c.diagnostics = append(c.diagnostics, Diagnostics(err)...)
+}
+
+func (c *checker) warn(code, message string, token Token) {
+	c.diagnostics = append(c.diagnostics, newDiagnostic(SeverityWarning, code, message, token))
+}
+
+// errors returns the errors found by the last check or nil if there are none.
+func (c *checker) errors() error {
+	return Errors(c.diagnostics)
 }
 
 func (c *checker) VisitExpression(stmt *StmtExpression) error {
@@ -97,28 +210,50 @@ func (c *checker) VisitExpression(stmt *StmtExpression) error {
 }
 
 func (c *checker) VisitVarDecl(stmt *StmtVarDecl) error {
-	for _, name := range stmt.Names {
+	symbols := make([]*Symbol, len(stmt.Names))
+	for i, name := range stmt.Names {
 		if _, ok := c.scopes[c.scope][name.Lexeme]; ok {
+			if stmt.Expr != nil {
+				// the names used by the initializer are still marked as used
+				_, err := stmt.Expr.Accept(c)
+				c.report(err)
+			}
 			return c.newError(fmt.Sprintf("'%s' is already defined in this scope", name.Lexeme), name)
 		}
-		c.scopes[c.scope][name.Lexeme] = variable{
+		symbols[i] = c.newSymbol(name, "variable", "var "+name.Lexeme)
+		c.declare(name.Lexeme, variable{
 			name:     name,
 			state:    variableStateDeclared,
 			nameType: nameTypeVariable,
-		}
+			symbol:   symbols[i],
+		})
 	}
+	var err error
 	if stmt.Expr != nil {
-		_, err := stmt.Expr.Accept(c)
-		if err != nil {
-			return err
+		var ret any
+		ret, err = stmt.Expr.Accept(c)
+		if returnValueCount, ok := ret.(int); ok && err == nil && returnValueCount != len(stmt.Names) {
+			err = c.valueCountError(returnValueCount, len(stmt.Names), stmt.Operator)
 		}
 	}
-	for _, name := range stmt.Names {
-		c.scopes[c.scope][name.Lexeme] = variable{
+	// the names are defined even if the initializer contains errors to avoid reporting every use as an error
+	for i, name := range stmt.Names {
+		c.declare(name.Lexeme, variable{
 			name:     name,
 			state:    variableStateDefined,
 			nameType: nameTypeVariable,
-		}
+			context:  c.state["context"].(int),
+			symbol:   symbols[i],
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	if call, ok := stmt.Expr.(*ExprCall); ok && len(stmt.Names) == 1 {
+		v := c.scopes[c.scope][stmt.Names[0].Lexeme]
+		v.instanceOf = c.classDeclOf(call.Callee)
+		c.scopes[c.scope][stmt.Names[0].Lexeme] = v
 	}
 
 	return nil
@@ -126,106 +261,195 @@ func (c *checker) VisitVarDecl(stmt *StmtVarDecl) error {
 
 func (c *checker) VisitFuncDecl(stmt *StmtFuncDecl) error {
 	if _, ok := c.scopes[c.scope][stmt.Name.Lexeme]; ok {
+		// the body is still checked, but the function isn't declared again
+		c.report(c.function(stmt.Parameters, stmt.Body, stmt.ReturnValueCount, stmt.Throws))
 		return c.newError(fmt.Sprintf("'%s' is already defined in this scope", stmt.Name.Lexeme), stmt.Name)
 	}
 
 	state := variableStateDefined
-	if c.scope == 0 && stmt.Name.Lexeme == "main" {
+	if c.scope == 0 && (stmt.Name.Lexeme == "main" || c.testFile && IsTestFunction(stmt)) {
 		state = variableStateUsed
 	}
 
-	c.scopes[c.scope][stmt.Name.Lexeme] = variable{
+	c.declare(stmt.Name.Lexeme, variable{
 		name:         stmt.Name,
 		state:        state,
 		nameType:     nameTypeFunction,
 		functionDecl: stmt,
+		symbol:       c.newSymbol(stmt.Name, "function", signature(stmt.Name.Lexeme, stmt.Parameters, stmt.ReturnValueCount, stmt.Throws)),
+	})
+
+	return c.function(stmt.Parameters, stmt.Body, stmt.ReturnValueCount, stmt.Throws)
+}
+
+func (c *checker) VisitClass(stmt *StmtClass) error {
+	_, defined := c.scopes[c.scope][stmt.Name.Lexeme]
+	if defined {
+		// the members are still checked, but the class isn't declared again
+		c.report(c.newError(fmt.Sprintf("'%s' is already defined in this scope", stmt.Name.Lexeme), stmt.Name))
 	}
 
-	c.beginScope()
-	defer c.endScope()
-	for _, p := range stmt.Parameters {
-		c.scopes[c.scope][p] = variable{
-			state:    variableStateUsed,
-			nameType: nameTypeVariable,
+	members := make(map[string]bool)
+	for _, field := range stmt.Fields {
+		for _, name := range field.Names {
+			if members[name.Lexeme] {
+				c.report(c.newError(fmt.Sprintf("'%s' is already defined in this class.", name.Lexeme), name))
+			}
+			members[name.Lexeme] = true
+		}
+	}
+	for _, method := range stmt.Methods {
+		if members[method.Name.Lexeme] {
+			c.report(c.newError(fmt.Sprintf("'%s' is already defined in this class.", method.Name.Lexeme), method.Name))
+		}
+		members[method.Name.Lexeme] = true
+		if method.Name.Lexeme == "init" && method.ReturnValueCount != 0 {
+			c.report(c.newError("The constructor cannot return values.", method.Name))
 		}
 	}
 
-	oldState := c.copyState()
-	c.state["inLoop"] = false
-	c.state["returnValueCount"] = stmt.ReturnValueCount
-	c.state["canThrow"] = stmt.Throws
+	if !defined {
+		c.declare(stmt.Name.Lexeme, variable{
+			name:      stmt.Name,
+			state:     variableStateDefined,
+			nameType:  nameTypeClass,
+			classDecl: stmt,
+			symbol:    c.newSymbol(stmt.Name, "class", "class "+stmt.Name.Lexeme),
+		})
+		c.newMemberSymbols(stmt)
+	}
 
-	err := stmt.Body.Accept(c)
+	c.beginScope()
+	defer c.endScope()
+	c.declare("this", variable{
+		state:      variableStateUsed,
+		nameType:   nameTypeVariable,
+		instanceOf: stmt,
+	})
 
+	// field initializers are executed by the constructor
+	oldState := c.copyState()
+	c.state["inLoop"] = false
+	c.state["inTry"] = false
+	c.state["canThrow"] = false
+	if constructor := classMethod(stmt, "init"); constructor != nil {
+		c.state["canThrow"] = constructor.Throws
+	}
+	c.contexts++
+	c.state["context"] = c.contexts
+	for _, field := range stmt.Fields {
+		if field.Expr != nil {
+			_, err := field.Expr.Accept(c)
+			c.report(err)
+		}
+	}
 	c.state = oldState
 
-	return err
+	for _, method := range stmt.Methods {
+		c.report(c.function(method.Parameters, method.Body, method.ReturnValueCount, method.Throws))
+	}
+	return nil
 }
 
 func (c *checker) VisitIf(stmt *StmtIf) error {
-	_, err := stmt.Condition.Accept(c)
-	if err != nil {
-		return err
-	}
-
-	err = stmt.Body.Accept(c)
-	if err != nil {
-		return err
-	}
+	c.report(c.operand(stmt.Condition, stmt.Keyword))
 
+	c.report(stmt.Body.Accept(c))
 	if stmt.ElseBody != nil {
-		err = stmt.ElseBody.Accept(c)
-		if err != nil {
-			return err
-		}
+		c.report(stmt.ElseBody.Accept(c))
 	}
 	return nil
 }
 
 func (c *checker) VisitWhile(stmt *StmtWhile) error {
-	_, err := stmt.Condition.Accept(c)
-	if err != nil {
-		return err
-	}
+	oldState := c.copyState()
+	defer func() { c.state = oldState }()
+	// the condition is also executed after the body
+	c.contexts++
+	c.state["context"] = c.contexts
+
+	c.report(c.operand(stmt.Condition, stmt.Keyword))
+
+	c.state["inLoop"] = true
+	return stmt.Body.Accept(c)
+}
+
+func (c *checker) VisitFor(stmt *StmtFor) error {
+	c.report(stmt.Initializer.Accept(c))
 
 	oldState := c.copyState()
+	defer func() { c.state = oldState }()
+	// the increment and condition are also executed after the body
+	c.contexts++
+	c.state["context"] = c.contexts
+
+	_, err := stmt.Increment.Accept(c)
+	c.report(err)
+	c.report(c.operand(stmt.Condition, stmt.Keyword))
+
 	c.state["inLoop"] = true
-	err = stmt.Body.Accept(c)
-	c.state = oldState
-	if err != nil {
-		return err
+	return stmt.Body.Accept(c)
+}
+
+func (c *checker) VisitForEach(stmt *StmtForEach) error {
+	c.report(c.operand(stmt.Collection, stmt.In))
+
+	c.beginScope()
+	defer c.endScope()
+	c.setScopeEnd(stmt.Body)
+
+	for _, name := range []Token{stmt.Index, stmt.Element} {
+		if name.Lexeme == "" {
+			continue
+		}
+		c.report(c.defineVariable(name))
 	}
 
-	return nil
+	oldState := c.copyState()
+	defer func() { c.state = oldState }()
+	c.state["inLoop"] = true
+	return stmt.Body.Accept(c)
 }
 
-func (c *checker) VisitFor(stmt *StmtFor) error {
-	err := stmt.Initializer.Accept(c)
-	if err != nil {
-		return err
-	}
-	_, err = stmt.Increment.Accept(c)
-	if err != nil {
-		return err
+func (c *checker) VisitMatch(stmt *StmtMatch) error {
+	c.report(c.operand(stmt.Value, stmt.Keyword))
+
+	unreachable := false
+	for _, matchCase := range stmt.Cases {
+		if unreachable {
+			c.warn(CodeUnreachableCase, "Unreachable case.", matchCase.Keyword)
+		}
+		c.report(c.matchCase(matchCase))
+		unreachable = unreachable || matchCase.matchesEverything()
 	}
-	_, err = stmt.Condition.Accept(c)
-	if err != nil {
-		return err
+	return nil
+}
+
+func (c *checker) matchCase(matchCase MatchCase) error {
+	bindings := patternBindings(matchCase.Patterns)
+	if len(matchCase.Patterns) > 1 && len(bindings) > 0 {
+		c.report(c.newError("Cannot bind names in a case with multiple patterns.", bindings[0]))
 	}
 
-	oldState := c.copyState()
-	c.state["inLoop"] = true
-	err = stmt.Body.Accept(c)
-	c.state = oldState
-	if err != nil {
-		return err
+	c.beginScope()
+	defer c.endScope()
+	c.setScopeEnd(matchCase.Body)
+
+	for _, name := range bindings {
+		c.report(c.defineVariable(name))
 	}
 
-	return nil
+	if matchCase.Guard != nil {
+		c.report(c.operand(matchCase.Guard, matchCase.Keyword))
+	}
+	return matchCase.Body.Accept(c)
 }
 
 func (c *checker) VisitLoopControl(stmt *StmtLoopControl) error {
 	if !c.state["inLoop"].(bool) {
+		if c.state["inFinally"].(bool) {
+			return c.newError(fmt.Sprintf("Cannot use '%s' to leave a finally block.", stmt.Keyword.Lexeme), stmt.Keyword)
+		}
 		switch stmt.Keyword.Type {
 		case BREAK:
 			return c.newError("'break' statement outside of loop.", stmt.Keyword)
@@ -237,67 +461,139 @@ func (c *checker) VisitLoopControl(stmt *StmtLoopControl) error {
 }
 
 func (c *checker) VisitReturn(stmt *StmtReturn) error {
+	if c.state["inFinally"].(bool) {
+		c.report(c.newError("Cannot return from a finally block.", stmt.Keyword))
+	}
 	if len(stmt.Values) != c.state["returnValueCount"].(int) {
-		return c.newError(fmt.Sprintf("Wrong return value count. Expected %d, got %d.", c.state["returnValueCount"].(int), len(stmt.Values)), stmt.Keyword)
+		c.report(c.newError(fmt.Sprintf("Wrong return value count. Expected %d, got %d.", c.state["returnValueCount"].(int), len(stmt.Values)), stmt.Keyword))
 	}
+	// every value must be a single value, even if a call returns the expected number of values
 	for _, v := range stmt.Values {
-		_, err := v.Accept(c)
-		if err != nil {
-			return err
-		}
+		c.report(c.operand(v, stmt.Keyword))
 	}
 	return nil
 }
 
 func (c *checker) VisitThrow(stmt *StmtThrow) error {
 	if !c.state["canThrow"].(bool) {
-		return c.newError("Cannot throw exception in non-throwing function. Append 'throws' to the function signature.", stmt.Keyword)
+		c.report(c.newError("Cannot throw exception in non-throwing function. Append 'throws' to the function signature.", stmt.Keyword))
 	}
-	return nil
+	_, err := stmt.Value.Accept(c)
+	return err
 }
 
 func (c *checker) VisitTry(stmt *StmtTry) error {
+	catchesAll := false
+	for _, clause := range stmt.Catches {
+		if clause.Kind.Lexeme == "" {
+			catchesAll = true
+		}
+	}
+
 	oldState := c.copyState()
-	c.state["inTry"] = true
-	err := stmt.Body.Accept(c)
+	if catchesAll {
+		c.state["inTry"] = true
+	}
+	c.report(stmt.Body.Accept(c))
 	c.state = oldState
-	if err != nil {
-		return err
+
+	for index, clause := range stmt.Catches {
+		if index > 0 && stmt.Catches[index-1].Kind.Lexeme == "" {
+			c.report(c.newError("Unreachable catch clause.", clause.Keyword))
+		}
+		c.report(c.catchClause(clause))
+	}
+
+	if stmt.Finally != nil {
+		oldState := c.copyState()
+		c.state["inLoop"] = false
+		c.state["inFinally"] = true
+		c.report(stmt.Finally.Accept(c))
+		c.state = oldState
+	}
+	return nil
+}
+
+func (c *checker) VisitDefer(stmt *StmtDefer) error {
+	// the deferred call is executed when the function returns, outside of any try statement
+	oldState := c.copyState()
+	c.state["inTry"] = false
+	_, err := stmt.Call.Accept(c)
+	c.state = oldState
+	return err
+}
+
+func (c *checker) catchClause(clause CatchClause) error {
+	if clause.Kind.Lexeme != "" && !errorKinds[clause.Kind.Lexeme] {
+		scope := c.findVariable(clause.Kind.Lexeme)
+		if scope < 0 || c.scopes[scope][clause.Kind.Lexeme].nameType != nameTypeClass {
+			c.report(c.newError(fmt.Sprintf("Unknown error kind '%s'.", clause.Kind.Lexeme), clause.Kind))
+		} else {
+			v := c.scopes[scope][clause.Kind.Lexeme]
+			v.state = variableStateUsed
+			c.scopes[scope][clause.Kind.Lexeme] = v
+			c.reference(clause.Kind, v.symbol)
+		}
 	}
 
 	c.beginScope()
 	defer c.endScope()
+	c.setScopeEnd(clause.Body)
 
-	if stmt.ExceptionName.Lexeme != "" {
-		c.scopes[c.scope][stmt.ExceptionName.Lexeme] = variable{
-			name:     stmt.ExceptionName,
+	if clause.Name.Lexeme != "" {
+		c.declare(clause.Name.Lexeme, variable{
+			name:     clause.Name,
 			state:    variableStateDeclared,
 			nameType: nameTypeVariable,
-		}
+			symbol:   c.newSymbol(clause.Name, "variable", "var "+clause.Name.Lexeme),
+		})
 	}
 
-	err = stmt.CatchBody.Accept(c)
-	if err != nil {
-		return err
+	return clause.Body.Accept(c)
+}
+
+func (c *checker) VisitImport(stmt *StmtImport) error {
+	if _, ok := c.scopes[c.scope][stmt.Namespace.Lexeme]; ok {
+		return c.newError(fmt.Sprintf("'%s' is already defined in this scope", stmt.Namespace.Lexeme), stmt.Namespace)
 	}
 
-	return nil
+	mod, err := c.loadModule(stmt)
+	path := stmt.Path.Literal.(string)
+	if err == nil {
+		stmt.Module = mod
+		path = mod.path
+	} else {
+		mod = nil
+	}
+
+	// the namespace is declared even if the module can't be loaded to avoid reporting every use as an error
+	c.declare(stmt.Namespace.Lexeme, variable{
+		name:     stmt.Namespace,
+		state:    variableStateDefined,
+		nameType: nameTypeModule,
+		module:   mod,
+		symbol:   c.newSymbol(stmt.Namespace, "module", fmt.Sprintf("import \"%s\" as %s", path, stmt.Namespace.Lexeme)),
+	})
+	return err
 }
 
 func (c *checker) VisitBlock(stmt *StmtBlock) error {
 	c.beginScope()
 	defer c.endScope()
-	for _, s := range stmt.Statements {
-		err := s.Accept(c)
-		if err != nil {
-			return err
-		}
-	}
+	c.setScopeEnd(stmt)
+	c.statements(stmt.Statements)
 	return nil
 }
 
 func (c *checker) VisitLiteral(expr *ExprLiteral) (any, error) {
-	return nil, nil
+	return 1, nil
+}
+
+func (c *checker) VisitTemplate(expr *ExprTemplate) (any, error) {
+	for _, part := range expr.Parts {
+		c.report(c.operand(part, expr.Start))
+	}
+	return 1, nil
 }
 
 func (c *checker) VisitVariable(expr *ExprVariable) (any, error) {
@@ -308,53 +604,118 @@ func (c *checker) VisitVariable(expr *ExprVariable) (any, error) {
 	expr.NestingLevel = scope
 
 	v := c.scopes[scope][expr.Name.Lexeme]
-	c.scopes[scope][expr.Name.Lexeme] = variable{
-		name:     v.name,
-		nameType: v.nameType,
-		state:    variableStateUsed,
-	}
+	expr.Slot = v.slot
+	v.state = variableStateUsed
+	c.scopes[scope][expr.Name.Lexeme] = v
+	c.reference(expr.Name, v.symbol)
 
-	return nil, nil
+	return 1, nil
 }
 
 func (c *checker) VisitCall(expr *ExprCall) (any, error) {
 	var returnValueCount any
+	var callee variable
+	var calleeName Token
 	if v, ok := expr.Callee.(*ExprVariable); ok {
-		scope := c.findVariable(v.Name.Lexeme)
-		if scope < 0 {
-			return nil, c.newError("Undefined name.", v.Name)
+		// an undefined callee is reported when it is checked below
+		if scope := c.findVariable(v.Name.Lexeme); scope >= 0 {
+			callee = c.scopes[scope][v.Name.Lexeme]
+			calleeName = v.Name
 		}
-		variable := c.scopes[scope][v.Name.Lexeme]
+	} else if p, ok := expr.Callee.(*ExprProperty); ok {
+		if mod := c.moduleOf(p.Object); mod != nil {
+			callee = mod.exports[p.Name.Lexeme]
+			calleeName = p.Name
+		} else if class := c.classOf(p.Object); class != nil {
+			if method := classMethod(class, p.Name.Lexeme); method != nil {
+				callee = variable{
+					nameType:     nameTypeFunction,
+					functionDecl: method,
+				}
+				calleeName = p.Name
+			}
+		}
+	}
 
-		if variable.nameType == nameTypeFunction && variable.functionDecl != nil {
-			if variable.functionDecl.Throws && !c.state["canThrow"].(bool) && !c.state["inTry"].(bool) {
-				return nil, c.newError("Calling throwing function in a non-throwing function outside of a try block.", v.Name)
+	if callee.nameType == nameTypeClass {
+		if constructor := classMethod(callee.classDecl, "init"); constructor != nil {
+			callee = variable{
+				nameType: nameTypeFunction,
+				functionDecl: &StmtFuncDecl{
+					Parameters:       constructor.Parameters,
+					ReturnValueCount: 1,
+					Throws:           constructor.Throws,
+				},
+			}
+		} else {
+			if len(expr.Args) != 0 {
+				c.report(c.newError(fmt.Sprintf("Wrong argument count. Expected 0, got %d.", len(expr.Args)), expr.OpenParen))
 			}
-			returnValueCount = variable.functionDecl.ReturnValueCount
+			returnValueCount = 1
 		}
 	}
 
-	_, err := expr.Callee.Accept(c)
-	if err != nil {
-		return nil, err
+	if callee.nameType == nameTypeFunction && callee.functionDecl != nil {
+		if callee.functionDecl.Throws && !c.state["canThrow"].(bool) && !c.state["inTry"].(bool) {
+			c.report(c.newError("Calling throwing function in a non-throwing function outside of a try block.", calleeName))
+		}
+		argumentCount := len(callee.functionDecl.Parameters)
+		if callee.native != nil {
+			argumentCount = callee.native.ArgumentCount()
+		}
+		if argumentCount != -1 && argumentCount != len(expr.Args) {
+			c.report(c.newError(fmt.Sprintf("Wrong argument count. Expected %d, got %d.", argumentCount, len(expr.Args)), expr.OpenParen))
+		}
+		returnValueCount = callee.functionDecl.ReturnValueCount
 	}
 
+	c.report(c.operand(expr.Callee, expr.OpenParen))
 	for _, a := range expr.Args {
-		_, err = a.Accept(c)
-		if err != nil {
-			return nil, err
-		}
+		c.report(c.operand(a, expr.OpenParen))
 	}
 
 	return returnValueCount, nil
 }
 
 func (c *checker) VisitSubscript(expr *ExprSubscript) (any, error) {
+	c.report(c.operand(expr.Object, expr.OpenBracket))
+	return 1, c.operand(expr.Subscript, expr.OpenBracket)
+}
+
+func (c *checker) VisitProperty(expr *ExprProperty) (any, error) {
 	_, err := expr.Object.Accept(c)
-	if err != nil {
-		return nil, err
+	c.report(err)
+
+	if mod := c.moduleOf(expr.Object); mod != nil {
+		member, ok := mod.exports[expr.Name.Lexeme]
+		if !ok {
+			return nil, c.newError(fmt.Sprintf("Module '%s' has no member '%s'.", mod.path, expr.Name.Lexeme), expr.Name)
+		}
+		c.reference(expr.Name, member.symbol)
+	}
+
+	if class := c.classDeclOf(expr.Object); class != nil {
+		return nil, c.newError(fmt.Sprintf("Cannot access members of class '%s' without an instance.", class.Name.Lexeme), expr.Name)
+	}
+
+	if class := c.classOf(expr.Object); class != nil {
+		if !classHasField(class, expr.Name.Lexeme) && classMethod(class, expr.Name.Lexeme) == nil {
+			return nil, c.newError(fmt.Sprintf("Class '%s' has no field or method '%s'.", class.Name.Lexeme, expr.Name.Lexeme), expr.Name)
+		}
+		c.referenceMember(class, expr.Name)
+	}
+
+	return 1, nil
+}
+
+func (c *checker) VisitThis(expr *ExprThis) (any, error) {
+	scope := c.findVariable("this")
+	if scope < 0 {
+		return nil, c.newError("Cannot use 'this' outside of a method.", expr.Keyword)
 	}
-	return expr.Subscript.Accept(c)
+	expr.NestingLevel = scope
+	expr.Slot = c.scopes[scope]["this"].slot
+	return 1, nil
 }
 
 func (c *checker) VisitGrouping(expr *ExprGrouping) (any, error) {
@@ -363,91 +724,203 @@ func (c *checker) VisitGrouping(expr *ExprGrouping) (any, error) {
 
 func (c *checker) VisitList(list *ExprList) (any, error) {
 	for _, v := range list.Values {
-		_, err := v.Accept(c)
-		if err != nil {
-			return nil, err
-		}
+		c.report(c.operand(v, list.OpenBracket))
 	}
-	return nil, nil
+	return 1, nil
+}
+
+func (c *checker) VisitMap(expr *ExprMap) (any, error) {
+	for index, k := range expr.Keys {
+		c.report(c.operand(k, expr.OpenBrace))
+		c.report(c.operand(expr.Values[index], expr.OpenBrace))
+	}
+	return 1, nil
 }
 
 func (c *checker) VisitUnary(expr *ExprUnary) (any, error) {
-	return expr.Right.Accept(c)
+	return 1, c.operand(expr.Right, expr.Operator)
 }
 
 func (c *checker) VisitBinary(expr *ExprBinary) (any, error) {
-	_, err := expr.Left.Accept(c)
-	if err != nil {
-		return nil, err
-	}
-	return expr.Right.Accept(c)
+	c.report(c.operand(expr.Left, expr.Operator))
+	return 1, c.operand(expr.Right, expr.Operator)
 }
 
 func (c *checker) VisitLogical(expr *ExprLogical) (any, error) {
-	_, err := expr.Left.Accept(c)
-	if err != nil {
-		return nil, err
-	}
-	return expr.Right.Accept(c)
+	c.report(c.operand(expr.Left, expr.Operator))
+	return 1, c.operand(expr.Right, expr.Operator)
 }
 
-func (c *checker) VisitTernary(expr *ExprTernary) (any, error) {
-	_, err := expr.Left.Accept(c)
+// operand checks an operand of operator, which must not be a call returning multiple values.
+func (c *checker) operand(expr Expr, operator Token) error {
+	ret, err := expr.Accept(c)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	_, err = expr.Center.Accept(c)
-	if err != nil {
-		return nil, err
+	if returnValueCount, ok := ret.(int); ok && returnValueCount > 1 {
+		location, ok := exprLocation(expr)
+		if !ok {
+			location = operator
+		}
+		return c.newError(fmt.Sprintf("Multiple values where a single value was expected. The call returns %d values.", returnValueCount), location)
 	}
-	return expr.Right.Accept(c)
+	return nil
+}
+
+func (c *checker) VisitTernary(expr *ExprTernary) (any, error) {
+	c.report(c.operand(expr.Left, expr.Operator1))
+	c.report(c.operand(expr.Center, expr.Operator1))
+	return 1, c.operand(expr.Right, expr.Operator2)
 }
 
 func (c *checker) VisitAssign(assign *ExprAssign) (any, error) {
 	for _, assignee := range assign.Assignees {
-		ret, err := assignee.Accept(c)
+		if property, ok := assignee.(*ExprProperty); ok {
+			c.report(c.checkPropertyAssignment(property))
+			continue
+		}
+
+		_, err := assignee.Accept(c)
 		if err != nil {
-			return nil, err
+			c.report(err)
+			continue
 		}
-		if returnValueCount, ok := ret.(int); ok {
-			if returnValueCount != len(assign.Assignees) {
-				return nil, c.newError(fmt.Sprintf("Cannot assign %d values to %d variables.", returnValueCount, assign.Assignees), assign.Operator)
-			}
+
+		if v, ok := assignee.(*ExprVariable); ok {
+			// the variable might hold an instance of a different class from now on
+			variable := c.scopes[v.NestingLevel][v.Name.Lexeme]
+			variable.instanceOf = nil
+			c.scopes[v.NestingLevel][v.Name.Lexeme] = variable
+		}
+	}
+
+	ret, err := assign.Expr.Accept(c)
+	c.report(err)
+	if returnValueCount, ok := ret.(int); ok && returnValueCount != len(assign.Assignees) {
+		return nil, c.valueCountError(returnValueCount, len(assign.Assignees), assign.Operator)
+	}
+	// the assigned values are the value of the expression
+	return ret, nil
+}
+
+// valueCountError reports that the number of assigned values doesn't match the number of variables.
+func (c *checker) valueCountError(values, variables int, operator Token) error {
+	return c.newError(fmt.Sprintf("Cannot assign %d values to %d variables.", values, variables), operator)
+}
+
+func (c *checker) checkPropertyAssignment(property *ExprProperty) error {
+	_, err := property.Object.Accept(c)
+	c.report(err)
+
+	if c.moduleOf(property.Object) != nil {
+		return c.newError("Cannot assign to members of modules.", property.Name)
+	}
+
+	if class := c.classDeclOf(property.Object); class != nil {
+		return c.newError(fmt.Sprintf("Cannot access members of class '%s' without an instance.", class.Name.Lexeme), property.Name)
+	}
+
+	if class := c.classOf(property.Object); class != nil {
+		if classMethod(class, property.Name.Lexeme) != nil {
+			return c.newError(fmt.Sprintf("Cannot assign to method '%s'.", property.Name.Lexeme), property.Name)
 		}
+		if !classHasField(class, property.Name.Lexeme) {
+			return c.newError(fmt.Sprintf("Class '%s' has no field '%s'.", class.Name.Lexeme, property.Name.Lexeme), property.Name)
+		}
+		c.referenceMember(class, property.Name)
 	}
-	return assign.Expr.Accept(c)
+	return nil
 }
 
 func (c *checker) VisitAnonymousFunction(expr *ExprAnonymousFunction) (any, error) {
+	return 1, c.function(expr.Parameters, expr.Body, expr.ReturnValueCount, expr.Throws)
+}
+
+func (c *checker) function(parameters []Token, body Stmt, returnValueCount int, throws bool) error {
 	c.beginScope()
 	defer c.endScope()
-	for _, p := range expr.Parameters {
-		c.scopes[c.scope][p] = variable{
+	c.setScopeEnd(body)
+	for _, p := range parameters {
+		c.declare(p.Lexeme, variable{
+			name:     p,
 			state:    variableStateUsed,
 			nameType: nameTypeVariable,
-		}
+			symbol:   c.newSymbol(p, "parameter", "var "+p.Lexeme),
+		})
 	}
 
 	oldState := c.copyState()
 	c.state["inLoop"] = false
-	c.state["returnValueCount"] = expr.ReturnValueCount
-	c.state["canThrow"] = expr.Throws
+	c.state["returnValueCount"] = returnValueCount
+	c.state["canThrow"] = throws
+	c.state["inFinally"] = false
+	c.contexts++
+	c.state["context"] = c.contexts
 
-	err := expr.Body.Accept(c)
+	err := body.Accept(c)
 
 	c.state = oldState
 
-	return nil, err
+	return err
 }
 
 func (c *checker) beginScope() {
+	end := Token{Line: -1}
+	if c.scope >= 0 {
+		end = c.ends[c.scope]
+	}
 	c.scopes = append(c.scopes, make(map[string]variable))
+	c.ends = append(c.ends, end)
 	c.scope++
 }
 
+// setScopeEnd sets the end of the current scope to the end of body.
+func (c *checker) setScopeEnd(body Stmt) {
+	if block, ok := body.(*StmtBlock); ok {
+		c.ends[c.scope] = block.CloseBrace
+	}
+}
+
+// declare stores v as name in the current scope. A new name gets the next slot of the scope,
+// a name which is declared again, e.g. after its initializer has been checked, keeps its slot.
+func (c *checker) declare(name string, v variable) {
+	scope := c.scopes[c.scope]
+	if old, ok := scope[name]; ok {
+		v.slot = old.slot
+	} else {
+		v.slot = len(scope)
+	}
+	scope[name] = v
+}
+
 func (c *checker) endScope() {
+	c.collectUnused(c.scopes[c.scope])
 	c.scope--
 	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.ends = c.ends[:len(c.ends)-1]
+}
+
+func (c *checker) collectUnused(scope map[string]variable) {
+	for _, v := range scope {
+		if v.state != variableStateUsed {
+			c.unused = append(c.unused, v)
+		}
+	}
+}
+
+// defineVariable defines a variable with the value known at declaration time in the current scope.
+func (c *checker) defineVariable(name Token) error {
+	if _, ok := c.scopes[c.scope][name.Lexeme]; ok {
+		return c.newError(fmt.Sprintf("'%s' is already defined in this scope", name.Lexeme), name)
+	}
+	c.declare(name.Lexeme, variable{
+		name:     name,
+		state:    variableStateDefined,
+		nameType: nameTypeVariable,
+		context:  c.state["context"].(int),
+		symbol:   c.newSymbol(name, "variable", "var "+name.Lexeme),
+	})
+	return nil
 }
 
 func (c *checker) findVariable(name string) int {
@@ -461,10 +934,88 @@ func (c *checker) findVariable(name string) int {
 	return scope
 }
 
-func (c *checker) newError(message string, token Token) error {
-	return ParseError{
-		Token:   token,
-		Message: message,
-		Line:    c.lines[token.Line],
+// moduleOf returns the module expr refers to, if it is known statically.
+func (c *checker) moduleOf(expr Expr) *module {
+	switch e := expr.(type) {
+	case *ExprVariable:
+		scope := c.findVariable(e.Name.Lexeme)
+		if scope < 0 {
+			return nil
+		}
+		return c.scopes[scope][e.Name.Lexeme].module
+	case *ExprProperty:
+		if mod := c.moduleOf(e.Object); mod != nil {
+			return mod.exports[e.Name.Lexeme].module
+		}
+	}
+	return nil
+}
+
+// classDeclOf returns the class expr refers to, if it is known statically.
+func (c *checker) classDeclOf(expr Expr) *StmtClass {
+	switch e := expr.(type) {
+	case *ExprVariable:
+		scope := c.findVariable(e.Name.Lexeme)
+		if scope < 0 {
+			return nil
+		}
+		return c.scopes[scope][e.Name.Lexeme].classDecl
+	case *ExprProperty:
+		if mod := c.moduleOf(e.Object); mod != nil {
+			return mod.exports[e.Name.Lexeme].classDecl
+		}
+	}
+	return nil
+}
+
+// classOf returns the class of the instance expr evaluates to, if it is known statically.
+func (c *checker) classOf(expr Expr) *StmtClass {
+	switch e := expr.(type) {
+	case *ExprThis:
+		scope := c.findVariable("this")
+		if scope < 0 {
+			return nil
+		}
+		return c.scopes[scope]["this"].instanceOf
+	case *ExprVariable:
+		scope := c.findVariable(e.Name.Lexeme)
+		if scope < 0 {
+			return nil
+		}
+		// the variable could be reassigned later in the same loop or from a function, which is executed in between
+		v := c.scopes[scope][e.Name.Lexeme]
+		if v.context != c.state["context"].(int) {
+			return nil
+		}
+		return v.instanceOf
+	case *ExprCall:
+		return c.classDeclOf(e.Callee)
+	case *ExprGrouping:
+		return c.classOf(e.Expr)
+	}
+	return nil
+}
+
+func classMethod(class *StmtClass, name string) *StmtFuncDecl {
+	for _, method := range class.Methods {
+		if method.Name.Lexeme == name {
+			return method
+		}
 	}
+	return nil
+}
+
+func classHasField(class *StmtClass, name string) bool {
+	for _, field := range class.Fields {
+		for _, n := range field.Names {
+			if n.Lexeme == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *checker) newError(message string, token Token) error {
+	return newDiagnostic(SeverityError, CodeCheckError, message, token)
 }
@@ -0,0 +1,147 @@
+package interpreter_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Bananenpro/crab/interpreter"
+)
+
+// diagnostics analyses source and returns its diagnostics as "line:column severity message" with 1-based positions.
+func diagnostics(t *testing.T, source string) []string {
+	t.Helper()
+	analysis := interpreter.Analyze(strings.NewReader(source), "test.cb")
+	result := make([]string, len(analysis.Diagnostics))
+	for index, d := range analysis.Diagnostics {
+		result[index] = fmt.Sprintf("%d:%d %s %s", d.Line+1, d.Column+1, d.Severity, d.Message)
+	}
+	return result
+}
+
+func TestCheckerContinuesAfterErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   []string
+	}{
+		{
+			name: "call arguments",
+			source: `
+func main() {
+	println(u1, u2);
+}
+`,
+			want: []string{"3:10 error Undefined name.", "3:14 error Undefined name."},
+		},
+		{
+			name: "if and else branches",
+			source: `
+func main() {
+	if (u3) { println(u4); } else { println(u5); }
+}
+`,
+			want: []string{"3:6 error Undefined name.", "3:20 error Undefined name.", "3:42 error Undefined name."},
+		},
+		{
+			name: "match cases",
+			source: `
+func main() {
+	match (1) {
+		case 1: { println(u6); }
+		case 2: { println(u7); }
+	}
+}
+`,
+			want: []string{"4:21 error Undefined name.", "5:21 error Undefined name."},
+		},
+		{
+			name: "names used next to errors",
+			source: `
+import "missing.cb" as m;
+
+func main() {
+	var x = 1;
+	println(undefinedName, x);
+	var y = m.f() + u8;
+	println(y);
+	var unused = 2;
+}
+`,
+			want: []string{
+				"2:8 error Failed to open 'missing.cb'.",
+				"6:10 error Undefined name.",
+				"7:18 error Undefined name.",
+				"9:6 warning Unused variable.",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := diagnostics(t, test.source); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckerValueCounts(t *testing.T) {
+	const multiple = "error Multiple values where a single value was expected. The call returns 2 values."
+	tests := []struct {
+		name string
+		code string
+		want []string
+	}{
+		{name: "argument", code: "println(id(two()));", want: []string{"11:13 " + multiple}},
+		{name: "list element", code: "println([two()]);", want: []string{"11:11 " + multiple}},
+		{name: "map key", code: "println({two(): 1});", want: []string{"11:11 " + multiple}},
+		{name: "ternary branch", code: "var x = true ? two() : 1;", want: []string{"11:6 warning Unused variable.", "11:17 " + multiple}},
+		{name: "condition", code: "if (two()) {}", want: []string{"11:6 " + multiple}},
+		{name: "template", code: `println("${two()}");`, want: []string{"11:13 " + multiple}},
+		{name: "one value to two variables", code: "var c, d = 1;\n\tprintln(c, d);", want: []string{"11:11 error Cannot assign 1 values to 2 variables."}},
+		{name: "two values to two variables", code: "var c, d = two();\n\tprintln(c, d);", want: []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source := `
+func two() 2 {
+	return 1, 2;
+}
+func id(x) 1 {
+	return x;
+}
+func main() {
+	var a, b = two();
+	println(id(a), b);
+	` + test.code + `
+}
+`
+			if got := diagnostics(t, source); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckerReturnValueCounts(t *testing.T) {
+	got := diagnostics(t, `
+func two() 2 {
+	return 1, 2;
+}
+
+func one() 1 {
+	return two();
+}
+
+func main() {
+	println(one());
+}
+`)
+	want := []string{"7:9 error Multiple values where a single value was expected. The call returns 2 values."}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,155 @@
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+)
+
+type class struct {
+	name string
+	// field names in declaration order
+	fields  []string
+	methods map[string]Callable
+	// nil if the class has no 'init' method
+	constructor Callable
+
+	// used by the tree-walking interpreter to initialize the fields of new instances
+	fieldDecls []*StmtVarDecl
+	closure    *Environment
+}
+
+func (c *class) Throws() bool {
+	if c.constructor == nil {
+		return false
+	}
+	return c.constructor.Throws()
+}
+
+func (c *class) ArgumentCount() int {
+	if c.constructor == nil {
+		return 0
+	}
+	return c.constructor.ArgumentCount()
+}
+
+func (c *class) ReturnValueCount() int {
+	return 1
+}
+
+func (c *class) Call(i *Interpreter, args []any) (any, error) {
+	if i.vm != nil {
+		return i.vm.call(c, args, Token{Line: -1})
+	}
+	return i.instantiate(c, args)
+}
+
+func (c *class) String() string {
+	return fmt.Sprintf("<class %s>", c.name)
+}
+
+type instance struct {
+	class  *class
+	fields map[string]any
+	// set while the instance is converted to a string to detect cycles
+	printing bool
+}
+
+func newInstance(c *class) *instance {
+	fields := make(map[string]any, len(c.fields))
+	for _, name := range c.fields {
+		fields[name] = nil
+	}
+	return &instance{
+		class:  c,
+		fields: fields,
+	}
+}
+
+func (in *instance) String() string {
+	if in.printing {
+		return in.class.name + "{...}"
+	}
+	in.printing = true
+	defer func() { in.printing = false }()
+
+	text := in.class.name + "{"
+	for _, name := range in.class.fields {
+		text = fmt.Sprintf("%s%s:%v,", text, name, in.fields[name])
+	}
+	text = strings.TrimSuffix(text, ",")
+	return text + "}"
+}
+
+// boundMethod is a method of the virtual machine together with the instance it was accessed on.
+type boundMethod struct {
+	receiver *instance
+	method   *closure
+}
+
+func (b *boundMethod) Throws() bool {
+	return b.method.Throws()
+}
+
+func (b *boundMethod) ArgumentCount() int {
+	return b.method.ArgumentCount()
+}
+
+func (b *boundMethod) ReturnValueCount() int {
+	return b.method.ReturnValueCount()
+}
+
+func (b *boundMethod) Call(i *Interpreter, args []any) (any, error) {
+	return i.vm.call(b, args, Token{Line: -1})
+}
+
+func (b *boundMethod) String() string {
+	return b.method.String()
+}
+
+// bind returns method with 'this' referring to receiver.
+func bind(method Callable, receiver *instance) Callable {
+	switch m := method.(type) {
+	case function:
+		env := NewEnvironment(m.closure)
+		env.Define("this", receiver)
+		m.closure = env
+		return m
+	case *closure:
+		return &boundMethod{
+			receiver: receiver,
+			method:   m,
+		}
+	}
+	return method
+}
+
+func (i *Interpreter) instantiate(c *class, args []any) (any, error) {
+	instance := newInstance(c)
+
+	prevEnv := i.env
+	// the field initializers are executed in the scope of 'this' like the checker resolves them,
+	// so the fields are defined after 'this' in its slots
+	i.env = NewEnvironment(c.closure)
+	i.env.Define("this", instance)
+	slot := 1
+	for _, field := range c.fieldDecls {
+		err := i.executeTopLevel(field)
+		if err != nil {
+			i.env = prevEnv
+			return nil, err
+		}
+		// the following initializers can access the field through 'this'
+		for ; slot < len(i.env.values); slot++ {
+			instance.fields[i.env.slotNames[slot]] = i.env.values[slot]
+		}
+	}
+	i.env = prevEnv
+
+	if c.constructor != nil {
+		_, err := bind(c.constructor, instance).Call(i, args)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return instance, nil
+}
@@ -0,0 +1,1377 @@
+package interpreter
+
+import (
+	"fmt"
+	"math"
+)
+
+type local struct {
+	name     string
+	depth    int
+	captured bool
+}
+
+type upvalueRef struct {
+	index   int
+	isLocal bool
+}
+
+type loop struct {
+	scopeDepth   int
+	handlerDepth int
+	// continue jumps to the end of the body
+	continueJumps []int
+	breakJumps    []int
+}
+
+// handler is an exception handler pushed by opTry, which is active while the statements inside of it are compiled.
+type handler struct {
+	// the finally block, which runs whenever control leaves the handler, nil for the handlers of catch clauses
+	finally Stmt
+	// the number of locals when the handler was pushed
+	localCount int
+}
+
+type compiler struct {
+	enclosing  *compiler
+	proto      *prototype
+	locals     []local
+	upvalues   []upvalueRef
+	scopeDepth int
+	loops      []*loop
+	handlers   []handler
+	// the token of the instructions which are currently emitted
+	token   Token
+	modules map[*module]*compiledModule
+}
+
+// Compile translates a checked program into bytecode for the virtual machine.
+func Compile(program []Stmt) (*Bytecode, error) {
+	script, err := compileScript(program, "<script>", make(map[*module]*compiledModule))
+	if err != nil {
+		return nil, err
+	}
+	return &Bytecode{
+		script: script,
+	}, nil
+}
+
+func compileScript(program []Stmt, name string, modules map[*module]*compiledModule) (*prototype, error) {
+	c := newCompiler(nil, name, modules)
+	c.proto.script = true
+	for _, stmt := range program {
+		err := c.statement(stmt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.emit(opReturn, 0)
+	return c.proto, nil
+}
+
+func newCompiler(enclosing *compiler, name string, modules map[*module]*compiledModule) *compiler {
+	return &compiler{
+		enclosing: enclosing,
+		proto: &prototype{
+			name: name,
+		},
+		// slot 0 contains the called function
+		locals:  []local{{name: "", depth: 0}},
+		modules: modules,
+	}
+}
+
+func (c *compiler) VisitExpression(stmt *StmtExpression) error {
+	_, err := stmt.Expr.Accept(c)
+	if err != nil {
+		return err
+	}
+	c.emit(opPop)
+	return nil
+}
+
+func (c *compiler) VisitBlock(stmt *StmtBlock) error {
+	c.beginScope()
+	for _, s := range stmt.Statements {
+		err := c.statement(s)
+		if err != nil {
+			return err
+		}
+	}
+	c.endScope()
+	return nil
+}
+
+func (c *compiler) VisitVarDecl(stmt *StmtVarDecl) error {
+	if stmt.Expr != nil {
+		_, err := stmt.Expr.Accept(c)
+		if err != nil {
+			return err
+		}
+	} else {
+		c.emit(opNull)
+	}
+
+	c.token = stmt.Operator
+	if _, isCall := stmt.Expr.(*ExprCall); isCall || len(stmt.Names) > 1 {
+		c.emit(opUnpack, len(stmt.Names))
+	}
+
+	if c.scopeDepth > 0 {
+		for _, name := range stmt.Names {
+			err := c.addLocal(name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i := len(stmt.Names) - 1; i >= 0; i-- {
+		c.token = stmt.Names[i]
+		index, err := c.addConstant(stmt.Names[i].Lexeme)
+		if err != nil {
+			return err
+		}
+		c.emit(opDefineGlobal, index)
+	}
+	return nil
+}
+
+func (c *compiler) VisitFuncDecl(stmt *StmtFuncDecl) error {
+	if c.scopeDepth > 0 {
+		err := c.addLocal(stmt.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := c.function(stmt.Name, stmt.Name.Lexeme, stmt.Parameters, stmt.Body, stmt.ReturnValueCount, stmt.Throws)
+	if err != nil {
+		return err
+	}
+
+	if c.scopeDepth == 0 {
+		index, err := c.addConstant(stmt.Name.Lexeme)
+		if err != nil {
+			return err
+		}
+		c.token = stmt.Name
+		c.emit(opDefineGlobal, index)
+	}
+	return nil
+}
+
+func (c *compiler) VisitIf(stmt *StmtIf) error {
+	_, err := stmt.Condition.Accept(c)
+	if err != nil {
+		return err
+	}
+
+	c.token = stmt.Keyword
+	elseJump := c.emitJump(opJumpIfFalse)
+
+	err = c.statement(stmt.Body)
+	if err != nil {
+		return err
+	}
+
+	if stmt.ElseBody == nil {
+		return c.patchJump(elseJump)
+	}
+
+	c.token = stmt.Keyword
+	endJump := c.emitJump(opJump)
+	err = c.patchJump(elseJump)
+	if err != nil {
+		return err
+	}
+	err = c.statement(stmt.ElseBody)
+	if err != nil {
+		return err
+	}
+	return c.patchJump(endJump)
+}
+
+func (c *compiler) VisitWhile(stmt *StmtWhile) error {
+	start := len(c.proto.chunk.code)
+	_, err := stmt.Condition.Accept(c)
+	if err != nil {
+		return err
+	}
+	c.token = stmt.Keyword
+	exitJump := c.emitJump(opJumpIfFalse)
+
+	l := c.beginLoop()
+	err = c.statement(stmt.Body)
+	if err != nil {
+		return err
+	}
+
+	for _, jump := range l.continueJumps {
+		err = c.patchJump(jump)
+		if err != nil {
+			return err
+		}
+	}
+	c.token = stmt.Keyword
+	err = c.emitLoop(start)
+	if err != nil {
+		return err
+	}
+
+	err = c.patchJump(exitJump)
+	if err != nil {
+		return err
+	}
+	return c.endLoop(l)
+}
+
+func (c *compiler) VisitFor(stmt *StmtFor) error {
+	err := stmt.Initializer.Accept(c)
+	if err != nil {
+		return err
+	}
+
+	start := len(c.proto.chunk.code)
+	_, err = stmt.Condition.Accept(c)
+	if err != nil {
+		return err
+	}
+	c.token = stmt.Keyword
+	exitJump := c.emitJump(opJumpIfFalse)
+
+	l := c.beginLoop()
+	err = c.statement(stmt.Body)
+	if err != nil {
+		return err
+	}
+
+	for _, jump := range l.continueJumps {
+		err = c.patchJump(jump)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = stmt.Increment.Accept(c)
+	if err != nil {
+		return err
+	}
+	c.token = stmt.Keyword
+	c.emit(opPop)
+	err = c.emitLoop(start)
+	if err != nil {
+		return err
+	}
+
+	err = c.patchJump(exitJump)
+	if err != nil {
+		return err
+	}
+	return c.endLoop(l)
+}
+
+func (c *compiler) VisitForEach(stmt *StmtForEach) error {
+	_, err := stmt.Collection.Accept(c)
+	if err != nil {
+		return err
+	}
+	c.token = stmt.In
+	c.emit(opIterator)
+	c.beginScope()
+	// the iterator is kept as a hidden local
+	err = c.addLocal(Token{})
+	if err != nil {
+		return err
+	}
+
+	start := len(c.proto.chunk.code)
+	c.token = stmt.Keyword
+	withIndex := 0
+	if stmt.Index.Lexeme != "" {
+		withIndex = 1
+	}
+	c.emit(opNext, withIndex, 0xffff)
+	exitJump := len(c.proto.chunk.code) - 2
+
+	l := c.beginLoop()
+	c.beginScope()
+	if stmt.Index.Lexeme != "" {
+		err = c.addLocal(stmt.Index)
+		if err != nil {
+			return err
+		}
+	}
+	err = c.addLocal(stmt.Element)
+	if err != nil {
+		return err
+	}
+	err = c.statement(stmt.Body)
+	if err != nil {
+		return err
+	}
+	c.token = stmt.Keyword
+	c.endScope()
+
+	for _, jump := range l.continueJumps {
+		err = c.patchJump(jump)
+		if err != nil {
+			return err
+		}
+	}
+	c.token = stmt.Keyword
+	err = c.emitLoop(start)
+	if err != nil {
+		return err
+	}
+
+	err = c.patchJump(exitJump)
+	if err != nil {
+		return err
+	}
+	err = c.endLoop(l)
+	if err != nil {
+		return err
+	}
+	c.endScope()
+	return nil
+}
+
+func (c *compiler) VisitMatch(stmt *StmtMatch) error {
+	_, err := stmt.Value.Accept(c)
+	if err != nil {
+		return err
+	}
+	c.beginScope()
+	// the value is kept as a hidden local
+	err = c.addLocal(Token{})
+	if err != nil {
+		return err
+	}
+	value := len(c.locals) - 1
+
+	endJumps := make([]int, 0, len(stmt.Cases))
+	for _, matchCase := range stmt.Cases {
+		bindings := patternBindings(matchCase.Patterns)
+		index, err := c.addConstant(&casePatterns{
+			patterns: matchCase.Patterns,
+			bindings: len(bindings),
+		})
+		if err != nil {
+			return err
+		}
+
+		c.beginScope()
+		c.token = stmt.Keyword
+		c.emit(opGetLocal, value)
+		c.emit(opMatch, index)
+		for _, name := range bindings {
+			err = c.addLocal(name)
+			if err != nil {
+				return err
+			}
+		}
+		c.token = matchCase.Keyword
+		failJumps := []int{c.emitJump(opJumpIfFalse)}
+
+		if matchCase.Guard != nil {
+			_, err = matchCase.Guard.Accept(c)
+			if err != nil {
+				return err
+			}
+			c.token = matchCase.Keyword
+			failJumps = append(failJumps, c.emitJump(opJumpIfFalse))
+		}
+
+		err = c.statement(matchCase.Body)
+		if err != nil {
+			return err
+		}
+		c.token = matchCase.Keyword
+		c.discardLocals(c.scopeDepth - 1)
+		endJumps = append(endJumps, c.emitJump(opJump))
+
+		// the bindings are on the stack if the case doesn't match
+		for _, jump := range failJumps {
+			err = c.patchJump(jump)
+			if err != nil {
+				return err
+			}
+		}
+		c.endScope()
+	}
+
+	for _, jump := range endJumps {
+		err = c.patchJump(jump)
+		if err != nil {
+			return err
+		}
+	}
+	c.token = stmt.Keyword
+	c.endScope()
+	return nil
+}
+
+func (c *compiler) VisitLoopControl(stmt *StmtLoopControl) error {
+	c.token = stmt.Keyword
+	l := c.loops[len(c.loops)-1]
+
+	err := c.leaveHandlers(l.handlerDepth)
+	if err != nil {
+		return err
+	}
+	c.token = stmt.Keyword
+	c.discardLocals(l.scopeDepth)
+
+	if stmt.Keyword.Type == BREAK {
+		l.breakJumps = append(l.breakJumps, c.emitJump(opJump))
+		return nil
+	}
+
+	l.continueJumps = append(l.continueJumps, c.emitJump(opJump))
+	return nil
+}
+
+func (c *compiler) VisitReturn(stmt *StmtReturn) error {
+	for _, v := range stmt.Values {
+		_, err := v.Accept(c)
+		if err != nil {
+			return err
+		}
+	}
+	c.token = stmt.Keyword
+
+	for _, h := range c.handlers {
+		if h.finally == nil {
+			continue
+		}
+		// the return values are kept as hidden locals while the finally blocks are executed
+		localCount := len(c.locals)
+		for range stmt.Values {
+			err := c.addLocal(Token{})
+			if err != nil {
+				return err
+			}
+		}
+		err := c.leaveHandlers(0)
+		if err != nil {
+			return err
+		}
+		c.locals = c.locals[:localCount]
+		c.token = stmt.Keyword
+		break
+	}
+
+	c.emit(opReturn, len(stmt.Values))
+	return nil
+}
+
+func (c *compiler) VisitThrow(stmt *StmtThrow) error {
+	_, err := stmt.Value.Accept(c)
+	if err != nil {
+		return err
+	}
+	c.token = stmt.Keyword
+	c.emit(opThrow)
+	return nil
+}
+
+func (c *compiler) VisitTry(stmt *StmtTry) error {
+	if stmt.Finally == nil {
+		return c.tryCatch(stmt)
+	}
+
+	c.token = stmt.Keyword
+	finallyJump := c.emitJump(opTry)
+	c.handlers = append(c.handlers, handler{
+		finally:    stmt.Finally,
+		localCount: len(c.locals),
+	})
+	err := c.tryCatch(stmt)
+	if err != nil {
+		return err
+	}
+	c.handlers = c.handlers[:len(c.handlers)-1]
+
+	c.token = stmt.Keyword
+	c.emit(opEndTry)
+	err = c.statement(stmt.Finally)
+	if err != nil {
+		return err
+	}
+	c.token = stmt.Keyword
+	endJump := c.emitJump(opJump)
+
+	// the caught error is on top of the stack and thrown again after the finally block
+	err = c.patchJump(finallyJump)
+	if err != nil {
+		return err
+	}
+	err = c.addLocal(Token{})
+	if err != nil {
+		return err
+	}
+	err = c.statement(stmt.Finally)
+	if err != nil {
+		return err
+	}
+	c.token = stmt.Keyword
+	c.emit(opRethrow)
+	c.locals = c.locals[:len(c.locals)-1]
+
+	return c.patchJump(endJump)
+}
+
+func (c *compiler) tryCatch(stmt *StmtTry) error {
+	if len(stmt.Catches) == 0 {
+		return c.statement(stmt.Body)
+	}
+
+	c.token = stmt.Keyword
+	catchJump := c.emitJump(opTry)
+
+	c.handlers = append(c.handlers, handler{
+		localCount: len(c.locals),
+	})
+	err := c.statement(stmt.Body)
+	if err != nil {
+		return err
+	}
+	c.handlers = c.handlers[:len(c.handlers)-1]
+
+	c.token = stmt.Keyword
+	c.emit(opEndTry)
+	endJump := c.emitJump(opJump)
+	// the caught error is on top of the stack
+	err = c.patchJump(catchJump)
+	if err != nil {
+		return err
+	}
+	endJumps := []int{endJump}
+	for _, clause := range stmt.Catches {
+		c.token = clause.Keyword
+		nextJump := -1
+		if clause.Kind.Lexeme != "" {
+			kind, err := c.addConstant(clause.Kind.Lexeme)
+			if err != nil {
+				return err
+			}
+			c.emit(opIsKind, kind)
+			nextJump = c.emitJump(opJumpIfFalse)
+		}
+
+		c.beginScope()
+		if clause.Name.Lexeme != "" {
+			err = c.addLocal(clause.Name)
+			if err != nil {
+				return err
+			}
+		} else {
+			c.emit(opPop)
+		}
+		err = c.statement(clause.Body)
+		if err != nil {
+			return err
+		}
+		c.endScope()
+
+		if nextJump >= 0 {
+			c.token = clause.Keyword
+			endJumps = append(endJumps, c.emitJump(opJump))
+			err = c.patchJump(nextJump)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if stmt.Catches[len(stmt.Catches)-1].Kind.Lexeme != "" {
+		// no catch clause handles the error
+		c.token = stmt.Keyword
+		c.emit(opRethrow)
+	}
+
+	for _, jump := range endJumps {
+		err = c.patchJump(jump)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *compiler) VisitDefer(stmt *StmtDefer) error {
+	_, err := stmt.Call.Callee.Accept(c)
+	if err != nil {
+		return err
+	}
+	for _, a := range stmt.Call.Args {
+		_, err = a.Accept(c)
+		if err != nil {
+			return err
+		}
+	}
+	c.token = stmt.Call.OpenParen
+	c.emit(opDefer, len(stmt.Call.Args))
+	return nil
+}
+
+func (c *compiler) VisitImport(stmt *StmtImport) error {
+	mod, ok := c.modules[stmt.Module]
+	if !ok {
+		mod = &compiledModule{
+			module: stmt.Module,
+		}
+		c.modules[stmt.Module] = mod
+		script, err := compileScript(stmt.Module.program, stmt.Module.path, c.modules)
+		if err != nil {
+			return err
+		}
+		mod.script = script
+	}
+
+	c.token = stmt.Keyword
+	index, err := c.addConstant(mod)
+	if err != nil {
+		return err
+	}
+	c.emit(opImport, index)
+
+	c.token = stmt.Namespace
+	index, err = c.addConstant(stmt.Namespace.Lexeme)
+	if err != nil {
+		return err
+	}
+	c.emit(opDefineGlobal, index)
+	return nil
+}
+
+func (c *compiler) VisitLiteral(expr *ExprLiteral) (any, error) {
+	switch expr.Value {
+	case nil:
+		c.emit(opNull)
+	case true:
+		c.emit(opTrue)
+	case false:
+		c.emit(opFalse)
+	default:
+		index, err := c.addConstant(expr.Value)
+		if err != nil {
+			return nil, err
+		}
+		c.emit(opConstant, index)
+	}
+	return nil, nil
+}
+
+func (c *compiler) VisitVariable(expr *ExprVariable) (any, error) {
+	c.token = expr.Name
+	op, operand, err := c.resolve(expr.Name, false)
+	if err != nil {
+		return nil, err
+	}
+	c.emit(op, operand)
+	return nil, nil
+}
+
+func (c *compiler) VisitCall(expr *ExprCall) (any, error) {
+	_, err := expr.Callee.Accept(c)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range expr.Args {
+		_, err = a.Accept(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.token = expr.OpenParen
+	c.emit(opCall, len(expr.Args))
+	return nil, nil
+}
+
+func (c *compiler) VisitSubscript(expr *ExprSubscript) (any, error) {
+	_, err := expr.Object.Accept(c)
+	if err != nil {
+		return nil, err
+	}
+	_, err = expr.Subscript.Accept(c)
+	if err != nil {
+		return nil, err
+	}
+	c.token = expr.OpenBracket
+	c.emit(opGetSubscript)
+	return nil, nil
+}
+
+func (c *compiler) VisitProperty(expr *ExprProperty) (any, error) {
+	_, err := expr.Object.Accept(c)
+	if err != nil {
+		return nil, err
+	}
+	index, err := c.addConstant(expr.Name.Lexeme)
+	if err != nil {
+		return nil, err
+	}
+	c.token = expr.Name
+	c.emit(opGetProperty, index)
+	return nil, nil
+}
+
+func (c *compiler) VisitGrouping(expr *ExprGrouping) (any, error) {
+	return expr.Expr.Accept(c)
+}
+
+func (c *compiler) VisitTemplate(expr *ExprTemplate) (any, error) {
+	for _, part := range expr.Parts {
+		_, err := part.Accept(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.token = expr.Start
+	c.emit(opTemplate, len(expr.Parts))
+	return nil, nil
+}
+
+func (c *compiler) VisitList(expr *ExprList) (any, error) {
+	for _, v := range expr.Values {
+		_, err := v.Accept(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.token = expr.OpenBracket
+	c.emit(opList, len(expr.Values))
+	return nil, nil
+}
+
+func (c *compiler) VisitMap(expr *ExprMap) (any, error) {
+	for index, k := range expr.Keys {
+		_, err := k.Accept(c)
+		if err != nil {
+			return nil, err
+		}
+		_, err = expr.Values[index].Accept(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.token = expr.OpenBrace
+	c.emit(opMap, len(expr.Keys))
+	return nil, nil
+}
+
+func (c *compiler) VisitUnary(expr *ExprUnary) (any, error) {
+	_, err := expr.Right.Accept(c)
+	if err != nil {
+		return nil, err
+	}
+	c.token = expr.Operator
+	switch expr.Operator.Type {
+	case MINUS:
+		c.emit(opNegate)
+	case BANG:
+		c.emit(opNot)
+	default:
+		return nil, c.newError(fmt.Sprintf("Invalid unary operator '%s'.", expr.Operator.Lexeme), expr.Operator)
+	}
+	return nil, nil
+}
+
+var binaryOpcodes = map[TokenType]opcode{
+	PLUS:              opAdd,
+	MINUS:             opSubtract,
+	ASTERISK:          opMultiply,
+	SLASH:             opDivide,
+	PERCENT:           opModulo,
+	ASTERISK_ASTERISK: opPower,
+	EQUAL_EQUAL:       opEqual,
+	BANG_EQUAL:        opNotEqual,
+	LESS:              opLess,
+	LESS_EQUAL:        opLessEqual,
+	GREATER:           opGreater,
+	GREATER_EQUAL:     opGreaterEqual,
+}
+
+func (c *compiler) VisitBinary(expr *ExprBinary) (any, error) {
+	_, err := expr.Left.Accept(c)
+	if err != nil {
+		return nil, err
+	}
+	_, err = expr.Right.Accept(c)
+	if err != nil {
+		return nil, err
+	}
+	c.token = expr.Operator
+	op, ok := binaryOpcodes[expr.Operator.Type]
+	if !ok {
+		return nil, c.newError(fmt.Sprintf("Invalid binary operator '%s'.", expr.Operator.Lexeme), expr.Operator)
+	}
+	c.emit(op)
+	return nil, nil
+}
+
+func (c *compiler) VisitLogical(expr *ExprLogical) (any, error) {
+	_, err := expr.Left.Accept(c)
+	if err != nil {
+		return nil, err
+	}
+	c.token = expr.Operator
+
+	if expr.Operator.Type == XOR {
+		_, err = expr.Right.Accept(c)
+		if err != nil {
+			return nil, err
+		}
+		c.token = expr.Operator
+		c.emit(opXor)
+		return nil, nil
+	}
+
+	if expr.Operator.Type == OR {
+		c.emit(opNot)
+	}
+	shortCircuitJump := c.emitJump(opJumpIfFalse)
+	_, err = expr.Right.Accept(c)
+	if err != nil {
+		return nil, err
+	}
+	c.token = expr.Operator
+	c.emit(opToBoolean)
+	endJump := c.emitJump(opJump)
+	err = c.patchJump(shortCircuitJump)
+	if err != nil {
+		return nil, err
+	}
+	if expr.Operator.Type == OR {
+		c.emit(opTrue)
+	} else {
+		c.emit(opFalse)
+	}
+	return nil, c.patchJump(endJump)
+}
+
+func (c *compiler) VisitTernary(expr *ExprTernary) (any, error) {
+	_, err := expr.Left.Accept(c)
+	if err != nil {
+		return nil, err
+	}
+	c.token = expr.Operator1
+	elseJump := c.emitJump(opJumpIfFalse)
+	_, err = expr.Center.Accept(c)
+	if err != nil {
+		return nil, err
+	}
+	c.token = expr.Operator1
+	endJump := c.emitJump(opJump)
+	err = c.patchJump(elseJump)
+	if err != nil {
+		return nil, err
+	}
+	_, err = expr.Right.Accept(c)
+	if err != nil {
+		return nil, err
+	}
+	return nil, c.patchJump(endJump)
+}
+
+func (c *compiler) VisitAssign(expr *ExprAssign) (any, error) {
+	_, err := expr.Expr.Accept(c)
+	if err != nil {
+		return nil, err
+	}
+
+	c.token = expr.Operator
+	_, isCall := expr.Expr.(*ExprCall)
+	if !isCall && len(expr.Assignees) == 1 {
+		return nil, c.assign(expr.Assignees[0], expr.Operator)
+	}
+
+	// keep the original value as the result of the expression
+	c.emit(opDup)
+	c.emit(opUnpack, len(expr.Assignees))
+	for i := len(expr.Assignees) - 1; i >= 0; i-- {
+		err = c.assign(expr.Assignees[i], expr.Operator)
+		if err != nil {
+			return nil, err
+		}
+		c.emit(opPop)
+	}
+	return nil, nil
+}
+
+// assign stores the value on top of the stack in assignee without removing it.
+func (c *compiler) assign(assignee Expr, operator Token) error {
+	switch a := assignee.(type) {
+	case *ExprVariable:
+		c.token = a.Name
+		op, operand, err := c.resolve(a.Name, true)
+		if err != nil {
+			return err
+		}
+		c.emit(op, operand)
+	case *ExprSubscript:
+		_, err := a.Object.Accept(c)
+		if err != nil {
+			return err
+		}
+		_, err = a.Subscript.Accept(c)
+		if err != nil {
+			return err
+		}
+		c.token = a.OpenBracket
+		c.emit(opSetSubscript)
+	case *ExprProperty:
+		_, err := a.Object.Accept(c)
+		if err != nil {
+			return err
+		}
+		index, err := c.addConstant(a.Name.Lexeme)
+		if err != nil {
+			return err
+		}
+		c.token = a.Name
+		c.emit(opSetProperty, index)
+	default:
+		return c.newError("Can only assign to variables.", operator)
+	}
+	return nil
+}
+
+func (c *compiler) VisitAnonymousFunction(expr *ExprAnonymousFunction) (any, error) {
+	return nil, c.function(expr.Keyword, "<anonymous>", expr.Parameters, expr.Body, expr.ReturnValueCount, expr.Throws)
+}
+
+func (c *compiler) VisitThis(expr *ExprThis) (any, error) {
+	c.token = expr.Keyword
+	op, operand, err := c.resolve(expr.Keyword, false)
+	if err != nil {
+		return nil, err
+	}
+	c.emit(op, operand)
+	return nil, nil
+}
+
+func (c *compiler) VisitClass(stmt *StmtClass) error {
+	fields := make([]string, 0, len(stmt.Fields))
+	for _, field := range stmt.Fields {
+		for _, name := range field.Names {
+			fields = append(fields, name.Lexeme)
+		}
+	}
+
+	c.token = stmt.Name
+	index, err := c.addConstant(&classPrototype{
+		name:   stmt.Name.Lexeme,
+		fields: fields,
+	})
+	if err != nil {
+		return err
+	}
+	if c.scopeDepth > 0 {
+		err = c.addLocal(stmt.Name)
+		if err != nil {
+			return err
+		}
+	}
+	c.emit(opClass, index)
+	if c.scopeDepth == 0 {
+		index, err = c.addConstant(stmt.Name.Lexeme)
+		if err != nil {
+			return err
+		}
+		c.emit(opDefineGlobal, index)
+	}
+
+	// load the class again to add the methods
+	op, operand, err := c.resolve(stmt.Name, false)
+	if err != nil {
+		return err
+	}
+	c.emit(op, operand)
+
+	methods := stmt.Methods
+	hasConstructor := false
+	for _, m := range methods {
+		if m.Name.Lexeme == "init" {
+			hasConstructor = true
+		}
+	}
+	if !hasConstructor {
+		// the fields are initialized by a constructor without a body, which doesn't count as a step
+		// because the tree-walking interpreter doesn't call a constructor at all
+		methods = append(methods, &StmtFuncDecl{
+			Name: Token{
+				Line:   stmt.Name.Line,
+				Column: stmt.Name.Column,
+				Type:   IDENTIFIER,
+				Lexeme: "init",
+				File:   stmt.Name.File,
+			},
+		})
+	}
+
+	for _, m := range methods {
+		err = c.method(m, stmt.Fields)
+		if err != nil {
+			return err
+		}
+		index, err = c.addConstant(m.Name.Lexeme)
+		if err != nil {
+			return err
+		}
+		c.token = m.Name
+		c.emit(opMethod, index)
+	}
+	c.token = stmt.Name
+	c.emit(opPop)
+	return nil
+}
+
+// function compiles a function body and emits the instruction to create a closure from it.
+func (c *compiler) function(token Token, name string, parameters []Token, body Stmt, returnValueCount int, throws bool) error {
+	fc := c.functionCompiler(name, parameters, returnValueCount, throws)
+	return c.closure(fc, token, body)
+}
+
+// method compiles a method, which finds its instance in slot 0.
+// The constructor 'init' additionally initializes all fields before executing its body.
+func (c *compiler) method(stmt *StmtFuncDecl, fields []*StmtVarDecl) error {
+	fc := c.functionCompiler(stmt.Name.Lexeme, stmt.Parameters, stmt.ReturnValueCount, stmt.Throws)
+	fc.locals[0].name = "this"
+
+	if stmt.Name.Lexeme == "init" {
+		// parameters are not accessible in field initializers
+		for i := 1; i < len(fc.locals); i++ {
+			fc.locals[i].name = ""
+		}
+		for _, field := range fields {
+			fc.step(field)
+			err := fc.initField(field)
+			if err != nil {
+				return err
+			}
+		}
+		for i, p := range stmt.Parameters {
+			fc.locals[i+1].name = p.Lexeme
+		}
+	}
+
+	return c.closure(fc, stmt.Name, stmt.Body)
+}
+
+func (c *compiler) initField(field *StmtVarDecl) error {
+	if field.Expr != nil {
+		_, err := field.Expr.Accept(c)
+		if err != nil {
+			return err
+		}
+	} else {
+		c.emit(opNull)
+	}
+
+	c.token = field.Operator
+	if _, isCall := field.Expr.(*ExprCall); isCall || len(field.Names) > 1 {
+		c.emit(opUnpack, len(field.Names))
+	}
+
+	for i := len(field.Names) - 1; i >= 0; i-- {
+		c.token = field.Names[i]
+		index, err := c.addConstant(field.Names[i].Lexeme)
+		if err != nil {
+			return err
+		}
+		c.emit(opInitField, index)
+	}
+	return nil
+}
+
+func (c *compiler) functionCompiler(name string, parameters []Token, returnValueCount int, throws bool) *compiler {
+	fc := newCompiler(c, name, c.modules)
+	fc.proto.arity = len(parameters)
+	fc.proto.returnValueCount = returnValueCount
+	fc.proto.throws = throws
+	fc.scopeDepth = 1
+	for _, p := range parameters {
+		fc.locals = append(fc.locals, local{
+			name:  p.Lexeme,
+			depth: fc.scopeDepth,
+		})
+	}
+	return fc
+}
+
+// closure compiles the body of the function compiled by fc and emits the instruction to create a closure from it.
+func (c *compiler) closure(fc *compiler, token Token, body Stmt) error {
+	if body != nil {
+		err := fc.statement(body)
+		if err != nil {
+			return err
+		}
+	}
+	fc.token = token
+	fc.emit(opReturn, 0)
+	fc.proto.upvalueCount = len(fc.upvalues)
+
+	c.token = token
+	index, err := c.addConstant(fc.proto)
+	if err != nil {
+		return err
+	}
+	c.emit(opClosure, index)
+	for _, u := range fc.upvalues {
+		isLocal := 0
+		if u.isLocal {
+			isLocal = 1
+		}
+		c.emitShort(isLocal)
+		c.emitShort(u.index)
+	}
+	return nil
+}
+
+// resolve returns the instruction and its operand to access the variable name.
+func (c *compiler) resolve(name Token, set bool) (opcode, int, error) {
+	if slot := c.resolveLocal(name.Lexeme); slot >= 0 {
+		if set {
+			return opSetLocal, slot, nil
+		}
+		return opGetLocal, slot, nil
+	}
+
+	index, err := c.resolveUpvalue(name.Lexeme)
+	if err != nil {
+		return 0, 0, err
+	}
+	if index >= 0 {
+		if set {
+			return opSetUpvalue, index, nil
+		}
+		return opGetUpvalue, index, nil
+	}
+
+	index, err = c.addConstant(name.Lexeme)
+	if err != nil {
+		return 0, 0, err
+	}
+	if set {
+		return opSetGlobal, index, nil
+	}
+	return opGetGlobal, index, nil
+}
+
+func (c *compiler) resolveLocal(name string) int {
+	for i := len(c.locals) - 1; i >= 0; i-- {
+		if c.locals[i].name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *compiler) resolveUpvalue(name string) (int, error) {
+	if c.enclosing == nil {
+		return -1, nil
+	}
+
+	if slot := c.enclosing.resolveLocal(name); slot >= 0 {
+		c.enclosing.locals[slot].captured = true
+		return c.addUpvalue(slot, true)
+	}
+
+	index, err := c.enclosing.resolveUpvalue(name)
+	if err != nil || index < 0 {
+		return index, err
+	}
+	return c.addUpvalue(index, false)
+}
+
+func (c *compiler) addUpvalue(index int, isLocal bool) (int, error) {
+	for i, u := range c.upvalues {
+		if u.index == index && u.isLocal == isLocal {
+			return i, nil
+		}
+	}
+	if len(c.upvalues) > math.MaxUint16 {
+		return 0, c.newError("Too many captured variables in function.", c.token)
+	}
+	c.upvalues = append(c.upvalues, upvalueRef{
+		index:   index,
+		isLocal: isLocal,
+	})
+	return len(c.upvalues) - 1, nil
+}
+
+func (c *compiler) addLocal(name Token) error {
+	if len(c.locals) > math.MaxUint16 {
+		return c.newError("Too many local variables in function.", name)
+	}
+	c.locals = append(c.locals, local{
+		name:  name.Lexeme,
+		depth: c.scopeDepth,
+	})
+	return nil
+}
+
+func (c *compiler) addConstant(value any) (int, error) {
+	for i, v := range c.proto.chunk.constants {
+		if v == value {
+			if _, ok := value.(float64); ok || isString(value) {
+				return i, nil
+			}
+		}
+	}
+	if len(c.proto.chunk.constants) > math.MaxUint16 {
+		return 0, c.newError("Too many constants in function.", c.token)
+	}
+	c.proto.chunk.constants = append(c.proto.chunk.constants, value)
+	return len(c.proto.chunk.constants) - 1, nil
+}
+
+func isString(value any) bool {
+	_, ok := value.(string)
+	return ok
+}
+
+func (c *compiler) beginScope() {
+	c.scopeDepth++
+}
+
+func (c *compiler) endScope() {
+	c.scopeDepth--
+	c.discardLocals(c.scopeDepth)
+	for len(c.locals) > 1 && c.locals[len(c.locals)-1].depth > c.scopeDepth {
+		c.locals = c.locals[:len(c.locals)-1]
+	}
+}
+
+// discardLocals emits instructions to remove all locals deeper than depth from the stack
+// without forgetting about them at compile time.
+func (c *compiler) discardLocals(depth int) {
+	for i := len(c.locals) - 1; i > 0 && c.locals[i].depth > depth; i-- {
+		if c.locals[i].captured {
+			c.emit(opCloseUpvalue)
+		} else {
+			c.emit(opPop)
+		}
+	}
+}
+
+// leaveHandlers emits the instructions to leave all handlers above depth before jumping out of them.
+// The finally blocks of the handlers are compiled inline, so the stack must only contain locals.
+func (c *compiler) leaveHandlers(depth int) error {
+	handlers := c.handlers
+	defer func() {
+		c.handlers = handlers
+	}()
+
+	for len(c.handlers) > depth {
+		h := c.handlers[len(c.handlers)-1]
+		c.handlers = c.handlers[:len(c.handlers)-1]
+		c.emit(opEndTry)
+		if h.finally == nil {
+			continue
+		}
+
+		// locals declared inside of the try statement are not visible in the finally block
+		locals := c.locals
+		c.locals = make([]local, len(locals))
+		copy(c.locals, locals)
+		for i := h.localCount; i < len(c.locals); i++ {
+			c.locals[i].name = ""
+		}
+		err := c.statement(h.finally)
+		if err != nil {
+			return err
+		}
+		for i := range locals {
+			locals[i].captured = locals[i].captured || c.locals[i].captured
+		}
+		c.locals = locals
+	}
+	return nil
+}
+
+func (c *compiler) beginLoop() *loop {
+	l := &loop{
+		scopeDepth:   c.scopeDepth,
+		handlerDepth: len(c.handlers),
+	}
+	c.loops = append(c.loops, l)
+	return l
+}
+
+func (c *compiler) endLoop(l *loop) error {
+	c.loops = c.loops[:len(c.loops)-1]
+	for _, jump := range l.breakJumps {
+		err := c.patchJump(jump)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// statement compiles stmt, whose execution counts as a step of the step limit.
+func (c *compiler) statement(stmt Stmt) error {
+	c.step(stmt)
+	return stmt.Accept(c)
+}
+
+// step emits the instruction to count the execution of stmt.
+func (c *compiler) step(stmt Stmt) {
+	token := c.token
+	location, ok := stepLocation(stmt)
+	hasLocation := 0
+	if ok {
+		c.token = location
+		hasLocation = 1
+	}
+	c.emit(opStep, hasLocation)
+	c.token = token
+}
+
+func (c *compiler) emit(op opcode, operands ...int) {
+	c.proto.chunk.write(byte(op), c.token)
+	for _, o := range operands {
+		c.emitShort(o)
+	}
+}
+
+func (c *compiler) emitShort(value int) {
+	c.proto.chunk.write(byte(value>>8), c.token)
+	c.proto.chunk.write(byte(value), c.token)
+}
+
+// emitJump emits a jump instruction with a placeholder offset and returns the position of the offset.
+func (c *compiler) emitJump(op opcode) int {
+	c.emit(op, 0xffff)
+	return len(c.proto.chunk.code) - 2
+}
+
+func (c *compiler) patchJump(position int) error {
+	offset := len(c.proto.chunk.code) - position - 2
+	if offset > math.MaxUint16 {
+		return c.newError("Too much code to jump over.", c.token)
+	}
+	c.proto.chunk.code[position] = byte(offset >> 8)
+	c.proto.chunk.code[position+1] = byte(offset)
+	return nil
+}
+
+func (c *compiler) emitLoop(start int) error {
+	offset := len(c.proto.chunk.code) - start + 3
+	if offset > math.MaxUint16 {
+		return c.newError("Loop body too large.", c.token)
+	}
+	c.emit(opLoop, offset)
+	return nil
+}
+
+func (c *compiler) newError(message string, token Token) error {
+	return ParseError{
+		Token:   token,
+		Message: message,
+		Line:    token.lineText(),
+	}
+}
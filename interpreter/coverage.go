@@ -0,0 +1,332 @@
+package interpreter
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+// Coverage records how often the statements and branches of programs were executed.
+// It can be shared by multiple programs, e.g. the test files of a project, whose counts are merged.
+type Coverage struct {
+	statements map[coveragePosition]*StatementCoverage
+	branches   map[coveragePosition]*BranchCoverage
+	modules    map[*module]bool
+}
+
+// FileCoverage contains the statements and branches of a file sorted by their position.
+type FileCoverage struct {
+	Path       string              `json:"path"`
+	Statements []StatementCoverage `json:"statements"`
+	Branches   []BranchCoverage    `json:"branches"`
+}
+
+// StatementCoverage is a statement starting at Line and Column, which start at 1.
+type StatementCoverage struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	// the number of executions
+	Count int `json:"count"`
+}
+
+// BranchCoverage is the condition of an if statement, a loop or a ternary expression starting at Line and Column, which start at 1.
+type BranchCoverage struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	// 'if', 'while', 'for', 'foreach' or 'ternary'
+	Kind string `json:"kind"`
+	// the number of times the condition was true, i.e. the body was executed
+	Taken int `json:"taken"`
+	// the number of times the condition was false, i.e. the body was skipped
+	NotTaken int `json:"notTaken"`
+}
+
+type coveragePosition struct {
+	path   string
+	line   int
+	column int
+}
+
+// NewCoverage returns an empty coverage. Programs are registered with Add before they are executed.
+func NewCoverage() *Coverage {
+	return &Coverage{
+		statements: make(map[coveragePosition]*StatementCoverage),
+		branches:   make(map[coveragePosition]*BranchCoverage),
+		modules:    make(map[*module]bool),
+	}
+}
+
+// ReadCoverage reads coverage written by Coverage.Write.
+func ReadCoverage(r io.Reader) (*Coverage, error) {
+	var files []FileCoverage
+	err := json.NewDecoder(r).Decode(&files)
+	if err != nil {
+		return nil, err
+	}
+	c := NewCoverage()
+	for _, f := range files {
+		for index, s := range f.Statements {
+			c.statements[coveragePosition{path: f.Path, line: s.Line - 1, column: s.Column - 1}] = &f.Statements[index]
+		}
+		for index, b := range f.Branches {
+			c.branches[coveragePosition{path: f.Path, line: b.Line - 1, column: b.Column - 1}] = &f.Branches[index]
+		}
+	}
+	return c, nil
+}
+
+// Write writes the coverage as JSON to w.
+func (c *Coverage) Write(w io.Writer) error {
+	return json.NewEncoder(w).Encode(c.Files())
+}
+
+// Files returns the coverage of all files sorted by their path.
+func (c *Coverage) Files() []FileCoverage {
+	files := make(map[string]*FileCoverage)
+	file := func(path string) *FileCoverage {
+		f, ok := files[path]
+		if !ok {
+			f = &FileCoverage{
+				Path:       path,
+				Statements: make([]StatementCoverage, 0),
+				Branches:   make([]BranchCoverage, 0),
+			}
+			files[path] = f
+		}
+		return f
+	}
+	for position, s := range c.statements {
+		f := file(position.path)
+		f.Statements = append(f.Statements, *s)
+	}
+	for position, b := range c.branches {
+		f := file(position.path)
+		f.Branches = append(f.Branches, *b)
+	}
+
+	sorted := make([]FileCoverage, 0, len(files))
+	for _, f := range files {
+		sort.Slice(f.Statements, func(i, j int) bool {
+			a, b := f.Statements[i], f.Statements[j]
+			return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+		})
+		sort.Slice(f.Branches, func(i, j int) bool {
+			a, b := f.Branches[i], f.Branches[j]
+			return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+		})
+		sorted = append(sorted, *f)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Path < sorted[j].Path
+	})
+	return sorted
+}
+
+// Add registers all statements and branches of program and the modules imported by it.
+// Only registered statements and branches are recorded while a program is executed.
+func (c *Coverage) Add(program []Stmt) {
+	c.statementList(program)
+}
+
+// AddModules registers all statements and branches of the modules imported by program but not of program itself,
+// e.g. to only measure the code tested by a test file.
+func (c *Coverage) AddModules(program []Stmt) {
+	for _, stmt := range program {
+		if s, ok := stmt.(*StmtImport); ok {
+			c.module(s.Module)
+		}
+	}
+}
+
+// statement counts an execution of stmt.
+func (c *Coverage) statement(stmt Stmt) {
+	location, ok := stmtLocation(stmt)
+	if !ok {
+		return
+	}
+	if s, ok := c.statements[newCoveragePosition(location)]; ok {
+		s.Count++
+	}
+}
+
+// branch counts whether the condition of the branch at location was true.
+func (c *Coverage) branch(location Token, taken bool) {
+	b, ok := c.branches[newCoveragePosition(location)]
+	if !ok {
+		return
+	}
+	if taken {
+		b.Taken++
+	} else {
+		b.NotTaken++
+	}
+}
+
+func newCoveragePosition(location Token) coveragePosition {
+	return coveragePosition{
+		path:   location.path(),
+		line:   location.Line,
+		column: location.Column,
+	}
+}
+
+// addStatement registers stmt unless it is a block or its location is unknown.
+func (c *Coverage) addStatement(stmt Stmt) {
+	if _, ok := stmt.(*StmtBlock); ok {
+		return
+	}
+	location, ok := stmtLocation(stmt)
+	if !ok {
+		return
+	}
+	position := newCoveragePosition(location)
+	if _, ok := c.statements[position]; !ok {
+		c.statements[position] = &StatementCoverage{
+			Line:   location.Line + 1,
+			Column: location.Column + 1,
+		}
+	}
+}
+
+func (c *Coverage) addBranch(location Token, kind string) {
+	position := newCoveragePosition(location)
+	if _, ok := c.branches[position]; !ok {
+		c.branches[position] = &BranchCoverage{
+			Line:   location.Line + 1,
+			Column: location.Column + 1,
+			Kind:   kind,
+		}
+	}
+}
+
+func (c *Coverage) module(m *module) {
+	if m == nil || c.modules[m] {
+		return
+	}
+	c.modules[m] = true
+	c.statementList(m.program)
+}
+
+func (c *Coverage) statementList(stmts []Stmt) {
+	for _, stmt := range stmts {
+		c.stmt(stmt)
+	}
+}
+
+// stmt registers stmt and all statements and branches nested in it.
+func (c *Coverage) stmt(stmt Stmt) {
+	if stmt == nil {
+		return
+	}
+	c.addStatement(stmt)
+	switch s := stmt.(type) {
+	case *StmtExpression:
+		c.expr(s.Expr)
+	case *StmtBlock:
+		c.statementList(s.Statements)
+	case *StmtVarDecl:
+		c.expr(s.Expr)
+	case *StmtFuncDecl:
+		c.stmt(s.Body)
+	case *StmtClass:
+		for _, field := range s.Fields {
+			c.stmt(field)
+		}
+		for _, method := range s.Methods {
+			c.stmt(method.Body)
+		}
+	case *StmtIf:
+		c.addBranch(s.Keyword, "if")
+		c.expr(s.Condition)
+		c.stmt(s.Body)
+		c.stmt(s.ElseBody)
+	case *StmtWhile:
+		c.addBranch(s.Keyword, "while")
+		c.expr(s.Condition)
+		c.stmt(s.Body)
+	case *StmtFor:
+		c.addBranch(s.Keyword, "for")
+		// the initializer is executed as part of the loop
+		if initializer, ok := s.Initializer.(*StmtVarDecl); ok {
+			c.expr(initializer.Expr)
+		} else if initializer, ok := s.Initializer.(*StmtExpression); ok {
+			c.expr(initializer.Expr)
+		}
+		c.expr(s.Condition)
+		c.expr(s.Increment)
+		c.stmt(s.Body)
+	case *StmtForEach:
+		c.addBranch(s.Keyword, "foreach")
+		c.expr(s.Collection)
+		c.stmt(s.Body)
+	case *StmtMatch:
+		c.expr(s.Value)
+		for _, matchCase := range s.Cases {
+			c.expr(matchCase.Guard)
+			c.stmt(matchCase.Body)
+		}
+	case *StmtReturn:
+		for _, value := range s.Values {
+			c.expr(value)
+		}
+	case *StmtThrow:
+		c.expr(s.Value)
+	case *StmtTry:
+		c.stmt(s.Body)
+		for _, catch := range s.Catches {
+			c.stmt(catch.Body)
+		}
+		c.stmt(s.Finally)
+	case *StmtDefer:
+		c.expr(s.Call)
+	case *StmtImport:
+		c.module(s.Module)
+	}
+}
+
+// expr registers the ternary expressions and anonymous functions nested in expr.
+func (c *Coverage) expr(expr Expr) {
+	switch e := expr.(type) {
+	case *ExprTemplate:
+		c.exprList(e.Parts)
+	case *ExprCall:
+		c.expr(e.Callee)
+		c.exprList(e.Args)
+	case *ExprSubscript:
+		c.expr(e.Object)
+		c.expr(e.Subscript)
+	case *ExprProperty:
+		c.expr(e.Object)
+	case *ExprGrouping:
+		c.expr(e.Expr)
+	case *ExprList:
+		c.exprList(e.Values)
+	case *ExprMap:
+		c.exprList(e.Keys)
+		c.exprList(e.Values)
+	case *ExprUnary:
+		c.expr(e.Right)
+	case *ExprBinary:
+		c.expr(e.Left)
+		c.expr(e.Right)
+	case *ExprLogical:
+		c.expr(e.Left)
+		c.expr(e.Right)
+	case *ExprTernary:
+		c.addBranch(e.Operator1, "ternary")
+		c.expr(e.Left)
+		c.expr(e.Center)
+		c.expr(e.Right)
+	case *ExprAssign:
+		c.exprList(e.Assignees)
+		c.expr(e.Expr)
+	case *ExprAnonymousFunction:
+		c.stmt(e.Body)
+	}
+}
+
+func (c *Coverage) exprList(exprs []Expr) {
+	for _, expr := range exprs {
+		c.expr(expr)
+	}
+}
@@ -0,0 +1,653 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrNotPaused is returned by the methods of Debugger which can only be used while the program is paused.
+var ErrNotPaused = errors.New("The program is not paused.")
+
+// ErrTerminated is returned by the program of a Debugger after it was aborted with Terminate.
+var ErrTerminated = errors.New("The program has been terminated.")
+
+// reasons why a debugger paused the program
+const (
+	StopEntry      = "entry"
+	StopBreakpoint = "breakpoint"
+	StopStep       = "step"
+	StopPause      = "pause"
+)
+
+// stepMode determines at which statement the debugger pauses the program next.
+type stepMode int
+
+const (
+	// only at breakpoints
+	stepContinue stepMode = iota
+	// at the next statement
+	stepIn
+	// at the next statement which is not part of a function called by the current one
+	stepOver
+	// at the next statement after the current function returned
+	stepOut
+)
+
+// DebugEvent reports that the program paused or exited.
+type DebugEvent struct {
+	// one of the Stop constants, empty if the program exited
+	Reason string
+	// the first token of the statement which is executed next
+	Location Token
+	// the error the program exited with
+	Err error
+}
+
+// DebugFrame is an active function call of a paused program.
+type DebugFrame struct {
+	Function string
+	// the statement which is executed next or which contains the call of the next frame
+	Location Token
+}
+
+// DebugVariable is a named value of a paused program.
+type DebugVariable struct {
+	Name  string
+	Value string
+	Type  string
+	value any
+}
+
+// HasChildren reports whether the variable is a list, map, instance or module whose elements can be inspected with Children.
+func (v DebugVariable) HasChildren() bool {
+	switch v.value.(type) {
+	case list, hashMap, *instance, namespace:
+		return true
+	}
+	return false
+}
+
+type debugFrame struct {
+	function string
+	location Token
+	// the innermost scope of the function when it executed the statement at location
+	env *Environment
+}
+
+// Debugger executes a program with the tree-walking interpreter and pauses it at breakpoints and after steps.
+// The program runs on its own goroutine and reports when it pauses or exits with the events returned by Events.
+// While the program is paused, it can be inspected with StackTrace, Variables, Children and Evaluate
+// and continued with Continue, StepIn, StepOver and StepOut. Terminate aborts it at any time.
+type Debugger struct {
+	program     []Stmt
+	interpreter *Interpreter
+	events      chan DebugEvent
+	// executed by the goroutine of the paused program, which continues if a command returns true
+	commands chan func() bool
+
+	mu sync.Mutex
+	// absolute paths to lines
+	breakpoints map[string]map[int]bool
+	mode        stepMode
+	// stepOver and stepOut pause in the innermost of these frames which is still active
+	stepFrames     []*debugFrame
+	pauseRequested bool
+	stopOnEntry    bool
+	started        bool
+	paused         bool
+	terminated     bool
+
+	// only accessed by the goroutine of the program
+	frames     []*debugFrame
+	evaluating bool
+	absPaths   map[*SourceFile]string
+}
+
+// NewDebugger returns a debugger for program, which must have been checked with Check.
+// The program reads its input from stdin and writes its output to stdout.
+func NewDebugger(program []Stmt, stdin io.Reader, stdout io.Writer, limits Limits) *Debugger {
+	d := &Debugger{
+		program:     program,
+		interpreter: newInterpreter(stdin, stdout, nil),
+		events:      make(chan DebugEvent),
+		commands:    make(chan func() bool),
+		breakpoints: make(map[string]map[int]bool),
+		absPaths:    make(map[*SourceFile]string),
+	}
+	d.interpreter.limits = limits
+	d.interpreter.debugger = d
+	d.frames = []*debugFrame{{
+		function: d.interpreter.function,
+		env:      d.interpreter.env,
+	}}
+	return d
+}
+
+// Events returns the channel which receives an event every time the program pauses.
+// After the program exited, it receives a final event with an empty Reason and is closed.
+func (d *Debugger) Events() <-chan DebugEvent {
+	return d.events
+}
+
+// Start executes the top-level declarations of the program and its main function.
+// If stopOnEntry is set, the program pauses before its first statement.
+func (d *Debugger) Start(stopOnEntry bool) error {
+	d.mu.Lock()
+	if d.started {
+		d.mu.Unlock()
+		return errors.New("The program has already been started.")
+	}
+	d.started = true
+	d.stopOnEntry = stopOnEntry
+	d.mu.Unlock()
+
+	go func() {
+		err := d.run()
+		d.events <- DebugEvent{Err: err}
+		close(d.events)
+	}()
+	return nil
+}
+
+func (d *Debugger) run() error {
+	return d.interpreter.run(d.program, "main")
+}
+
+// SetBreakpoints replaces all breakpoints in the file at path. Lines start at 0.
+// Breakpoints can be set at any time, even while the program is running.
+func (d *Debugger) SetBreakpoints(path string, lines []int) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	breakpoints := make(map[int]bool, len(lines))
+	for _, line := range lines {
+		breakpoints[line] = true
+	}
+
+	d.mu.Lock()
+	d.breakpoints[path] = breakpoints
+	d.mu.Unlock()
+}
+
+// Pause pauses the running program before its next statement.
+func (d *Debugger) Pause() {
+	d.mu.Lock()
+	d.pauseRequested = true
+	d.mu.Unlock()
+}
+
+// Continue continues the paused program until it reaches a breakpoint.
+func (d *Debugger) Continue() error {
+	return d.resume(stepContinue)
+}
+
+// StepIn continues the paused program until the next statement, which might be part of a called function.
+func (d *Debugger) StepIn() error {
+	return d.resume(stepIn)
+}
+
+// StepOver continues the paused program until the next statement of the current function or one of its callers.
+func (d *Debugger) StepOver() error {
+	return d.resume(stepOver)
+}
+
+// StepOut continues the paused program until the current function returned.
+func (d *Debugger) StepOut() error {
+	return d.resume(stepOut)
+}
+
+// Terminate aborts the program before its next statement, even if it is paused.
+// The final event reports ErrTerminated unless the program exited before.
+func (d *Debugger) Terminate() {
+	d.mu.Lock()
+	d.terminated = true
+	paused := d.paused
+	d.mu.Unlock()
+	if paused {
+		// the program checks whether it was terminated once it continues
+		d.do(func() bool {
+			d.mu.Lock()
+			d.paused = false
+			d.mu.Unlock()
+			return true
+		})
+	}
+}
+
+func (d *Debugger) resume(mode stepMode) error {
+	return d.do(func() bool {
+		depth := len(d.frames)
+		if mode == stepOut {
+			depth--
+		}
+		d.mu.Lock()
+		d.mode = mode
+		d.stepFrames = append(d.stepFrames[:0], d.frames[:depth]...)
+		d.paused = false
+		d.mu.Unlock()
+		return true
+	})
+}
+
+// StackTrace returns the active function calls of the paused program, innermost first.
+func (d *Debugger) StackTrace() ([]DebugFrame, error) {
+	var frames []DebugFrame
+	err := d.do(func() bool {
+		frames = make([]DebugFrame, 0, len(d.frames))
+		for index := len(d.frames) - 1; index >= 0; index-- {
+			frames = append(frames, DebugFrame{
+				Function: d.frames[index].function,
+				Location: d.frames[index].location,
+			})
+		}
+		return false
+	})
+	return frames, err
+}
+
+// Variables returns the names visible in the frame with the index of the stack trace.
+// Locals contains the names of all enclosing scopes of the function, inner names shadow outer ones.
+// Globals contains the names of the module of the function without builtin functions.
+func (d *Debugger) Variables(frame int) (locals []DebugVariable, globals []DebugVariable, err error) {
+	err = d.do(func() bool {
+		var f *debugFrame
+		f, err = d.frame(frame)
+		if err != nil {
+			return false
+		}
+
+		locals = make([]DebugVariable, 0)
+		shadowed := make(map[string]bool)
+		env := f.env
+		for ; env.parent != nil; env = env.parent {
+			for _, name := range sortedNames(env) {
+				if !shadowed[name] {
+					shadowed[name] = true
+					value, _ := env.lookup(name)
+					locals = append(locals, newDebugVariable(name, value))
+				}
+			}
+		}
+		globals = d.globals(env)
+		return false
+	})
+	return locals, globals, err
+}
+
+// Children returns the elements of a list, the entries of a map, the fields of an instance or the names of a module.
+func (d *Debugger) Children(v DebugVariable) ([]DebugVariable, error) {
+	var children []DebugVariable
+	err := d.do(func() bool {
+		children = make([]DebugVariable, 0)
+		switch value := v.value.(type) {
+		case list:
+			for index, element := range value {
+				children = append(children, newDebugVariable(fmt.Sprint(index), element))
+			}
+		case hashMap:
+			keys := make([]any, 0, len(value))
+			for key := range value {
+				keys = append(keys, key)
+			}
+			sort.Slice(keys, func(i, j int) bool {
+				return toString(keys[i]) < toString(keys[j])
+			})
+			for _, key := range keys {
+				children = append(children, newDebugVariable(toString(key), value[key]))
+			}
+		case *instance:
+			for _, name := range value.class.fields {
+				children = append(children, newDebugVariable(name, value.fields[name]))
+			}
+		case namespace:
+			children = d.globals(value.env)
+		}
+		return false
+	})
+	return children, err
+}
+
+// Evaluate evaluates expression in the innermost scope of the frame with the index of the stack trace.
+// The expression is checked like a part of the program, breakpoints are ignored while it is evaluated.
+func (d *Debugger) Evaluate(expression string, frame int) (DebugVariable, error) {
+	tokens, err := Scan(strings.NewReader(expression), "")
+	if err != nil {
+		return DebugVariable{}, plainError(err)
+	}
+	p := &parser{
+		tokens: tokens,
+		errors: make([]error, 0),
+	}
+	expr, err := p.expression()
+	if err == nil {
+		p.match(SEMICOLON)
+		if p.peek().Type != EOF {
+			err = p.newError(fmt.Sprintf("Unexpected token '%s'", p.peek().Lexeme))
+		}
+	}
+	if err != nil {
+		return DebugVariable{}, plainError(err)
+	}
+
+	var result DebugVariable
+	doErr := d.do(func() bool {
+		var f *debugFrame
+		f, err = d.frame(frame)
+		if err != nil {
+			return false
+		}
+		c := d.checkerFor(f.env)
+		_, err = expr.Accept(c)
+		c.report(err)
+		if err = c.errors(); err != nil {
+			return false
+		}
+
+		prevEnv := d.interpreter.env
+		d.interpreter.env = f.env
+		d.evaluating = true
+		var value any
+		value, err = expr.Accept(d.interpreter)
+		d.evaluating = false
+		d.interpreter.env = prevEnv
+
+		result = newDebugVariable(expression, value)
+		return false
+	})
+	if doErr != nil {
+		return DebugVariable{}, doErr
+	}
+	if err != nil {
+		return DebugVariable{}, plainError(err)
+	}
+	return result, nil
+}
+
+// do executes fn on the goroutine of the paused program and waits until it returns.
+// The program continues if fn returns true.
+func (d *Debugger) do(fn func() bool) error {
+	d.mu.Lock()
+	paused := d.paused
+	d.mu.Unlock()
+	if !paused {
+		return ErrNotPaused
+	}
+
+	done := make(chan struct{})
+	d.commands <- func() bool {
+		defer close(done)
+		return fn()
+	}
+	<-done
+	return nil
+}
+
+// beforeStatement is called by the interpreter before it executes stmt and pauses the program if necessary.
+// It returns ErrTerminated if the program has to be aborted.
+func (d *Debugger) beforeStatement(stmt Stmt) error {
+	if d.evaluating {
+		return nil
+	}
+	location, ok := stmtLocation(stmt)
+	if !ok {
+		return d.terminatedError()
+	}
+	frame := d.frames[len(d.frames)-1]
+	frame.location = location
+	frame.env = d.interpreter.env
+
+	reason := d.stopReason(location)
+	if reason == "" {
+		return d.terminatedError()
+	}
+
+	d.mu.Lock()
+	if d.terminated {
+		d.mu.Unlock()
+		return ErrTerminated
+	}
+	d.paused = true
+	d.pauseRequested = false
+	d.mu.Unlock()
+	d.events <- DebugEvent{
+		Reason:   reason,
+		Location: location,
+	}
+	for command := range d.commands {
+		if command() {
+			break
+		}
+	}
+	return d.terminatedError()
+}
+
+// terminatedError returns ErrTerminated if Terminate was called.
+func (d *Debugger) terminatedError() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.terminated {
+		return ErrTerminated
+	}
+	return nil
+}
+
+func (d *Debugger) stopReason(location Token) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	depth := len(d.frames)
+	switch {
+	case d.stopOnEntry:
+		d.stopOnEntry = false
+		return StopEntry
+	case d.pauseRequested:
+		return StopPause
+	case d.mode == stepIn:
+		return StopStep
+	case d.mode == stepOver || d.mode == stepOut:
+		if depth <= len(d.stepFrames) && d.frames[depth-1] == d.stepFrames[depth-1] {
+			return StopStep
+		}
+	}
+
+	if location.File == nil {
+		return ""
+	}
+	path, ok := d.absPaths[location.File]
+	if !ok {
+		path = location.File.Path
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		d.absPaths[location.File] = path
+	}
+	if d.breakpoints[path][location.Line] {
+		return StopBreakpoint
+	}
+	return ""
+}
+
+func (d *Debugger) enterFunction(name string) {
+	d.frames = append(d.frames, &debugFrame{
+		function: name,
+		env:      d.interpreter.env,
+	})
+}
+
+func (d *Debugger) leaveFunction() {
+	d.frames = d.frames[:len(d.frames)-1]
+}
+
+func (d *Debugger) frame(index int) (*debugFrame, error) {
+	if index < 0 || index >= len(d.frames) {
+		return nil, fmt.Errorf("Invalid frame %d.", index)
+	}
+	return d.frames[len(d.frames)-1-index], nil
+}
+
+// globals returns the names defined in the global environment env without builtin functions.
+func (d *Debugger) globals(env *Environment) []DebugVariable {
+	globals := make([]DebugVariable, 0)
+	for _, name := range sortedNames(env) {
+		if _, ok := nativeFunctions[name]; ok {
+			continue
+		}
+		if _, ok := d.interpreter.natives[name]; ok {
+			continue
+		}
+		globals = append(globals, newDebugVariable(name, env.names[name]))
+	}
+	return globals
+}
+
+// checkerFor returns a checker which knows all names visible in env, so expressions can be checked as if they were part of the program.
+func (d *Debugger) checkerFor(env *Environment) *checker {
+	c := newChecker(newModuleLoader())
+	c.state["canThrow"] = true
+
+	envs := make([]*Environment, env.nestingLevel+1)
+	for e := env; e != nil; e = e.parent {
+		envs[e.nestingLevel] = e
+	}
+	for level, e := range envs {
+		if level > 0 {
+			c.beginScope()
+		}
+		// local names are declared in the order of their slots, so the checker assigns the same ones
+		for _, name := range e.definedNames() {
+			if _, ok := c.scopes[level][name]; ok {
+				continue
+			}
+			c.declare(name, variable{
+				name:     Token{Line: -1, Column: -1, Type: IDENTIFIER, Lexeme: name},
+				state:    variableStateUsed,
+				nameType: nameTypeVariable,
+			})
+		}
+	}
+	return c
+}
+
+func newDebugVariable(name string, value any) DebugVariable {
+	text := toString(value)
+	if values, ok := value.(multiValueReturn); ok {
+		texts := make([]string, len(values))
+		for index, v := range values {
+			texts[index] = toString(v)
+		}
+		text = strings.Join(texts, ", ")
+	}
+	return DebugVariable{
+		Name:  name,
+		Value: text,
+		Type:  typeName(value),
+		value: value,
+	}
+}
+
+func sortedNames(env *Environment) []string {
+	names := env.definedNames()
+	sort.Strings(names)
+	return names
+}
+
+// plainError converts err to an error whose message doesn't contain the source code or escape sequences.
+func plainError(err error) error {
+	diagnostics := Diagnostics(err)
+	messages := make([]string, len(diagnostics))
+	for index, d := range diagnostics {
+		messages[index] = d.Message
+	}
+	return errors.New(strings.Join(messages, "\n"))
+}
+
+// stmtLocation returns the first token of stmt. Blocks don't have a location because the debugger pauses at their statements instead.
+func stmtLocation(stmt Stmt) (Token, bool) {
+	switch s := stmt.(type) {
+	case *StmtExpression:
+		return exprLocation(s.Expr)
+	case *StmtVarDecl:
+		return s.Names[0], true
+	case *StmtFuncDecl:
+		return s.Name, true
+	case *StmtClass:
+		return s.Name, true
+	case *StmtIf:
+		return s.Keyword, true
+	case *StmtWhile:
+		return s.Keyword, true
+	case *StmtFor:
+		return s.Keyword, true
+	case *StmtForEach:
+		return s.Keyword, true
+	case *StmtMatch:
+		return s.Keyword, true
+	case *StmtLoopControl:
+		return s.Keyword, true
+	case *StmtReturn:
+		return s.Keyword, true
+	case *StmtThrow:
+		return s.Keyword, true
+	case *StmtTry:
+		return s.Keyword, true
+	case *StmtDefer:
+		return s.Keyword, true
+	case *StmtImport:
+		return s.Keyword, true
+	}
+	return Token{}, false
+}
+
+// exprLocation returns the first token of expr. Literals don't store their token.
+func exprLocation(expr Expr) (Token, bool) {
+	switch e := expr.(type) {
+	case *ExprTemplate:
+		return e.Start, true
+	case *ExprVariable:
+		return e.Name, true
+	case *ExprCall:
+		return exprLocation(e.Callee)
+	case *ExprSubscript:
+		return exprLocation(e.Object)
+	case *ExprProperty:
+		return exprLocation(e.Object)
+	case *ExprGrouping:
+		return exprLocation(e.Expr)
+	case *ExprList:
+		return e.OpenBracket, true
+	case *ExprMap:
+		return e.OpenBrace, true
+	case *ExprUnary:
+		return e.Operator, true
+	case *ExprBinary:
+		if location, ok := exprLocation(e.Left); ok {
+			return location, true
+		}
+		return e.Operator, true
+	case *ExprLogical:
+		if location, ok := exprLocation(e.Left); ok {
+			return location, true
+		}
+		return e.Operator, true
+	case *ExprTernary:
+		if location, ok := exprLocation(e.Left); ok {
+			return location, true
+		}
+		return e.Operator1, true
+	case *ExprAssign:
+		if location, ok := exprLocation(e.Assignees[0]); ok {
+			return location, true
+		}
+		return e.Operator, true
+	case *ExprAnonymousFunction:
+		return e.Keyword, true
+	case *ExprThis:
+		return e.Keyword, true
+	}
+	return Token{}, false
+}
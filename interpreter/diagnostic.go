@@ -0,0 +1,173 @@
+package interpreter
+
+import (
+	"fmt"
+	"sort"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// codes of diagnostics which are not runtime errors, unused names have the code unused-<kind of name>
+const (
+	CodeSyntaxError     = "syntax-error"
+	CodeCheckError      = "check-error"
+	CodeUnreachableCase = "unreachable-case"
+	// used for errors which are not caused by the source code, e.g. a missing file
+	CodeError = "error"
+)
+
+// Diagnostic is an error or warning about a range of a single line of source code.
+// Lines and columns start at 0. Line is -1 if the position is unknown.
+type Diagnostic struct {
+	Severity Severity
+	// one of the Code constants or the kind of a runtime error or exception, e.g. TypeError
+	Code      string
+	Message   string
+	Path      string
+	Line      int
+	Column    int
+	EndColumn int
+	lineText  []rune
+}
+
+func (d Diagnostic) String() string {
+	if d.Line < 0 {
+		return d.Message
+	}
+	if d.Severity == SeverityWarning {
+		return generateWarningText(d.Message, d.Path, d.lineText, d.Line, d.Column, d.EndColumn)
+	}
+	return generateErrorText(d.Message, d.Path, d.lineText, d.Line, d.Column, d.EndColumn)
+}
+
+// Error makes it possible to return diagnostics as errors.
+func (d Diagnostic) Error() string {
+	return d.String()
+}
+
+func newDiagnostic(severity Severity, code, message string, token Token) Diagnostic {
+	return Diagnostic{
+		Severity:  severity,
+		Code:      code,
+		Message:   message,
+		Path:      token.path(),
+		Line:      token.Line,
+		Column:    token.Column,
+		EndColumn: token.Column + len([]rune(token.Lexeme)),
+		lineText:  token.lineText(),
+	}
+}
+
+// Diagnostics converts errors returned by Scan, Parse, Check or the interpreter into diagnostics.
+func Diagnostics(err error) []Diagnostic {
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case Diagnostic:
+		return []Diagnostic{e}
+	case errorList:
+		diagnostics := make([]Diagnostic, 0, len(e))
+		for _, err := range e {
+			diagnostics = append(diagnostics, Diagnostics(err)...)
+		}
+		return diagnostics
+	case ScanError:
+		return []Diagnostic{{
+			Severity:  SeverityError,
+			Code:      CodeSyntaxError,
+			Message:   e.Message,
+			Path:      e.Path,
+			Line:      e.Line,
+			Column:    e.Column,
+			EndColumn: e.Column + 1,
+			lineText:  e.LineText,
+		}}
+	case ParseError:
+		d := newDiagnostic(SeverityError, CodeSyntaxError, e.Message, e.Token)
+		d.lineText = e.Line
+		return []Diagnostic{d}
+	case RuntimeError:
+		d := newDiagnostic(SeverityError, e.Kind, e.Message, e.Token)
+		d.EndColumn = e.Token.Column + len([]byte(e.Token.Lexeme))
+		d.lineText = e.Line
+		return []Diagnostic{d}
+	case Exception:
+		f := e.caught()
+		if len(f.stack) == 0 || f.stack[0].Location.Line < 0 {
+			return []Diagnostic{{
+				Severity: SeverityError,
+				Code:     f.kind,
+				Message:  f.message,
+				Line:     -1,
+			}}
+		}
+		return []Diagnostic{newDiagnostic(SeverityError, f.kind, f.message, f.stack[0].Location)}
+	}
+	return []Diagnostic{{
+		Severity: SeverityError,
+		Code:     CodeError,
+		Message:  err.Error(),
+		Line:     -1,
+	}}
+}
+
+// Errors returns the diagnostics with SeverityError as a single error or nil if there are none.
+func Errors(diagnostics []Diagnostic) error {
+	errs := make(errorList, 0)
+	for _, d := range diagnostics {
+		if d.Severity == SeverityError {
+			errs = append(errs, d)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// sortDiagnostics sorts diagnostics by file and position. Diagnostics without a position come first.
+func sortDiagnostics(diagnostics []Diagnostic) {
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i], diagnostics[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
+
+// uniqueDiagnostics removes duplicates from sorted diagnostics, which occur if a module is imported multiple times.
+func uniqueDiagnostics(diagnostics []Diagnostic) []Diagnostic {
+	unique := make([]Diagnostic, 0, len(diagnostics))
+	for _, d := range diagnostics {
+		isDuplicate := false
+		for i := len(unique) - 1; i >= 0 && unique[i].Path == d.Path && unique[i].Line == d.Line && unique[i].Column == d.Column; i-- {
+			if unique[i].Severity == d.Severity && unique[i].Message == d.Message && unique[i].EndColumn == d.EndColumn {
+				isDuplicate = true
+				break
+			}
+		}
+		if !isDuplicate {
+			unique = append(unique, d)
+		}
+	}
+	return unique
+}
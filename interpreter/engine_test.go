@@ -0,0 +1,263 @@
+package interpreter_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Bananenpro/crab/interpreter"
+)
+
+// run loads source with engine, calls its main function and returns the output.
+func run(t *testing.T, engine interpreter.Engine, source string) string {
+	t.Helper()
+	var stdout strings.Builder
+	r := interpreter.NewRuntime(interpreter.WithEngine(engine), interpreter.WithStdout(&stdout), interpreter.WithStderr(io.Discard))
+	if err := r.Load(strings.NewReader(source), "test.cb"); err != nil {
+		t.Fatalf("%s: load: %s", engine, err)
+	}
+	if _, err := r.Call("main"); err != nil {
+		t.Fatalf("%s: main: %s", engine, err)
+	}
+	return stdout.String()
+}
+
+// TestEngineParity checks that the tree-walking interpreter and the virtual machine produce the same output.
+func TestEngineParity(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{
+			name: "closures in field initializers",
+			source: `
+var offset = 100;
+
+class C {
+	var base = 5;
+	var f = func(a) 1 { return a + 1; };
+	var h = func(a, b, c) 1 { return c; };
+	var g = func(x) 1 {
+		var y = x * 2;
+		return func(z) 1 { return y + z + offset + this.base; };
+	};
+	var total = 1 + 2;
+}
+
+func main() {
+	var c = C();
+	println(c.f(10));
+	println(c.h(1, 2, 3));
+	println(c.g(4)(1));
+	println(c.base, c.total);
+}
+`,
+			want: "11\n3\n114\n5 3\n",
+		},
+		{
+			name: "fields in later field initializers",
+			source: `
+class P {
+	var x = 1;
+	var z = this.x;
+	var id = this.x + 1;
+	var a = this.id * 2;
+}
+
+func main() {
+	var p = P();
+	println(p.x, p.z, p.id, p.a);
+}
+`,
+			want: "1 1 2 4\n",
+		},
+		{
+			name: "contains and indexOf with ranges",
+			source: `
+func main() {
+	println(contains(range(0, 10, 1), 5), contains(range(10, 0, -3), 4), contains(range(10, 0, -3), 5), contains(range(3), 3));
+	println(indexOf(range(0, 3, 1), 1), indexOf(range(10, 0, -3), 1), indexOf(range(5), 2.5), indexOf(range(3), "1"));
+}
+`,
+			want: "true true false false\n1 3 -1 -1\n",
+		},
+		{
+			name: "nested loops with break and continue",
+			source: `
+func main() {
+	var count = 0;
+	for (var i = 0; i < 10; i++) {
+		for (var j = 0; j < 10; j++) {
+			if (j % 2 == 0) {
+				continue;
+			}
+			if (j > i) {
+				break;
+			}
+			count++;
+		}
+	}
+	println(count);
+}
+`,
+			want: "25\n",
+		},
+		{
+			name: "return through try and finally",
+			source: `
+func f() 1 throws {
+	for (var i = 0; i < 5; i++) {
+		try {
+			if (i == 2) {
+				return i;
+			}
+			throw i;
+		} catch (e) {
+			println("caught", e.value);
+		} finally {
+			println("finally", i);
+		}
+	}
+	return -1;
+}
+
+func main() throws {
+	println(f());
+}
+`,
+			want: "caught 0\nfinally 0\ncaught 1\nfinally 1\nfinally 2\n2\n",
+		},
+		{
+			name: "caught values behave like the thrown value",
+			source: `
+func main() throws {
+	try {
+		throw "notfound";
+	} catch (e) {
+		println(e == "notfound", e != "other", "error: " + e, {e: 1});
+	}
+	try {
+		throw 5;
+	} catch (e) {
+		println(e + 1, -e, e > 3, !e, e ? "yes" : "no");
+	}
+	try {
+		throw [1, 2];
+	} catch (e) {
+		println(len(e), e[0], contains(e, 2), e == [1, 2]);
+		for (var x in e) {
+			println(x);
+		}
+		println(e.kind, e.value);
+	}
+	try {
+		throw false;
+	} catch (e) {
+		println(e || false, e == false);
+	}
+}
+`,
+			want: "true true error: notfound {notfound:1}\n6 -5 true false yes\n2 1 true true\n1\n2\nError [1,2]\nfalse true\n",
+		},
+		{
+			name: "value count errors",
+			source: `
+func three() 3 {
+	return 1, 2, 3;
+}
+
+func main() throws {
+	var f = three;
+	try {
+		var a, b = f();
+		println(a, b);
+	} catch (e) {
+		println(e);
+	}
+	var x = 0;
+	var y = 0;
+	try {
+		x, y = f();
+	} catch (e) {
+		println(e);
+	}
+}
+`,
+			want: "TypeError: Cannot assign 3 values to 2 variables.\nTypeError: Cannot assign 3 values to 2 variables.\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, engine := range []interpreter.Engine{interpreter.EngineTree, interpreter.EngineVM} {
+				if got := run(t, engine, test.source); got != test.want {
+					t.Errorf("%s: got %q, want %q", engine, got, test.want)
+				}
+			}
+		})
+	}
+}
+
+// TestStepLimitParity checks that both engines count the same statements by running a program with every step limit
+// up to the number of statements it executes.
+func TestStepLimitParity(t *testing.T) {
+	source := `
+class Point {
+	var x = 1;
+	var f = func(a) 1 { return a; };
+}
+
+func fib(n) 1 {
+	if (n < 2) {
+		return n;
+	}
+	return fib(n - 1) + fib(n - 2);
+}
+
+func main() throws {
+	var p = Point();
+	var sum = p.f(fib(4));
+	for (var x in [1, 2, 3]) {
+		match (x) {
+			case 1: { sum += 1; }
+			case _: { sum += 2; }
+		}
+	}
+	while (sum < 20) sum++;
+	for (;;) {
+		break;
+	}
+	println(sum);
+}
+`
+	results := make(map[interpreter.Engine][]string)
+	for _, engine := range []interpreter.Engine{interpreter.EngineTree, interpreter.EngineVM} {
+		for steps := 1; ; steps++ {
+			var stdout strings.Builder
+			r := interpreter.NewRuntime(interpreter.WithEngine(engine), interpreter.WithStdout(&stdout), interpreter.WithStderr(io.Discard),
+				interpreter.WithLimits(interpreter.Limits{MaxSteps: steps}))
+			err := r.Load(strings.NewReader(source), "test.cb")
+			if err == nil {
+				_, err = r.Call("main")
+			}
+			if err == nil {
+				break
+			}
+			if steps > 1000 {
+				t.Fatalf("%s: the program doesn't finish: %s", engine, err)
+			}
+			results[engine] = append(results[engine], stdout.String()+err.Error())
+		}
+	}
+
+	tree, vm := results[interpreter.EngineTree], results[interpreter.EngineVM]
+	if len(tree) != len(vm) {
+		t.Fatalf("tree executes %d statements, vm executes %d", len(tree), len(vm))
+	}
+	for steps := range tree {
+		if tree[steps] != vm[steps] {
+			t.Errorf("limit %d:\ntree: %s\nvm:   %s", steps+1, tree[steps], vm[steps])
+		}
+	}
+}
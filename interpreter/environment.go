@@ -7,28 +7,45 @@ var (
 	ErrUndefined      = errors.New("Undefined name.")
 )
 
+// Environment is a scope of the tree-walking interpreter.
+//
+// The global scope stores its names in a map because modules, hosts and the REPL look them up by name.
+// Local scopes store their values in a slice in the order of their definition, which is the slot index
+// assigned to every local variable by the checker.
 type Environment struct {
-	parent       *Environment
-	names        map[string]any
+	parent *Environment
+	// only set for the global scope
+	names map[string]any
+	// the values of a local scope indexed by their slot
+	values []any
+	// the names of values, only used to inspect scopes, e.g. by the debugger
+	slotNames    []string
 	nestingLevel int
 }
 
 func NewEnvironment(parent *Environment) *Environment {
-	nestingLevel := 0
-	if parent != nil {
-		nestingLevel = parent.nestingLevel + 1
+	if parent == nil {
+		return &Environment{
+			names: make(map[string]any),
+		}
 	}
 	return &Environment{
 		parent:       parent,
-		names:        make(map[string]any),
-		nestingLevel: nestingLevel,
+		nestingLevel: parent.nestingLevel + 1,
 	}
 }
 
+// Define defines name in the scope. In a local scope its slot is the number of names defined before it.
 func (e *Environment) Define(name string, value any) error {
 	if name == "" {
 		return nil
 	}
+	if e.names == nil {
+		// the checker already rejects names defined twice in a local scope
+		e.values = append(e.values, value)
+		e.slotNames = append(e.slotNames, name)
+		return nil
+	}
 	if e.Exists(name) {
 		return ErrAlreadyDefined
 	}
@@ -36,23 +53,58 @@ func (e *Environment) Define(name string, value any) error {
 	return nil
 }
 
-func (e *Environment) Assign(name string, value any, nestingLevel int) {
+// Assign assigns value to the variable name in the scope at nestingLevel. slot is only used for local scopes.
+func (e *Environment) Assign(name string, value any, nestingLevel, slot int) {
 	env := e
 	for nestingLevel != env.nestingLevel {
 		env = env.parent
 	}
-	env.names[name] = value
+	if env.names != nil {
+		env.names[name] = value
+		return
+	}
+	env.values[slot] = value
 }
 
-func (e *Environment) Get(name string, nestingLevel int) any {
+// Get returns the value of the variable name in the scope at nestingLevel. slot is only used for local scopes.
+func (e *Environment) Get(name string, nestingLevel, slot int) any {
 	env := e
 	for nestingLevel != env.nestingLevel {
 		env = env.parent
 	}
-	return env.names[name]
+	if env.names != nil {
+		return env.names[name]
+	}
+	return env.values[slot]
 }
 
 func (e *Environment) Exists(name string) bool {
-	_, ok := e.names[name]
+	_, ok := e.lookup(name)
 	return ok
 }
+
+// lookup returns the value of name in the scope without searching its parents.
+func (e *Environment) lookup(name string) (any, bool) {
+	if e.names != nil {
+		value, ok := e.names[name]
+		return value, ok
+	}
+	for slot, n := range e.slotNames {
+		if n == name {
+			return e.values[slot], true
+		}
+	}
+	return nil, false
+}
+
+// definedNames returns all names defined in the scope, for local scopes in the order of their slots.
+func (e *Environment) definedNames() []string {
+	if e.names == nil {
+		return append([]string(nil), e.slotNames...)
+	}
+	names := make([]string, 0, len(e.names))
+	for name := range e.names {
+		names = append(names, name)
+	}
+	return names
+}
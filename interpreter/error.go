@@ -5,28 +5,37 @@ import (
 	"strings"
 )
 
-func generateErrorText(message string, lineText []rune, line, columnStart, columnEnd int) string {
-	if columnEnd >= len(lineText) {
-		lineText = append(lineText, []rune(strings.Repeat(" ", columnEnd-(len(lineText)-1)))...)
-	}
+// colors enables ANSI escape sequences in the texts of errors and warnings.
+// They are disabled by default, so errors returned to embedding programs contain plain text.
+var colors = false
 
-	length := len(lineText)
-	lineText = []rune(strings.TrimPrefix(strings.TrimPrefix(string(lineText), " "), "\t"))
-	columnStart = columnStart - (length - len(lineText))
-	columnEnd = columnEnd - (length - len(lineText))
+// SetColors enables or disables colored texts of errors and warnings. Colors are disabled by default.
+func SetColors(enabled bool) {
+	colors = enabled
+}
+
+// style wraps text in the ANSI escape sequences codes if colors are enabled.
+func style(text string, codes ...string) string {
+	if !colors {
+		return text
+	}
+	for _, code := range codes {
+		text = "\x1b[" + code + "m" + text
+	}
+	return text + "\x1b[0m"
+}
 
-	errorLine := string(lineText[:columnStart])
-	errorLine = errorLine + "\x1b[4m\x1b[31m"
-	errorLine = errorLine + string(lineText[columnStart:columnEnd])
-	errorLine = errorLine + "\x1b[0m"
-	errorLine = errorLine + string(lineText[columnEnd:])
+func generateErrorText(message, path string, lineText []rune, line, columnStart, columnEnd int) string {
+	return generateText(style("ERROR", "31"), "31", message, path, lineText, line, columnStart, columnEnd)
+}
 
-	text := fmt.Sprintf("\x1b[2m[%d]  \x1b[0m%s", line+1, errorLine)
-	text = fmt.Sprintf("%s%s\n%s\n%s", fmt.Sprintf("\x1b[31mERROR\x1b[0m [%d:%d]: %s\n", line+1, columnStart+1, message), strings.Repeat("-", 30), text, strings.Repeat("-", 30))
-	return text
+func generateWarningText(message, path string, lineText []rune, line, columnStart, columnEnd int) string {
+	return generateText(style("WARNING", "33"), "33", message, path, lineText, line, columnStart, columnEnd)
 }
 
-func generateWarningText(message string, lineText []rune, line, columnStart, columnEnd int) string {
+func generateText(label, color, message, path string, lineText []rune, line, columnStart, columnEnd int) string {
+	position := formatPosition(path, line, columnStart)
+
 	if columnEnd >= len(lineText) {
 		lineText = append(lineText, []rune(strings.Repeat(" ", columnEnd-(len(lineText)-1)))...)
 	}
@@ -36,13 +45,28 @@ func generateWarningText(message string, lineText []rune, line, columnStart, col
 	columnStart = columnStart - (length - len(lineText))
 	columnEnd = columnEnd - (length - len(lineText))
 
-	warningLine := string(lineText[:columnStart])
-	warningLine = warningLine + "\x1b[4m\x1b[33m"
-	warningLine = warningLine + string(lineText[columnStart:columnEnd])
-	warningLine = warningLine + "\x1b[0m"
-	warningLine = warningLine + string(lineText[columnEnd:])
+	markedLine := string(lineText[:columnStart])
+	markedLine = markedLine + style(string(lineText[columnStart:columnEnd]), color, "4")
+	markedLine = markedLine + string(lineText[columnEnd:])
 
-	text := fmt.Sprintf("\x1b[2m[%d]  \x1b[0m%s", line+1, warningLine)
-	text = fmt.Sprintf("%s%s\n%s\n%s", fmt.Sprintf("\x1b[33mWARNING\x1b[0m [%d:%d]: %s\n", line+1, columnStart+1, message), strings.Repeat("-", 30), text, strings.Repeat("-", 30))
+	text := style(fmt.Sprintf("[%d]  ", line+1), "2") + markedLine
+	text = fmt.Sprintf("%s [%s]: %s\n%s\n%s\n%s", label, position, message, strings.Repeat("-", 30), text, strings.Repeat("-", 30))
 	return text
 }
+
+func formatPosition(path string, line, column int) string {
+	if path == "" {
+		return fmt.Sprintf("%d:%d", line+1, column+1)
+	}
+	return fmt.Sprintf("%s:%d:%d", path, line+1, column+1)
+}
+
+type errorList []error
+
+func (e errorList) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
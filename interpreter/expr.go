@@ -2,17 +2,21 @@ package interpreter
 
 type ExprVisitor interface {
 	VisitLiteral(expr *ExprLiteral) (any, error)
+	VisitTemplate(expr *ExprTemplate) (any, error)
 	VisitVariable(expr *ExprVariable) (any, error)
 	VisitCall(expr *ExprCall) (any, error)
 	VisitSubscript(expr *ExprSubscript) (any, error)
+	VisitProperty(expr *ExprProperty) (any, error)
 	VisitGrouping(expr *ExprGrouping) (any, error)
 	VisitList(expr *ExprList) (any, error)
+	VisitMap(expr *ExprMap) (any, error)
 	VisitUnary(expr *ExprUnary) (any, error)
 	VisitBinary(expr *ExprBinary) (any, error)
 	VisitLogical(expr *ExprLogical) (any, error)
 	VisitTernary(expr *ExprTernary) (any, error)
 	VisitAssign(expr *ExprAssign) (any, error)
 	VisitAnonymousFunction(expr *ExprAnonymousFunction) (any, error)
+	VisitThis(expr *ExprThis) (any, error)
 }
 
 type Expr interface {
@@ -27,9 +31,23 @@ func (e *ExprLiteral) Accept(visitor ExprVisitor) (any, error) {
 	return visitor.VisitLiteral(e)
 }
 
+// ExprTemplate is a string literal with interpolated expressions.
+// Its value is the concatenation of the string representations of all parts.
+type ExprTemplate struct {
+	// the part of the string literal before the first interpolation
+	Start Token
+	Parts []Expr
+}
+
+func (e *ExprTemplate) Accept(visitor ExprVisitor) (any, error) {
+	return visitor.VisitTemplate(e)
+}
+
 type ExprVariable struct {
 	Name         Token
 	NestingLevel int
+	// the index of the variable in its local scope, see Environment
+	Slot int
 }
 
 func (e *ExprVariable) Accept(visitor ExprVisitor) (any, error) {
@@ -56,6 +74,16 @@ func (e *ExprSubscript) Accept(visitor ExprVisitor) (any, error) {
 	return visitor.VisitSubscript(e)
 }
 
+type ExprProperty struct {
+	Dot    Token
+	Object Expr
+	Name   Token
+}
+
+func (e *ExprProperty) Accept(visitor ExprVisitor) (any, error) {
+	return visitor.VisitProperty(e)
+}
+
 type ExprGrouping struct {
 	Expr Expr
 }
@@ -73,6 +101,16 @@ func (e *ExprList) Accept(visitor ExprVisitor) (any, error) {
 	return visitor.VisitList(e)
 }
 
+type ExprMap struct {
+	OpenBrace Token
+	Keys      []Expr
+	Values    []Expr
+}
+
+func (e *ExprMap) Accept(visitor ExprVisitor) (any, error) {
+	return visitor.VisitMap(e)
+}
+
 type ExprUnary struct {
 	Operator Token
 	Right    Expr
@@ -127,7 +165,7 @@ func (e *ExprAssign) Accept(visitor ExprVisitor) (any, error) {
 type ExprAnonymousFunction struct {
 	Keyword          Token
 	Body             Stmt
-	Parameters       []string
+	Parameters       []Token
 	ReturnValueCount int
 	Throws           bool
 }
@@ -135,3 +173,13 @@ type ExprAnonymousFunction struct {
 func (e *ExprAnonymousFunction) Accept(visitor ExprVisitor) (any, error) {
 	return visitor.VisitAnonymousFunction(e)
 }
+
+type ExprThis struct {
+	Keyword      Token
+	NestingLevel int
+	Slot         int
+}
+
+func (e *ExprThis) Accept(visitor ExprVisitor) (any, error) {
+	return visitor.VisitThis(e)
+}
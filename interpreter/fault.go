@@ -0,0 +1,168 @@
+package interpreter
+
+import "fmt"
+
+// kinds of runtime errors
+const (
+	errorKindError      = "Error"
+	errorKindType       = "TypeError"
+	errorKindName       = "NameError"
+	errorKindIndex      = "IndexError"
+	errorKindKey        = "KeyError"
+	errorKindValue      = "ValueError"
+	errorKindAssertion  = "AssertionError"
+	errorKindLimit      = "LimitError"
+	errorKindFile       = "FileError"
+	errorKindConversion = "ConversionError"
+)
+
+// errorKinds contains all kinds which can be used in typed catch clauses in addition to class names.
+var errorKinds = map[string]bool{
+	errorKindError:      true,
+	errorKindType:       true,
+	errorKindName:       true,
+	errorKindIndex:      true,
+	errorKindKey:        true,
+	errorKindValue:      true,
+	errorKindAssertion:  true,
+	errorKindLimit:      true,
+	errorKindFile:       true,
+	errorKindConversion: true,
+}
+
+// fault is the value of a caught exception.
+// Its properties kind, message, value, stack, line and column can be accessed like the fields of an instance.
+type fault struct {
+	kind    string
+	message string
+	// the value of the exception, nil for errors of the interpreter and builtin functions
+	thrown any
+	// innermost frame first
+	stack []StackFrame
+	// set if the fault was caused by a runtime error, which is returned again if no catch clause handles the fault
+	runtimeError *RuntimeError
+}
+
+func (f *fault) String() string {
+	if f.thrown == nil {
+		return fmt.Sprintf("%s: %s", f.kind, f.message)
+	}
+	return fmt.Sprint(f.thrown)
+}
+
+func (f *fault) property(name string) (any, bool) {
+	switch name {
+	case "kind":
+		return f.kind, true
+	case "message":
+		return f.message, true
+	case "value":
+		if f.thrown == nil {
+			return f.message, true
+		}
+		return f.thrown, true
+	case "stack":
+		stack := make(list, len(f.stack))
+		for index, frame := range f.stack {
+			stack[index] = frame.String()
+		}
+		return stack, true
+	case "line":
+		if len(f.stack) == 0 || f.stack[0].Location.Line < 0 {
+			return 0.0, true
+		}
+		return float64(f.stack[0].Location.Line + 1), true
+	case "column":
+		if len(f.stack) == 0 || f.stack[0].Location.Line < 0 {
+			return 0.0, true
+		}
+		return float64(f.stack[0].Location.Column + 1), true
+	}
+	return nil, false
+}
+
+// caught returns the value which is passed to the catch clause handling e.
+// Thrown values other than errors are wrapped, their kind is the name of their class or Error.
+func (e Exception) caught() *fault {
+	if f, ok := e.Value.(*fault); ok {
+		caught := *f
+		caught.stack = e.StackTrace
+		return &caught
+	}
+
+	kind := errorKindError
+	if instance, ok := e.Value.(*instance); ok {
+		kind = instance.class.name
+	}
+	return &fault{
+		kind:    kind,
+		message: fmt.Sprint(e.Value),
+		thrown:  e.Value,
+		stack:   e.StackTrace,
+	}
+}
+
+// unwrapFault returns the thrown value if value is a caught exception wrapping one, so that operators,
+// subscripts and builtin functions treat the caught exception like the thrown value. Other values are returned as is.
+func unwrapFault(value any) any {
+	if f, ok := value.(*fault); ok && f.thrown != nil {
+		return f.thrown
+	}
+	return value
+}
+
+// unwrapFaults replaces all caught exceptions in args, which are passed to a builtin function, by their thrown values.
+func unwrapFaults(args []any) {
+	for index, arg := range args {
+		args[index] = unwrapFault(arg)
+	}
+}
+
+// rethrow returns the error which caused f. It is used if no catch clause handles f.
+func (f *fault) rethrow() error {
+	if f.runtimeError != nil {
+		err := *f.runtimeError
+		err.stack = f.stack
+		return err
+	}
+	if f.thrown != nil {
+		return Exception{
+			StackTrace: f.stack,
+			Value:      f.thrown,
+		}
+	}
+	return Exception{
+		StackTrace: f.stack,
+		Value:      f,
+	}
+}
+
+// asException returns err as an exception if it can be caught by a try statement.
+func asException(err error) (Exception, bool) {
+	switch e := err.(type) {
+	case Exception:
+		return e, true
+	case RuntimeError:
+		return e.exception(), true
+	}
+	return Exception{}, false
+}
+
+// exception converts r to an exception, which can be caught by a try statement.
+func (r RuntimeError) exception() Exception {
+	return Exception{
+		StackTrace: r.stack,
+		Value: &fault{
+			kind:         r.Kind,
+			message:      r.Message,
+			runtimeError: &r,
+		},
+	}
+}
+
+func (c CallError) kind() string {
+	if c.Kind == "" {
+		return errorKindError
+	}
+	return c.Kind
+}
@@ -0,0 +1,314 @@
+package interpreter
+
+import (
+	"io"
+	"strings"
+)
+
+type frameKind int
+
+const (
+	frameBlock frameKind = iota
+	frameParen
+	frameBracket
+	frameMap
+)
+
+// frame is a block or bracket which is currently open.
+type frame struct {
+	kind frameKind
+	// the indentation of the line containing the opening token
+	indent int
+	// blocks of anonymous functions are part of an expression
+	statement bool
+	// the number of '?' without their ':' in this frame
+	ternaries int
+}
+
+// formattedToken is a token which has already been written together with its role.
+type formattedToken struct {
+	token      Token
+	blockOpen  bool
+	blockClose bool
+	// the token is a closing brace which ends a statement
+	statementEnd bool
+	// the token ends an operand, so a following '-' is a binary operator
+	operandEnd bool
+	unary      bool
+	// the token is the colon after the patterns of a case
+	caseColon bool
+}
+
+type formatter struct {
+	tokens   []Token
+	out      strings.Builder
+	stack    []frame
+	prev     *formattedToken
+	prevCode *formattedToken
+	// the indentation of the current line
+	indent int
+	// set after 'func' of an anonymous function until its body is opened
+	anonymousFunc bool
+	// set after 'case' until the colon after its patterns
+	inCase bool
+}
+
+// Format returns the canonical formatting of source.
+// Comments and the line breaks inside of statements and expressions are preserved.
+// An error is returned if source is not syntactically valid.
+func Format(source io.Reader, path string) (string, error) {
+	tokens, err := scan(source, path, true)
+	if err != nil {
+		return "", err
+	}
+
+	code := make([]Token, 0, len(tokens))
+	for _, t := range tokens {
+		if t.Type != COMMENT {
+			code = append(code, t)
+		}
+	}
+	_, errs := Parse(code)
+	if len(errs) > 0 {
+		return "", errorList(errs)
+	}
+
+	f := &formatter{
+		tokens: tokens[:len(tokens)-1],
+		stack: []frame{{
+			kind:      frameBlock,
+			indent:    -1,
+			statement: true,
+		}},
+	}
+	for _, t := range f.tokens {
+		f.write(t)
+	}
+	if f.prev != nil {
+		f.out.WriteByte('\n')
+	}
+	return f.out.String(), nil
+}
+
+func (f *formatter) write(t Token) {
+	top := &f.stack[len(f.stack)-1]
+	current := formattedToken{
+		token: t,
+	}
+
+	switch t.Type {
+	case OPEN_BRACE:
+		if f.isBlock() {
+			current.blockOpen = true
+		}
+	case CLOSE_BRACE:
+		current.blockClose = top.kind == frameBlock
+		current.statementEnd = current.blockClose && top.statement
+	case MINUS:
+		current.unary = f.prevCode == nil || !f.prevCode.operandEnd
+	case BANG:
+		current.unary = true
+	case CASE:
+		f.inCase = true
+	case COLON:
+		if f.inCase && top.kind == frameBlock && top.ternaries == 0 {
+			current.caseColon = true
+			f.inCase = false
+		}
+	}
+
+	switch {
+	case f.prev == nil:
+	case f.newLine(t, current):
+		f.out.WriteByte('\n')
+		if f.blankLine(t) {
+			f.out.WriteByte('\n')
+		}
+		f.indent = f.lineIndent(t)
+		f.out.WriteString(strings.Repeat("\t", f.indent))
+	case f.space(t, current):
+		f.out.WriteByte(' ')
+	}
+
+	if t.Type == COMMENT {
+		lines := strings.Split(t.Lexeme, "\n")
+		for i := range lines {
+			lines[i] = strings.TrimRight(lines[i], " \t")
+		}
+		f.out.WriteString(strings.Join(lines, "\n"))
+	} else {
+		f.out.WriteString(t.Lexeme)
+	}
+
+	switch t.Type {
+	case FUNC:
+		f.anonymousFunc = false
+	case OPEN_PAREN:
+		if f.prevCode != nil && f.prevCode.token.Type == FUNC {
+			f.anonymousFunc = true
+		}
+		f.stack = append(f.stack, frame{kind: frameParen, indent: f.indent})
+	case OPEN_BRACKET:
+		f.stack = append(f.stack, frame{kind: frameBracket, indent: f.indent})
+	case OPEN_BRACE:
+		if current.blockOpen {
+			f.stack = append(f.stack, frame{kind: frameBlock, indent: f.indent, statement: !f.anonymousFunc})
+			f.anonymousFunc = false
+		} else {
+			f.stack = append(f.stack, frame{kind: frameMap, indent: f.indent})
+		}
+	case CLOSE_PAREN, CLOSE_BRACKET, CLOSE_BRACE:
+		if len(f.stack) > 1 {
+			f.stack = f.stack[:len(f.stack)-1]
+		}
+	case INTERPOLATION, STRING:
+		// interpolated expressions are formatted like expressions in parentheses
+		if isTemplateContinuation(t) && len(f.stack) > 1 {
+			f.stack = f.stack[:len(f.stack)-1]
+		}
+		if t.Type == INTERPOLATION {
+			f.stack = append(f.stack, frame{kind: frameParen, indent: f.indent})
+		}
+	case QUESTION_MARK:
+		top.ternaries++
+	case COLON:
+		if top.ternaries > 0 {
+			top.ternaries--
+		}
+	}
+
+	switch t.Type {
+	case IDENTIFIER, NUMBER, STRING, TRUE, FALSE, THIS, CLOSE_PAREN, CLOSE_BRACKET, PLUS_PLUS, MINUS_MINUS:
+		current.operandEnd = true
+	case CLOSE_BRACE:
+		current.operandEnd = !current.statementEnd
+	}
+
+	f.prev = &current
+	if t.Type != COMMENT {
+		f.prevCode = &current
+	}
+}
+
+// isBlock reports whether the '{' which is written next opens a block instead of a map.
+func (f *formatter) isBlock() bool {
+	if f.prevCode == nil {
+		return true
+	}
+	switch f.prevCode.token.Type {
+	case CLOSE_PAREN, NUMBER, IDENTIFIER, ELSE, TRY, CATCH, FINALLY, THROWS, SEMICOLON:
+		return true
+	case OPEN_BRACE:
+		return f.prevCode.blockOpen
+	case CLOSE_BRACE:
+		return f.prevCode.blockClose
+	case COLON:
+		return f.prevCode.caseColon
+	}
+	return false
+}
+
+func (f *formatter) newLine(t Token, current formattedToken) bool {
+	prev := f.prev
+	if prev.token.Type == COMMENT && strings.HasPrefix(prev.token.Lexeme, "//") {
+		return true
+	}
+	if t.Type == COMMENT && t.Line == endLine(prev.token) {
+		return false
+	}
+	if prev.token.Type == SEMICOLON && f.stack[len(f.stack)-1].kind == frameBlock {
+		return true
+	}
+	if prev.blockOpen {
+		return !current.blockClose
+	}
+	if current.blockClose {
+		return true
+	}
+	if prev.statementEnd {
+		return t.Type != ELSE && t.Type != CATCH && t.Type != FINALLY && t.Type != SEMICOLON
+	}
+	if current.blockOpen || t.Type == SEMICOLON || (t.Type == ELSE || t.Type == CATCH || t.Type == FINALLY) && f.prevCode.blockClose {
+		return false
+	}
+	return t.Line > endLine(prev.token)
+}
+
+// blankLine reports whether an empty line should be inserted before t, which starts a new line.
+// At most one empty line of the source is kept and none at the beginning or end of blocks and brackets.
+func (f *formatter) blankLine(t Token) bool {
+	switch f.prev.token.Type {
+	case OPEN_BRACE, OPEN_PAREN, OPEN_BRACKET:
+		return false
+	}
+	switch t.Type {
+	case CLOSE_BRACE, CLOSE_PAREN, CLOSE_BRACKET:
+		return false
+	}
+	return t.Line-endLine(f.prev.token) > 1
+}
+
+func (f *formatter) lineIndent(t Token) int {
+	top := f.stack[len(f.stack)-1]
+	switch t.Type {
+	case CLOSE_BRACE, CLOSE_PAREN, CLOSE_BRACKET:
+		return top.indent
+	}
+
+	indent := top.indent + 1
+	if top.kind == frameBlock && f.prevCode != nil && f.prevCode.token.Type != SEMICOLON && !f.prevCode.blockOpen && !f.prevCode.statementEnd {
+		// continuation of a statement
+		indent++
+	}
+	return indent
+}
+
+func (f *formatter) space(t Token, current formattedToken) bool {
+	prev := f.prev
+	if t.Type == COMMENT {
+		return true
+	}
+	switch t.Type {
+	case COMMA, SEMICOLON, CLOSE_PAREN, CLOSE_BRACKET, DOT, PLUS_PLUS, MINUS_MINUS:
+		return false
+	}
+	if isTemplateContinuation(t) {
+		return false
+	}
+	if prev.token.Type == COMMENT {
+		return true
+	}
+	switch prev.token.Type {
+	case OPEN_PAREN, OPEN_BRACKET, DOT, INTERPOLATION:
+		return false
+	}
+	if prev.unary {
+		return false
+	}
+
+	if prev.token.Type == OPEN_BRACE && !prev.blockOpen {
+		return false
+	}
+	if t.Type == CLOSE_BRACE && (!current.blockClose || prev.blockOpen) {
+		return false
+	}
+
+	switch t.Type {
+	case OPEN_PAREN:
+		return !prev.operandEnd && prev.token.Type != FUNC
+	case OPEN_BRACKET:
+		return !prev.operandEnd
+	case COLON:
+		// the colons of maps are only followed by a space
+		return f.stack[len(f.stack)-1].ternaries > 0
+	}
+	return true
+}
+
+// endLine returns the line on which t ends.
+func endLine(t Token) int {
+	if t.Type == COMMENT {
+		return t.Line + strings.Count(t.Lexeme, "\n")
+	}
+	return t.Line
+}
@@ -0,0 +1,92 @@
+package interpreter_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Bananenpro/crab/interpreter"
+)
+
+// format formats source and fails the test if it isn't valid.
+func format(t *testing.T, source string) string {
+	t.Helper()
+	formatted, err := interpreter.Format(strings.NewReader(source), "test.cb")
+	if err != nil {
+		t.Fatalf("format: %s", err)
+	}
+	return formatted
+}
+
+// TestFormat checks the formatting of source and that formatting formatted code doesn't change it.
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{
+			name:   "spacing",
+			source: "func main()   {   var a=1+2*-3; if(a>1){println( a );}}",
+			want:   "func main() {\n\tvar a = 1 + 2 * -3;\n\tif (a > 1) {\n\t\tprintln(a);\n\t}\n}\n",
+		},
+		{
+			name:   "nested block comments",
+			source: "/* outer /* nested */ still outer */\nfunc main() {\n/* a\n   b */\n}\n",
+			want:   "/* outer /* nested */ still outer */\nfunc main() {\n\t/* a\n   b */\n}\n",
+		},
+		{
+			name:   "trailing line comments",
+			source: "func main()   {   // after brace\n  var a = 1;   // trailing\n\tprintln(a); /* end */\n}\n// last\n",
+			want:   "func main() { // after brace\n\tvar a = 1; // trailing\n\tprintln(a); /* end */\n}\n// last\n",
+		},
+		{
+			name:   "comments inside expressions",
+			source: "func main() {\n\tvar a = 1 + /* inline */ 2;\n\tvar b = [1, // first\n\t\t2];\n\tprintln(a, /* second */ b);\n}\n",
+			want:   "func main() {\n\tvar a = 1 + /* inline */ 2;\n\tvar b = [1, // first\n\t\t2];\n\tprintln(a, /* second */ b);\n}\n",
+		},
+		{
+			name:   "blank lines",
+			source: "\n\n// header\n\n\n\nfunc main() {\n\n\tvar a = 1;\n\n\n\n\tprintln(a);\n\n}\n\n\n",
+			want:   "// header\n\nfunc main() {\n\tvar a = 1;\n\n\tprintln(a);\n}\n",
+		},
+		{
+			name:   "match cases",
+			source: "func main() {\n\tmatch (1) {\n\t\tcase 1: { println(1); } // one\n\t\tcase _: {\n\t\t\t// nothing\n\t\t}\n\t}\n}\n",
+			want:   "func main() {\n\tmatch (1) {\n\t\tcase 1: {\n\t\t\tprintln(1);\n\t\t} // one\n\t\tcase _: {\n\t\t\t// nothing\n\t\t}\n\t}\n}\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := format(t, test.source)
+			if got != test.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, test.want)
+			}
+			if again := format(t, got); again != got {
+				t.Errorf("formatting again changed the result:\n%s", again)
+			}
+		})
+	}
+}
+
+// TestFormatExamples checks that formatting the formatted examples doesn't change them.
+func TestFormatExamples(t *testing.T) {
+	paths, err := filepath.Glob("../examples/*.cb")
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no examples found: %v", err)
+	}
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			source, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			formatted := format(t, string(source))
+			if again := format(t, formatted); again != formatted {
+				t.Errorf("formatting again changed the result:\n%s", again)
+			}
+		})
+	}
+}
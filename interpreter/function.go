@@ -1,25 +1,19 @@
 package interpreter
 
+import "fmt"
+
 type Callable interface {
 	ArgumentCount() int
 	ReturnValueCount() int
 	Throws() bool
-	Call(i *interpreter, args []any) (any, error)
-}
-
-type Return struct {
-	Values []any
-}
-
-func (r Return) Error() string {
-	return "return"
+	Call(i *Interpreter, args []any) (any, error)
 }
 
 type function struct {
 	name             Token
 	body             Stmt
 	closure          *Environment
-	parameters       []string
+	parameters       []Token
 	returnValueCount int
 	throws           bool
 }
@@ -38,27 +32,52 @@ func (f function) ReturnValueCount() int {
 	return f.returnValueCount
 }
 
-func (f function) Call(i *interpreter, args []any) (any, error) {
+func (f function) String() string {
+	if f.name.Type != IDENTIFIER {
+		return "<func <anonymous>>"
+	}
+	return fmt.Sprintf("<func %s>", f.name.Lexeme)
+}
+
+func (f function) Call(i *Interpreter, args []any) (any, error) {
+	err := i.enterFunction()
+	if err != nil {
+		return nil, err
+	}
+	defer i.leaveFunction()
+
 	prevEnv := i.env
+	prevFunction := i.function
 	i.env = f.closure
+	i.function = "<anonymous>"
+	if f.name.Type == IDENTIFIER {
+		i.function = f.name.Lexeme
+	}
 	i.beginScope()
 	for index, a := range f.parameters {
-		i.env.Define(a, args[index])
+		i.env.Define(a.Lexeme, args[index])
+	}
+	if i.debugger != nil {
+		i.debugger.enterFunction(i.function)
+		defer i.debugger.leaveFunction()
+	}
+	if i.profiler != nil {
+		i.profiler.enterFunction(i.function, f.name)
+		defer i.profiler.leaveFunction()
 	}
 
-	err := f.body.Accept(i)
+	deferredBase := len(i.deferred)
+	c, err := i.execute(f.body)
+	if c.kind == completionThrow {
+		err = c.value.(error)
+	}
+	err = i.runDeferred(deferredBase, err)
 
 	i.env = prevEnv
+	i.function = prevFunction
 
-	if ret, ok := err.(Return); ok {
-		if len(ret.Values) == 0 {
-			return nil, nil
-		}
-		if len(ret.Values) == 1 {
-			return ret.Values[0], nil
-		}
-		return multiValueReturn(ret.Values), nil
+	if err != nil {
+		return nil, err
 	}
-
-	return nil, err
+	return c.value, nil
 }
@@ -1,91 +1,286 @@
 package interpreter
 
 import (
-	"errors"
+	"bufio"
 	"fmt"
+	"io"
 	"math"
+	"os"
 	"strings"
 )
 
-type interpreter struct {
-	lines [][]rune
-	env   *Environment
+// Interpreter executes crab programs. It is passed to every Callable, so native functions can access the input and output of the program.
+type Interpreter struct {
+	env     *Environment
+	modules map[*module]namespace
+	// set if the program is executed by the virtual machine
+	vm     *vm
+	stdin  *bufio.Reader
+	stdout io.Writer
+	// functions registered by the host program in addition to nativeFunctions
+	natives map[string]Callable
+	limits  Limits
+	// the resources used so far
+	steps  int
+	depth  int
+	memory int
+	// the name of the function which is currently executed by the tree-walking interpreter
+	function string
+	// the calls delayed by defer statements of all active functions of the tree-walking interpreter
+	deferred []deferredCall
+	// set if the program is executed by a debugger
+	debugger *Debugger
+	// set if the program is profiled
+	profiler *profiler
+	// set if the coverage of the program is measured
+	coverage *Coverage
 }
 
-type LoopControl struct {
-	Type TokenType
+// deferredCall is a call delayed by a defer statement until the enclosing function returns.
+type deferredCall struct {
+	callable  Callable
+	args      []any
+	openParen Token
 }
 
-func (l LoopControl) Error() string {
-	return string(l.Type)
+func newInterpreter(stdin io.Reader, stdout io.Writer, natives map[string]Callable) *Interpreter {
+	i := &Interpreter{
+		modules:  make(map[*module]namespace),
+		stdin:    bufio.NewReader(stdin),
+		stdout:   stdout,
+		natives:  natives,
+		function: "<script>",
+	}
+	i.env = i.newGlobalEnvironment()
+	return i
+}
+
+// Stdin returns the reader the program reads its input from.
+func (i *Interpreter) Stdin() *bufio.Reader {
+	return i.stdin
+}
+
+// Stdout returns the writer the program writes its output to.
+func (i *Interpreter) Stdout() io.Writer {
+	return i.stdout
+}
+
+type completionKind int
+
+const (
+	completionNormal completionKind = iota
+	completionBreak
+	completionContinue
+	completionReturn
+	completionThrow
+)
+
+// completion is the result of executing a statement of the tree-walking interpreter.
+// Statements which transfer control, e.g. return or break, complete abruptly until the enclosing function,
+// loop or try statement handles them. Runtime errors and exceptions of called functions are returned as errors
+// instead, because they also propagate through native functions.
+type completion struct {
+	kind completionKind
+	// the return value, which is a multiValueReturn for multiple values, or the thrown Exception
+	value any
+}
+
+// StackFrame is a location in the call stack.
+type StackFrame struct {
+	// Function is the name of the function containing Location.
+	Function string
+	Location Token
+}
+
+func (s StackFrame) String() string {
+	location := fmt.Sprintf("%d:%d", s.Location.Line+1, s.Location.Column+1)
+	if s.Location.path() != "" {
+		location = fmt.Sprintf("%s:%s", s.Location.path(), location)
+	}
+	return fmt.Sprintf("%s (%s)", s.Function, location)
 }
 
 type Exception struct {
-	StackTrace  []int // line numbers most detailed to most general
-	Value       any
-	interpreter *interpreter
+	StackTrace []StackFrame // frames most detailed to most general
+	Value      any
 }
 
-func (i *interpreter) NewException(value any, line int) Exception {
-	return Exception{
-		StackTrace:  []int{line},
-		Value:       value,
-		interpreter: i,
+// NewException returns an exception thrown at location in the function which is currently executed.
+func (i *Interpreter) NewException(value any, location ...Token) Exception {
+	exception := Exception{
+		Value: value,
+	}
+	for _, l := range location {
+		exception.StackTrace = i.appendFrame(exception.StackTrace, l)
 	}
+	return exception
+}
+
+// appendFrame appends location in the function which is currently executed to stack.
+// Unknown locations, e.g. of functions called by the host program, are skipped.
+func (i *Interpreter) appendFrame(stack []StackFrame, location Token) []StackFrame {
+	if location.Line < 0 {
+		return stack
+	}
+	return append(stack, StackFrame{
+		Function: i.currentFunction(),
+		Location: location,
+	})
+}
+
+func (i *Interpreter) currentFunction() string {
+	if i.vm != nil {
+		if len(i.vm.frames) == 0 {
+			return ""
+		}
+		return i.vm.frames[len(i.vm.frames)-1].closure.proto.name
+	}
+	return i.function
 }
 
 func (e Exception) Error() string {
 	text := fmt.Sprintf("Exception: %v", e.Value)
 
 	for i := len(e.StackTrace) - 1; i >= 0; i-- {
-		if e.StackTrace[i] >= 0 {
-			text = fmt.Sprintf("%s\n[%d] %s", text, e.StackTrace[i], strings.TrimSpace(string(e.interpreter.lines[e.StackTrace[i]])))
+		token := e.StackTrace[i].Location
+		location := fmt.Sprint(token.Line + 1)
+		if token.path() != "" {
+			location = fmt.Sprintf("%s:%d", token.path(), token.Line+1)
 		}
+		text = fmt.Sprintf("%s\n[%s] in %s: %s", text, location, e.StackTrace[i].Function, strings.TrimSpace(string(token.lineText())))
 	}
 	return text
 }
 
-func Interpret(program []Stmt, lines [][]rune) error {
-	interpreter := &interpreter{
-		lines: lines,
-		env:   NewEnvironment(nil),
-	}
+func Interpret(program []Stmt, limits Limits) error {
+	return InterpretFunction(program, "main", limits)
+}
 
-	for name, callable := range nativeFunctions {
-		interpreter.env.Define(name, callable)
-	}
+// InterpretFunction executes all top-level statements of program and calls the function name without any arguments.
+func InterpretFunction(program []Stmt, name string, limits Limits) error {
+	interpreter := newInterpreter(os.Stdin, os.Stdout, nil)
+	interpreter.limits = limits
+	return interpreter.run(program, name)
+}
+
+// InterpretWithProfile executes program like Interpret and measures how much time it spends in each function and line.
+// The profile is also returned if the program failed.
+func InterpretWithProfile(program []Stmt, limits Limits) (*Profile, error) {
+	interpreter := newInterpreter(os.Stdin, os.Stdout, nil)
+	interpreter.limits = limits
+	interpreter.profiler = newProfiler()
+	err := interpreter.run(program, "main")
+	return interpreter.profiler.finish(), err
+}
 
+// InterpretFunctionWithCoverage executes program like InterpretFunction and counts how often its statements and branches are executed.
+// Only statements and branches registered with coverage.Add are counted.
+func InterpretFunctionWithCoverage(program []Stmt, name string, limits Limits, coverage *Coverage) error {
+	interpreter := newInterpreter(os.Stdin, os.Stdout, nil)
+	interpreter.limits = limits
+	interpreter.coverage = coverage
+	return interpreter.run(program, name)
+}
+
+func (i *Interpreter) run(program []Stmt, name string) error {
 	for _, stmt := range program {
-		err := stmt.Accept(interpreter)
+		err := i.executeTopLevel(stmt)
 		if err != nil {
 			return err
 		}
 	}
 
-	if !interpreter.env.Exists("main") {
-		return errors.New("No main function.")
+	if !i.env.Exists(name) {
+		return fmt.Errorf("No %s function.", name)
 	}
-	main := interpreter.env.Get("main", 0)
-	mainFunc, ok := main.(function)
-	if !ok || mainFunc.ArgumentCount() != 0 {
-		return errors.New("No main function.")
+	fn, ok := i.env.Get(name, 0, -1).(function)
+	if !ok || fn.ArgumentCount() != 0 {
+		return fmt.Errorf("No %s function.", name)
 	}
 
-	_, err := mainFunc.Call(interpreter, nil)
+	_, err := fn.Call(i, nil)
 	return err
 }
 
-func (i *interpreter) VisitExpression(stmt *StmtExpression) error {
-	_, err := stmt.Expr.Accept(i)
+func (i *Interpreter) newGlobalEnvironment() *Environment {
+	env := NewEnvironment(nil)
+	for name, callable := range nativeFunctions {
+		env.Define(name, callable)
+	}
+	for name, callable := range i.natives {
+		env.Define(name, callable)
+	}
+	return env
+}
+
+// execute executes stmt after giving the debugger the chance to pause the program.
+// It also counts the execution if the coverage is measured and measures its time if the program is profiled.
+// Every execution is a step of the step limit.
+func (i *Interpreter) execute(stmt Stmt) (completion, error) {
+	if err := i.stepStatement(stmt); err != nil {
+		return completion{}, err
+	}
+	if i.debugger != nil {
+		if err := i.debugger.beforeStatement(stmt); err != nil {
+			return completion{}, err
+		}
+	}
+	if i.coverage != nil {
+		i.coverage.statement(stmt)
+	}
+	if i.profiler != nil && i.profiler.beforeStatement(stmt) {
+		c, err := stmt.execute(i)
+		i.profiler.afterStatement()
+		return c, err
+	}
+	return stmt.execute(i)
+}
+
+// executeTopLevel executes stmt outside of a function, e.g. a declaration of the program or a module.
+// Only a throw statement can complete it abruptly there, whose exception is returned as an error.
+func (i *Interpreter) executeTopLevel(stmt Stmt) error {
+	c, err := i.execute(stmt)
+	if err == nil && c.kind == completionThrow {
+		return c.value.(error)
+	}
 	return err
 }
 
-func (i *interpreter) VisitVarDecl(stmt *StmtVarDecl) error {
+// branch counts whether the condition of the branch at location was true if the coverage is measured and returns taken.
+func (i *Interpreter) branch(location Token, taken bool) bool {
+	if i.coverage != nil {
+		i.coverage.branch(location, taken)
+	}
+	return taken
+}
+
+// loopBody executes the body of a loop. It reports whether the loop continues with its next iteration
+// and otherwise returns the completion of the loop.
+func (i *Interpreter) loopBody(body Stmt) (bool, completion, error) {
+	c, err := i.execute(body)
+	if err != nil {
+		return false, completion{}, err
+	}
+	switch c.kind {
+	case completionNormal, completionContinue:
+		return true, completion{}, nil
+	case completionBreak:
+		return false, completion{}, nil
+	}
+	return false, c, nil
+}
+
+func (i *Interpreter) executeExpression(stmt *StmtExpression) (completion, error) {
+	_, err := stmt.Expr.Accept(i)
+	return completion{}, err
+}
+
+func (i *Interpreter) executeVarDecl(stmt *StmtVarDecl) (completion, error) {
 	values := make([]any, 1)
 	if stmt.Expr != nil {
 		value, err := stmt.Expr.Accept(i)
 		if err != nil {
-			return err
+			return completion{}, err
 		}
 		if ret, ok := value.(multiValueReturn); ok {
 			values = ret
@@ -95,23 +290,23 @@ func (i *interpreter) VisitVarDecl(stmt *StmtVarDecl) error {
 	}
 
 	if len(values) != len(stmt.Names) {
-		return i.newError(fmt.Sprintf("Cannot assign %d value/s to %d variable/s.", len(values), len(stmt.Names)), stmt.Operator)
+		return completion{}, i.newError(errorKindType, fmt.Sprintf("Cannot assign %d values to %d variables.", len(values), len(stmt.Names)), stmt.Operator)
 	}
 
 	for index, name := range stmt.Names {
 		err := i.env.Define(name.Lexeme, values[index])
 		if err != nil {
 			if err == ErrAlreadyDefined {
-				return i.newError(fmt.Sprintf("'%s' is already defined in this scope", name.Lexeme), name)
+				return completion{}, i.newError(errorKindName, fmt.Sprintf("'%s' is already defined in this scope", name.Lexeme), name)
 			}
-			return i.newError(err.Error(), name)
+			return completion{}, i.newError(errorKindName, err.Error(), name)
 		}
 	}
 
-	return nil
+	return completion{}, nil
 }
 
-func (i *interpreter) VisitFuncDecl(stmt *StmtFuncDecl) error {
+func (i *Interpreter) executeFuncDecl(stmt *StmtFuncDecl) (completion, error) {
 	err := i.env.Define(stmt.Name.Lexeme, function{
 		name:             stmt.Name,
 		body:             stmt.Body,
@@ -122,194 +317,352 @@ func (i *interpreter) VisitFuncDecl(stmt *StmtFuncDecl) error {
 	})
 	if err != nil {
 		if err == ErrAlreadyDefined {
-			return i.newError(fmt.Sprintf("'%s' is already defined in this scope", stmt.Name.Lexeme), stmt.Name)
+			return completion{}, i.newError(errorKindName, fmt.Sprintf("'%s' is already defined in this scope", stmt.Name.Lexeme), stmt.Name)
 		}
-		return i.newError(err.Error(), stmt.Name)
+		return completion{}, i.newError(errorKindName, err.Error(), stmt.Name)
 	}
-	return nil
+	return completion{}, nil
+}
+
+func (i *Interpreter) executeClass(stmt *StmtClass) (completion, error) {
+	c := &class{
+		name:       stmt.Name.Lexeme,
+		fields:     make([]string, 0, len(stmt.Fields)),
+		methods:    make(map[string]Callable, len(stmt.Methods)),
+		fieldDecls: stmt.Fields,
+		closure:    i.env,
+	}
+	for _, field := range stmt.Fields {
+		for _, name := range field.Names {
+			c.fields = append(c.fields, name.Lexeme)
+		}
+	}
+	for _, m := range stmt.Methods {
+		method := function{
+			name:             m.Name,
+			body:             m.Body,
+			closure:          i.env,
+			parameters:       m.Parameters,
+			returnValueCount: m.ReturnValueCount,
+			throws:           m.Throws,
+		}
+		if m.Name.Lexeme == "init" {
+			c.constructor = method
+		} else {
+			c.methods[m.Name.Lexeme] = method
+		}
+	}
+
+	err := i.env.Define(stmt.Name.Lexeme, c)
+	if err != nil {
+		if err == ErrAlreadyDefined {
+			return completion{}, i.newError(errorKindName, fmt.Sprintf("'%s' is already defined in this scope", stmt.Name.Lexeme), stmt.Name)
+		}
+		return completion{}, i.newError(errorKindName, err.Error(), stmt.Name)
+	}
+	return completion{}, nil
 }
 
-func (i *interpreter) VisitIf(stmt *StmtIf) error {
+func (i *Interpreter) executeIf(stmt *StmtIf) (completion, error) {
 	condition, err := stmt.Condition.Accept(i)
 	if err != nil {
-		return err
+		return completion{}, err
 	}
 
 	err = i.errorIfMultiValue(condition, stmt.Keyword)
 	if err != nil {
-		return err
+		return completion{}, err
 	}
 
-	if isTruthy(condition) {
-		return stmt.Body.Accept(i)
+	if i.branch(stmt.Keyword, isTruthy(condition)) {
+		return i.execute(stmt.Body)
 	} else if stmt.ElseBody != nil {
-		return stmt.ElseBody.Accept(i)
+		return i.execute(stmt.ElseBody)
 	}
-	return nil
+	return completion{}, nil
 }
 
-func (i *interpreter) VisitWhile(stmt *StmtWhile) error {
+func (i *Interpreter) executeWhile(stmt *StmtWhile) (completion, error) {
 	condition, err := stmt.Condition.Accept(i)
 	if err != nil {
-		return err
+		return completion{}, err
 	}
 
 	err = i.errorIfMultiValue(condition, stmt.Keyword)
 	if err != nil {
-		return err
+		return completion{}, err
 	}
 
-	for isTruthy(condition) {
-		err = stmt.Body.Accept(i)
-		loopControl, ok := err.(LoopControl)
-		if ok {
-			if loopControl.Type == BREAK {
-				break
-			}
-		} else if err != nil {
-			return err
+	for i.branch(stmt.Keyword, isTruthy(condition)) {
+		next, c, err := i.loopBody(stmt.Body)
+		if !next {
+			return c, err
 		}
 		condition, err = stmt.Condition.Accept(i)
 		if err != nil {
-			return err
+			return completion{}, err
 		}
 		err = i.errorIfMultiValue(condition, stmt.Keyword)
 		if err != nil {
-			return err
+			return completion{}, err
 		}
 	}
-	return nil
+	return completion{}, nil
 }
 
-func (i *interpreter) VisitFor(stmt *StmtFor) error {
-	err := stmt.Initializer.Accept(i)
+func (i *Interpreter) executeFor(stmt *StmtFor) (completion, error) {
+	_, err := stmt.Initializer.execute(i)
 	if err != nil {
-		return err
+		return completion{}, err
 	}
 
 	condition, err := stmt.Condition.Accept(i)
 	if err != nil {
-		return err
+		return completion{}, err
 	}
 	err = i.errorIfMultiValue(condition, stmt.Keyword)
 	if err != nil {
-		return err
+		return completion{}, err
 	}
 
-	for isTruthy(condition) {
-		err = stmt.Body.Accept(i)
-		loopControl, ok := err.(LoopControl)
-		if ok {
-			if loopControl.Type == BREAK {
-				break
-			}
-		} else if err != nil {
-			return err
+	for i.branch(stmt.Keyword, isTruthy(condition)) {
+		next, c, err := i.loopBody(stmt.Body)
+		if !next {
+			return c, err
 		}
 		_, err = stmt.Increment.Accept(i)
 		if err != nil {
-			return err
+			return completion{}, err
 		}
 		condition, err = stmt.Condition.Accept(i)
 		if err != nil {
-			return err
+			return completion{}, err
 		}
 		err = i.errorIfMultiValue(condition, stmt.Keyword)
 		if err != nil {
-			return err
+			return completion{}, err
 		}
 	}
-	return nil
+	return completion{}, nil
 }
 
-func (i *interpreter) VisitLoopControl(stmt *StmtLoopControl) error {
-	return LoopControl{
-		Type: stmt.Keyword.Type,
+func (i *Interpreter) executeForEach(stmt *StmtForEach) (completion, error) {
+	collection, err := stmt.Collection.Accept(i)
+	if err != nil {
+		return completion{}, err
 	}
+	err = i.errorIfMultiValue(collection, stmt.In)
+	if err != nil {
+		return completion{}, err
+	}
+	it, err := i.newIterator(collection, stmt.In)
+	if err != nil {
+		return completion{}, err
+	}
+
+	for {
+		index, element, ok := it.next()
+		if !i.branch(stmt.Keyword, ok) {
+			break
+		}
+		i.beginScope()
+		if stmt.Index.Lexeme != "" {
+			i.env.Define(stmt.Index.Lexeme, float64(index))
+		}
+		i.env.Define(stmt.Element.Lexeme, element)
+		next, c, err := i.loopBody(stmt.Body)
+		i.endScope()
+		if !next {
+			return c, err
+		}
+	}
+	return completion{}, nil
 }
 
-func (i *interpreter) VisitReturn(stmt *StmtReturn) error {
-	values := make([]any, len(stmt.Values))
-	for index, v := range stmt.Values {
-		value, err := v.Accept(i)
+func (i *Interpreter) executeMatch(stmt *StmtMatch) (completion, error) {
+	value, err := stmt.Value.Accept(i)
+	if err != nil {
+		return completion{}, err
+	}
+	err = i.errorIfMultiValue(value, stmt.Keyword)
+	if err != nil {
+		return completion{}, err
+	}
+
+	for _, matchCase := range stmt.Cases {
+		bindings, ok := matchPatterns(matchCase.Patterns, value)
+		if !ok {
+			continue
+		}
+
+		i.beginScope()
+		for index, name := range patternBindings(matchCase.Patterns) {
+			i.env.Define(name.Lexeme, bindings[index])
+		}
+		if matchCase.Guard != nil {
+			guard, err := matchCase.Guard.Accept(i)
+			if err == nil {
+				err = i.errorIfMultiValue(guard, matchCase.Keyword)
+			}
+			if err != nil || !isTruthy(guard) {
+				i.endScope()
+				if err != nil {
+					return completion{}, err
+				}
+				continue
+			}
+		}
+		c, err := i.execute(matchCase.Body)
+		i.endScope()
+		return c, err
+	}
+	return completion{}, nil
+}
+
+func (i *Interpreter) executeLoopControl(stmt *StmtLoopControl) (completion, error) {
+	if stmt.Keyword.Type == BREAK {
+		return completion{kind: completionBreak}, nil
+	}
+	return completion{kind: completionContinue}, nil
+}
+
+func (i *Interpreter) executeReturn(stmt *StmtReturn) (completion, error) {
+	// a single value is returned without allocating a list of values
+	if len(stmt.Values) == 1 {
+		value, err := i.returnValue(stmt.Values[0], stmt.Keyword)
 		if err != nil {
-			return err
+			return completion{}, err
 		}
-		err = i.errorIfMultiValue(value, stmt.Keyword)
+		return completion{kind: completionReturn, value: value}, nil
+	}
+
+	values := make(multiValueReturn, len(stmt.Values))
+	for index, v := range stmt.Values {
+		value, err := i.returnValue(v, stmt.Keyword)
 		if err != nil {
-			return err
+			return completion{}, err
 		}
 		values[index] = value
 	}
-	return Return{
-		Values: values,
+	c := completion{kind: completionReturn}
+	if len(values) > 0 {
+		c.value = values
 	}
+	return c, nil
 }
 
-func (i *interpreter) VisitBlock(stmt *StmtBlock) error {
+func (i *Interpreter) returnValue(expr Expr, keyword Token) (any, error) {
+	value, err := expr.Accept(i)
+	if err != nil {
+		return nil, err
+	}
+	return value, i.errorIfMultiValue(value, keyword)
+}
+
+func (i *Interpreter) executeBlock(stmt *StmtBlock) (completion, error) {
 	i.beginScope()
 	defer i.endScope()
 
 	for _, s := range stmt.Statements {
-		err := s.Accept(i)
-		if err != nil {
-			return err
+		c, err := i.execute(s)
+		if err != nil || c.kind != completionNormal {
+			return c, err
 		}
 	}
 
-	return nil
+	return completion{}, nil
 }
 
-func (i *interpreter) VisitLiteral(expr *ExprLiteral) (any, error) {
+func (i *Interpreter) VisitLiteral(expr *ExprLiteral) (any, error) {
 	return expr.Value, nil
 }
 
-func (i *interpreter) VisitVariable(variable *ExprVariable) (any, error) {
-	return i.env.Get(variable.Name.Lexeme, variable.NestingLevel), nil
+func (i *Interpreter) VisitTemplate(expr *ExprTemplate) (any, error) {
+	var text strings.Builder
+	for _, part := range expr.Parts {
+		value, err := part.Accept(i)
+		if err != nil {
+			return nil, err
+		}
+		if err := i.errorIfMultiValue(value, expr.Start); err != nil {
+			return nil, err
+		}
+		fmt.Fprint(&text, value)
+	}
+	if err := i.allocate(text.Len(), expr.Start); err != nil {
+		return nil, err
+	}
+	return text.String(), nil
 }
 
-func (i *interpreter) VisitCall(call *ExprCall) (any, error) {
-	expr, err := call.Callee.Accept(i)
+func (i *Interpreter) VisitVariable(variable *ExprVariable) (any, error) {
+	return i.env.Get(variable.Name.Lexeme, variable.NestingLevel, variable.Slot), nil
+}
+
+func (i *Interpreter) VisitCall(call *ExprCall) (any, error) {
+	callable, args, err := i.evaluateCall(call)
 	if err != nil {
 		return nil, err
 	}
+	return i.call(callable, args, call.OpenParen)
+}
+
+// evaluateCall evaluates the callee and the arguments of call.
+func (i *Interpreter) evaluateCall(call *ExprCall) (Callable, []any, error) {
+	expr, err := call.Callee.Accept(i)
+	if err != nil {
+		return nil, nil, err
+	}
 	err = i.errorIfMultiValue(expr, call.OpenParen)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	callable, ok := expr.(Callable)
+	callable, ok := unwrapFault(expr).(Callable)
 	if !ok {
-		return nil, i.newError("Can only call functions.", call.OpenParen)
+		return nil, nil, i.newError(errorKindType, "Can only call functions.", call.OpenParen)
 	}
 
 	if callable.ArgumentCount() != -1 && callable.ArgumentCount() != len(call.Args) {
-		return nil, i.newError(fmt.Sprintf("Wrong argument count. Expected %d, got %d.", callable.ArgumentCount(), len(call.Args)), call.OpenParen)
+		return nil, nil, i.newError(errorKindType, fmt.Sprintf("Wrong argument count. Expected %d, got %d.", callable.ArgumentCount(), len(call.Args)), call.OpenParen)
 	}
 
 	args := make([]any, len(call.Args))
 	for index, a := range call.Args {
 		args[index], err = a.Accept(i)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		err = i.errorIfMultiValue(args[index], call.OpenParen)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
+	return callable, args, nil
+}
 
+// call calls callable and adds openParen to the stack trace of errors.
+func (i *Interpreter) call(callable Callable, args []any, openParen Token) (any, error) {
+	switch callable.(type) {
+	case function, *class:
+	default:
+		unwrapFaults(args)
+	}
 	value, err := callable.Call(i, args)
-	if typeError, ok := err.(CallError); ok {
-		return value, i.newError(typeError.Error(), call.OpenParen)
+	if callError, ok := err.(CallError); ok {
+		return value, i.newError(callError.kind(), callError.Message, openParen)
 	}
 	if exception, ok := err.(Exception); ok {
-		exception.StackTrace = append(exception.StackTrace, call.OpenParen.Line)
+		exception.StackTrace = i.appendFrame(exception.StackTrace, openParen)
 		return value, exception
 	}
+	if runtimeError, ok := err.(RuntimeError); ok {
+		runtimeError.stack = i.appendFrame(runtimeError.stack, openParen)
+		return value, runtimeError
+	}
 	return value, err
 }
 
-func (i *interpreter) VisitSubscript(expr *ExprSubscript) (any, error) {
+func (i *Interpreter) VisitSubscript(expr *ExprSubscript) (any, error) {
 	object, err := expr.Object.Accept(i)
 	if err != nil {
 		return nil, err
@@ -318,32 +671,127 @@ func (i *interpreter) VisitSubscript(expr *ExprSubscript) (any, error) {
 	if err != nil {
 		return nil, err
 	}
+	return i.getSubscript(object, subscript, expr.OpenBracket)
+}
+
+func (i *Interpreter) getSubscript(object, subscript any, openBracket Token) (any, error) {
+	object, subscript = unwrapFault(object), unwrapFault(subscript)
+	if m, ok := object.(hashMap); ok {
+		if message := mapKeyError(subscript); message != "" {
+			return nil, i.newError(errorKindType, message, openBracket)
+		}
+		value, ok := m[subscript]
+		if !ok {
+			return nil, i.newError(errorKindKey, "Map key does not exist.", openBracket)
+		}
+		return value, nil
+	}
 
 	if index, ok := subscript.(float64); ok && index == float64(int(index)) {
 		if l, ok := object.(list); ok {
 			if int(index) >= len(l) || index < 0 {
-				return nil, i.newError("List index out of bounds.", expr.OpenBracket)
+				return nil, i.newError(errorKindIndex, "List index out of bounds.", openBracket)
 			}
 			return l[int(index)], nil
 		}
 		if s, ok := object.(string); ok {
 			str := []rune(s)
 			if int(index) >= len(str) || index < 0 {
-				return nil, i.newError("String index out of bounds.", expr.OpenBracket)
+				return nil, i.newError(errorKindIndex, "String index out of bounds.", openBracket)
 			}
 			return string(str[int(index)]), nil
 		}
-		return nil, i.newError("Can only use subscript operator on strings and lists.", expr.OpenBracket)
+		return nil, i.newError(errorKindType, "Can only use subscript operator on strings, lists and maps.", openBracket)
 	}
 
-	return nil, i.newError("Subscript not an integer.", expr.OpenBracket)
+	return nil, i.newError(errorKindType, "Subscript not an integer.", openBracket)
 }
 
-func (i *interpreter) VisitGrouping(expr *ExprGrouping) (any, error) {
+func (i *Interpreter) setSubscript(object, subscript, value any, openBracket Token) error {
+	object, subscript = unwrapFault(object), unwrapFault(subscript)
+	if m, ok := object.(hashMap); ok {
+		if message := mapKeyError(subscript); message != "" {
+			return i.newError(errorKindType, message, openBracket)
+		}
+		m[subscript] = value
+		return nil
+	}
+
+	if index, ok := subscript.(float64); ok && index == float64(int(index)) {
+		if l, ok := object.(list); ok {
+			if int(index) >= len(l) || index < 0 {
+				return i.newError(errorKindIndex, "List index out of bounds.", openBracket)
+			}
+			l[int(index)] = value
+			return nil
+		}
+		return i.newError(errorKindType, "Can only use subscript operator on lists and maps.", openBracket)
+	}
+	return i.newError(errorKindType, "Subscript not an integer.", openBracket)
+}
+
+func (i *Interpreter) VisitProperty(expr *ExprProperty) (any, error) {
+	object, err := expr.Object.Accept(i)
+	if err != nil {
+		return nil, err
+	}
+	return i.getProperty(object, expr.Name, expr.Dot)
+}
+
+func (i *Interpreter) getProperty(object any, name Token, dot Token) (any, error) {
+	if ns, ok := object.(namespace); ok {
+		value, ok := ns.env.names[name.Lexeme]
+		if !ok {
+			return nil, i.newError(errorKindName, fmt.Sprintf("Module '%s' has no member '%s'.", ns.path, name.Lexeme), name)
+		}
+		return value, nil
+	}
+
+	if instance, ok := object.(*instance); ok {
+		if value, ok := instance.fields[name.Lexeme]; ok {
+			return value, nil
+		}
+		if method, ok := instance.class.methods[name.Lexeme]; ok {
+			return bind(method, instance), nil
+		}
+		return nil, i.newError(errorKindName, fmt.Sprintf("Instance of '%s' has no field or method '%s'.", instance.class.name, name.Lexeme), name)
+	}
+
+	if f, ok := object.(*fault); ok {
+		if value, ok := f.property(name.Lexeme); ok {
+			return value, nil
+		}
+		if instance, ok := f.thrown.(*instance); ok {
+			return i.getProperty(instance, name, dot)
+		}
+		return nil, i.newError(errorKindName, fmt.Sprintf("Error has no property '%s'.", name.Lexeme), name)
+	}
+
+	return nil, i.newError(errorKindType, "Can only access properties of modules, instances and errors.", dot)
+}
+
+func (i *Interpreter) setProperty(object any, name Token, value any, dot Token) error {
+	object = unwrapFault(object)
+	if instance, ok := object.(*instance); ok {
+		if _, ok := instance.fields[name.Lexeme]; !ok {
+			return i.newError(errorKindName, fmt.Sprintf("Instance of '%s' has no field '%s'.", instance.class.name, name.Lexeme), name)
+		}
+		instance.fields[name.Lexeme] = value
+		return nil
+	}
+
+	if _, ok := object.(namespace); ok {
+		return i.newError(errorKindType, "Cannot assign to members of modules.", dot)
+	}
+
+	return i.newError(errorKindType, "Can only assign to fields of instances.", dot)
+}
+
+func (i *Interpreter) VisitGrouping(expr *ExprGrouping) (any, error) {
 	return expr.Expr.Accept(i)
 }
 
-func (i *interpreter) VisitList(expr *ExprList) (any, error) {
+func (i *Interpreter) VisitList(expr *ExprList) (any, error) {
 	values := make([]any, len(expr.Values))
 	var err error
 	for index, value := range expr.Values {
@@ -355,33 +803,74 @@ func (i *interpreter) VisitList(expr *ExprList) (any, error) {
 			return nil, err
 		}
 	}
+	err = i.allocate(len(values)*valueSize, expr.OpenBracket)
+	if err != nil {
+		return nil, err
+	}
 	return list(values), nil
 }
 
-func (i *interpreter) VisitUnary(expr *ExprUnary) (any, error) {
+func (i *Interpreter) VisitMap(expr *ExprMap) (any, error) {
+	values := make(hashMap, len(expr.Keys))
+	for index, k := range expr.Keys {
+		key, err := k.Accept(i)
+		if err != nil {
+			return nil, err
+		}
+		if err := i.errorIfMultiValue(key, expr.OpenBrace); err != nil {
+			return nil, err
+		}
+		key = unwrapFault(key)
+		if message := mapKeyError(key); message != "" {
+			return nil, i.newError(errorKindType, message, expr.OpenBrace)
+		}
+
+		value, err := expr.Values[index].Accept(i)
+		if err != nil {
+			return nil, err
+		}
+		if err := i.errorIfMultiValue(value, expr.OpenBrace); err != nil {
+			return nil, err
+		}
+
+		values[key] = value
+	}
+	err := i.allocate(2*len(values)*valueSize, expr.OpenBrace)
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func (i *Interpreter) VisitUnary(expr *ExprUnary) (any, error) {
 	right, err := expr.Right.Accept(i)
 	if err != nil {
 		return nil, err
 	}
-	err = i.errorIfMultiValue(right, expr.Operator)
+	return i.unary(expr.Operator, right)
+}
+
+func (i *Interpreter) unary(operator Token, right any) (any, error) {
+	err := i.errorIfMultiValue(right, operator)
 	if err != nil {
 		return nil, err
 	}
+	right = unwrapFault(right)
 
-	switch expr.Operator.Type {
+	switch operator.Type {
 	case MINUS:
 		if isNumber(right) {
 			return -right.(float64), nil
 		}
-		return nil, i.newError(fmt.Sprintf("Operand must be a number."), expr.Operator)
+		return nil, i.newError(errorKindType, fmt.Sprintf("Operand must be a number."), operator)
 	case BANG:
 		return !isTruthy(right), nil
 	default:
-		return nil, i.newError(fmt.Sprintf("Invalid unary operator '%s'.", expr.Operator.Lexeme), expr.Operator)
+		return nil, i.newError(errorKindType, fmt.Sprintf("Invalid unary operator '%s'.", operator.Lexeme), operator)
 	}
 }
 
-func (i *interpreter) VisitBinary(expr *ExprBinary) (any, error) {
+func (i *Interpreter) VisitBinary(expr *ExprBinary) (any, error) {
 	left, err := expr.Left.Accept(i)
 	if err != nil {
 		return nil, err
@@ -394,44 +883,57 @@ func (i *interpreter) VisitBinary(expr *ExprBinary) (any, error) {
 	if err != nil {
 		return nil, err
 	}
-	err = i.errorIfMultiValue(right, expr.Operator)
+	return i.binary(expr.Operator, left, right)
+}
+
+func (i *Interpreter) binary(operator Token, left, right any) (any, error) {
+	err := i.errorIfMultiValue(left, operator)
+	if err != nil {
+		return nil, err
+	}
+	err = i.errorIfMultiValue(right, operator)
 	if err != nil {
 		return nil, err
 	}
+	left, right = unwrapFault(left), unwrapFault(right)
 
-	switch expr.Operator.Type {
+	switch operator.Type {
 	case PLUS:
 		if isNumber(left, right) {
 			return left.(float64) + right.(float64), nil
 		} else if anyString(left, right) {
-			return fmt.Sprintf("%v%v", left, right), nil
+			text := fmt.Sprintf("%v%v", left, right)
+			if err := i.allocate(len(text), operator); err != nil {
+				return nil, err
+			}
+			return text, nil
 		}
-		return nil, i.newError(fmt.Sprintf("Operands must be either both numbers or at least one of them a string."), expr.Operator)
+		return nil, i.newError(errorKindType, fmt.Sprintf("Operands must be either both numbers or at least one of them a string."), operator)
 	case MINUS:
 		if isNumber(left, right) {
 			return left.(float64) - right.(float64), nil
 		}
-		return nil, i.newError(fmt.Sprintf("Both operands must be numbers."), expr.Operator)
+		return nil, i.newError(errorKindType, fmt.Sprintf("Both operands must be numbers."), operator)
 	case ASTERISK:
 		if isNumber(left, right) {
 			return left.(float64) * right.(float64), nil
 		}
-		return nil, i.newError(fmt.Sprintf("Both operands must be numbers."), expr.Operator)
+		return nil, i.newError(errorKindType, fmt.Sprintf("Both operands must be numbers."), operator)
 	case ASTERISK_ASTERISK:
 		if isNumber(left, right) {
 			return math.Pow(left.(float64), right.(float64)), nil
 		}
-		return nil, i.newError(fmt.Sprintf("Both operands must be numbers."), expr.Operator)
+		return nil, i.newError(errorKindType, fmt.Sprintf("Both operands must be numbers."), operator)
 	case SLASH:
 		if isNumber(left, right) {
 			return left.(float64) / right.(float64), nil
 		}
-		return nil, i.newError(fmt.Sprintf("Both operands must be numbers."), expr.Operator)
+		return nil, i.newError(errorKindType, fmt.Sprintf("Both operands must be numbers."), operator)
 	case PERCENT:
 		if isNumber(left, right) {
 			return math.Mod(left.(float64), right.(float64)), nil
 		}
-		return nil, i.newError(fmt.Sprintf("Both operands must be numbers."), expr.Operator)
+		return nil, i.newError(errorKindType, fmt.Sprintf("Both operands must be numbers."), operator)
 
 	case EQUAL_EQUAL:
 		return areEqual(left, right), nil
@@ -442,29 +944,29 @@ func (i *interpreter) VisitBinary(expr *ExprBinary) (any, error) {
 		if isNumber(left, right) {
 			return left.(float64) < right.(float64), nil
 		}
-		return nil, i.newError(fmt.Sprintf("Both operands must be numbers."), expr.Operator)
+		return nil, i.newError(errorKindType, fmt.Sprintf("Both operands must be numbers."), operator)
 	case LESS_EQUAL:
 		if isNumber(left, right) {
 			return left.(float64) <= right.(float64), nil
 		}
-		return nil, i.newError(fmt.Sprintf("Both operands must be numbers."), expr.Operator)
+		return nil, i.newError(errorKindType, fmt.Sprintf("Both operands must be numbers."), operator)
 	case GREATER:
 		if isNumber(left, right) {
 			return left.(float64) > right.(float64), nil
 		}
-		return nil, i.newError(fmt.Sprintf("Both operands must be numbers."), expr.Operator)
+		return nil, i.newError(errorKindType, fmt.Sprintf("Both operands must be numbers."), operator)
 	case GREATER_EQUAL:
 		if isNumber(left, right) {
 			return left.(float64) >= right.(float64), nil
 		}
-		return nil, i.newError(fmt.Sprintf("Both operands must be numbers."), expr.Operator)
+		return nil, i.newError(errorKindType, fmt.Sprintf("Both operands must be numbers."), operator)
 
 	default:
-		return nil, i.newError(fmt.Sprintf("Invalid binary operator '%s'.", expr.Operator.Lexeme), expr.Operator)
+		return nil, i.newError(errorKindType, fmt.Sprintf("Invalid binary operator '%s'.", operator.Lexeme), operator)
 	}
 }
 
-func (i *interpreter) VisitLogical(expr *ExprLogical) (any, error) {
+func (i *Interpreter) VisitLogical(expr *ExprLogical) (any, error) {
 	left, err := expr.Left.Accept(i)
 	if err != nil {
 		return nil, err
@@ -505,7 +1007,7 @@ func (i *interpreter) VisitLogical(expr *ExprLogical) (any, error) {
 	return isTruthy(right), nil
 }
 
-func (i *interpreter) VisitTernary(expr *ExprTernary) (any, error) {
+func (i *Interpreter) VisitTernary(expr *ExprTernary) (any, error) {
 	left, err := expr.Left.Accept(i)
 	if err != nil {
 		return nil, err
@@ -516,16 +1018,16 @@ func (i *interpreter) VisitTernary(expr *ExprTernary) (any, error) {
 	}
 
 	if expr.Operator1.Type != QUESTION_MARK {
-		return nil, i.newError(fmt.Sprintf("Invalid ternary operator '%s'.", expr.Operator1.Lexeme), expr.Operator1)
+		return nil, i.newError(errorKindType, fmt.Sprintf("Invalid ternary operator '%s'.", expr.Operator1.Lexeme), expr.Operator1)
 	}
 
-	if isTruthy(left) {
+	if i.branch(expr.Operator1, isTruthy(left)) {
 		return expr.Center.Accept(i)
 	}
 	return expr.Right.Accept(i)
 }
 
-func (i *interpreter) VisitAssign(expr *ExprAssign) (any, error) {
+func (i *Interpreter) VisitAssign(expr *ExprAssign) (any, error) {
 	values := make([]any, 0)
 	value, err := expr.Expr.Accept(i)
 	if err != nil {
@@ -538,12 +1040,12 @@ func (i *interpreter) VisitAssign(expr *ExprAssign) (any, error) {
 	}
 
 	if len(values) != len(expr.Assignees) {
-		return nil, i.newError(fmt.Sprintf("Cannot assign %d values to %d variables.", len(values), len(expr.Assignees)), expr.Operator)
+		return nil, i.newError(errorKindType, fmt.Sprintf("Cannot assign %d values to %d variables.", len(values), len(expr.Assignees)), expr.Operator)
 	}
 
 	for index, assignee := range expr.Assignees {
 		if v, ok := assignee.(*ExprVariable); ok {
-			i.env.Assign(v.Name.Lexeme, values[index], v.NestingLevel)
+			i.env.Assign(v.Name.Lexeme, values[index], v.NestingLevel, v.Slot)
 		} else if s, ok := assignee.(*ExprSubscript); ok {
 			object, err := s.Object.Accept(i)
 			if err != nil {
@@ -553,26 +1055,27 @@ func (i *interpreter) VisitAssign(expr *ExprAssign) (any, error) {
 			if err != nil {
 				return nil, err
 			}
-
-			if sIndex, ok := subscript.(float64); ok && sIndex == float64(int(sIndex)) {
-				if l, ok := object.(list); ok {
-					if int(sIndex) >= len(l) || sIndex < 0 {
-						return nil, i.newError("List index out of bounds.", s.OpenBracket)
-					}
-					l[int(sIndex)] = values[index]
-					continue
-				}
-				return nil, i.newError("Can only use subscript operator on lists.", s.OpenBracket)
+			err = i.setSubscript(object, subscript, values[index], s.OpenBracket)
+			if err != nil {
+				return nil, err
+			}
+		} else if p, ok := assignee.(*ExprProperty); ok {
+			object, err := p.Object.Accept(i)
+			if err != nil {
+				return nil, err
+			}
+			err = i.setProperty(object, p.Name, values[index], p.Dot)
+			if err != nil {
+				return nil, err
 			}
-			return nil, i.newError("Subscript not an integer.", s.OpenBracket)
 		} else {
-			return nil, i.newError("Can only assign to variables.", expr.Operator)
+			return nil, i.newError(errorKindType, "Can only assign to variables.", expr.Operator)
 		}
 	}
 	return value, nil
 }
 
-func (i *interpreter) VisitAnonymousFunction(expr *ExprAnonymousFunction) (any, error) {
+func (i *Interpreter) VisitAnonymousFunction(expr *ExprAnonymousFunction) (any, error) {
 	return function{
 		name:             expr.Keyword,
 		body:             expr.Body,
@@ -583,30 +1086,118 @@ func (i *interpreter) VisitAnonymousFunction(expr *ExprAnonymousFunction) (any,
 	}, nil
 }
 
-func (i *interpreter) VisitThrow(stmt *StmtThrow) error {
+func (i *Interpreter) VisitThis(expr *ExprThis) (any, error) {
+	return i.env.Get("this", expr.NestingLevel, expr.Slot), nil
+}
+
+func (i *Interpreter) executeThrow(stmt *StmtThrow) (completion, error) {
 	value, err := stmt.Value.Accept(i)
 	if err != nil {
-		return err
+		return completion{}, err
 	}
-	return i.NewException(value, stmt.Keyword.Line)
+	return completion{kind: completionThrow, value: i.NewException(value, stmt.Keyword)}, nil
 }
 
-func (i *interpreter) VisitTry(stmt *StmtTry) error {
-	err := stmt.Body.Accept(i)
-	exception, ok := err.(Exception)
+func (i *Interpreter) executeImport(stmt *StmtImport) (completion, error) {
+	ns, ok := i.modules[stmt.Module]
 	if !ok {
-		return err
+		prevEnv := i.env
+		prevFunction := i.function
+		i.env = i.newGlobalEnvironment()
+		i.function = stmt.Module.path
+		for _, s := range stmt.Module.program {
+			err := i.executeTopLevel(s)
+			if err != nil {
+				i.env = prevEnv
+				i.function = prevFunction
+				return completion{}, err
+			}
+		}
+		ns = namespace{
+			path: stmt.Module.path,
+			env:  i.env,
+		}
+		i.env = prevEnv
+		i.function = prevFunction
+		i.modules[stmt.Module] = ns
 	}
 
-	i.beginScope()
-	defer i.endScope()
+	err := i.env.Define(stmt.Namespace.Lexeme, ns)
+	if err != nil {
+		if err == ErrAlreadyDefined {
+			return completion{}, i.newError(errorKindName, fmt.Sprintf("'%s' is already defined in this scope", stmt.Namespace.Lexeme), stmt.Namespace)
+		}
+		return completion{}, i.newError(errorKindName, err.Error(), stmt.Namespace)
+	}
+	return completion{}, nil
+}
+
+func (i *Interpreter) executeTry(stmt *StmtTry) (completion, error) {
+	c, err := i.tryCatch(stmt)
+	if stmt.Finally == nil {
+		return c, err
+	}
+	// a finally block which completes abruptly replaces the previous completion
+	finally, finallyErr := i.execute(stmt.Finally)
+	if finallyErr != nil || finally.kind != completionNormal {
+		return finally, finallyErr
+	}
+	return c, err
+}
+
+func (i *Interpreter) tryCatch(stmt *StmtTry) (completion, error) {
+	c, err := i.execute(stmt.Body)
+	if c.kind == completionThrow {
+		// thrown exceptions and exceptions of called functions are caught the same way
+		c, err = completion{}, c.value.(error)
+	}
+	exception, ok := asException(err)
+	if !ok || len(stmt.Catches) == 0 {
+		return c, err
+	}
+	caught := exception.caught()
+
+	for _, clause := range stmt.Catches {
+		if clause.Kind.Type == IDENTIFIER && clause.Kind.Lexeme != caught.kind {
+			continue
+		}
 
-	err = i.env.Define(stmt.ExceptionName.Lexeme, exception.Value)
+		i.beginScope()
+		if clause.Name.Type == IDENTIFIER {
+			i.env.Define(clause.Name.Lexeme, caught)
+		}
+		c, err = i.execute(clause.Body)
+		i.endScope()
+		return c, err
+	}
+	return completion{}, caught.rethrow()
+}
+
+func (i *Interpreter) executeDefer(stmt *StmtDefer) (completion, error) {
+	callable, args, err := i.evaluateCall(stmt.Call)
 	if err != nil {
-		return err
+		return completion{}, err
 	}
+	i.deferred = append(i.deferred, deferredCall{
+		callable:  callable,
+		args:      args,
+		openParen: stmt.Call.OpenParen,
+	})
+	return completion{}, nil
+}
 
-	return stmt.CatchBody.Accept(i)
+// runDeferred executes all calls deferred since len(i.deferred) was base in reverse order.
+// err is the result of the function, which is replaced by errors of the deferred calls.
+func (i *Interpreter) runDeferred(base int, err error) error {
+	for len(i.deferred) > base {
+		d := i.deferred[len(i.deferred)-1]
+		i.deferred = i.deferred[:len(i.deferred)-1]
+		_, deferredErr := i.call(d.callable, d.args, d.openParen)
+		if deferredErr != nil {
+			err = deferredErr
+		}
+	}
+	return err
 }
 
 func isNumber(values ...any) bool {
@@ -628,6 +1219,7 @@ func anyString(values ...any) bool {
 }
 
 func isTruthy(value any) bool {
+	value = unwrapFault(value)
 	if v, ok := value.(bool); ok {
 		return v
 	}
@@ -644,48 +1236,75 @@ func isTruthy(value any) bool {
 		return len(v) > 0
 	}
 
+	if v, ok := value.(hashMap); ok {
+		return len(v) > 0
+	}
+
 	return false
 }
 
 func areEqual(a, b any) bool {
+	a, b = unwrapFault(a), unwrapFault(b)
 	alist, alistOk := a.(list)
 	blist, blistOk := b.(list)
 	if alistOk && blistOk {
 		return alist.equals(blist)
 	}
 
+	amap, amapOk := a.(hashMap)
+	bmap, bmapOk := b.(hashMap)
+	if amapOk && bmapOk {
+		return amap.equals(bmap)
+	}
+	if amapOk || bmapOk {
+		return false
+	}
+
+	// instances are only equal to themselves
+	ainstance, ainstanceOk := a.(*instance)
+	binstance, binstanceOk := b.(*instance)
+	if ainstanceOk || binstanceOk {
+		return ainstance == binstance
+	}
+
 	return a == b
 }
 
-func (i *interpreter) beginScope() {
+func (i *Interpreter) beginScope() {
 	i.env = NewEnvironment(i.env)
 }
 
-func (i *interpreter) endScope() {
+func (i *Interpreter) endScope() {
 	i.env = i.env.parent
 }
 
-func (i *interpreter) errorIfMultiValue(value any, token Token) error {
+func (i *Interpreter) errorIfMultiValue(value any, token Token) error {
 	if _, ok := value.(multiValueReturn); ok {
-		return i.newError("Multiple values where a single value was expected.", token)
+		return i.newError(errorKindType, "Multiple values where a single value was expected.", token)
 	}
 	return nil
 }
 
 type RuntimeError struct {
+	// Kind is the category of the error, e.g. TypeError, which can be inspected by crab code after catching the error.
+	Kind    string
 	Token   Token
 	Message string
 	Line    []rune
+	// the call stack, which is available to crab code after catching the error
+	stack []StackFrame
 }
 
 func (r RuntimeError) Error() string {
-	return generateErrorText(r.Message, r.Line, r.Token.Line, r.Token.Column, r.Token.Column+len([]byte(r.Token.Lexeme)))
+	return generateErrorText(r.Message, r.Token.path(), r.Line, r.Token.Line, r.Token.Column, r.Token.Column+len([]byte(r.Token.Lexeme)))
 }
 
-func (i *interpreter) newError(message string, token Token) error {
+func (i *Interpreter) newError(kind, message string, token Token) error {
 	return RuntimeError{
+		Kind:    kind,
 		Token:   token,
 		Message: message,
-		Line:    i.lines[token.Line],
+		Line:    token.lineText(),
+		stack:   i.appendFrame(nil, token),
 	}
 }
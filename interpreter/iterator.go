@@ -0,0 +1,82 @@
+package interpreter
+
+import (
+	"fmt"
+	"math"
+)
+
+// rangeValue is a sequence of numbers from start up to, but not including, end.
+// Its numbers are computed while iterating over it, so it doesn't need any memory for them.
+type rangeValue struct {
+	start float64
+	end   float64
+	step  float64
+}
+
+func (r rangeValue) String() string {
+	return fmt.Sprintf("range(%v, %v, %v)", r.start, r.end, r.step)
+}
+
+func (r rangeValue) len() int {
+	return int(math.Max(math.Ceil((r.end-r.start)/r.step), 0))
+}
+
+// indexOf returns the index of value in r or -1 if r doesn't contain it.
+// Only numbers which are produced when iterating over r are contained in it.
+func (r rangeValue) indexOf(value any) int {
+	number, ok := value.(float64)
+	if !ok {
+		return -1
+	}
+	index := math.Round((number - r.start) / r.step)
+	if index < 0 || index >= float64(r.len()) || r.start+index*r.step != number {
+		return -1
+	}
+	return int(index)
+}
+
+// iterator iterates over the elements of a list, the characters of a string or the numbers of a range.
+type iterator struct {
+	list  list
+	runes []rune
+	rng   *rangeValue
+	index int
+}
+
+func (i *Interpreter) newIterator(collection any, location Token) (*iterator, error) {
+	switch c := unwrapFault(collection).(type) {
+	case list:
+		return &iterator{list: c}, nil
+	case string:
+		return &iterator{runes: []rune(c)}, nil
+	case rangeValue:
+		return &iterator{rng: &c}, nil
+	}
+	return nil, i.newError(errorKindType, "Can only iterate over lists, strings and ranges.", location)
+}
+
+// next returns the index and the value of the next element or false if there are no more elements.
+func (it *iterator) next() (int, any, bool) {
+	index := it.index
+	var value any
+	switch {
+	case it.rng != nil:
+		number := it.rng.start + float64(index)*it.rng.step
+		if it.rng.step > 0 && number >= it.rng.end || it.rng.step < 0 && number <= it.rng.end {
+			return 0, nil, false
+		}
+		value = number
+	case it.runes != nil:
+		if index >= len(it.runes) {
+			return 0, nil, false
+		}
+		value = string(it.runes[index])
+	default:
+		if index >= len(it.list) {
+			return 0, nil, false
+		}
+		value = it.list[index]
+	}
+	it.index++
+	return index, value, true
+}
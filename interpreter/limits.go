@@ -0,0 +1,92 @@
+package interpreter
+
+import "fmt"
+
+// Limits restricts the resources a program can use. A value of 0 disables the respective limit.
+// Exceeding a limit causes a LimitError, which can be caught, but every further statement, call or
+// allocation beyond the limit fails again.
+type Limits struct {
+	// MaxSteps is the maximum number of executed statements. Blocks count as statements, so every
+	// loop iteration and function call is a step even if its body is empty.
+	MaxSteps int
+	// MaxDepth is the maximum number of nested function calls.
+	MaxDepth int
+	// MaxMemory is the approximate maximum number of bytes allocated for strings, lists and maps.
+	MaxMemory int
+}
+
+// the approximate size of a value in a list or map
+const valueSize = 16
+
+// step counts an executed statement.
+func (i *Interpreter) step(location ...Token) error {
+	i.steps++
+	if i.limits.MaxSteps > 0 && i.steps > i.limits.MaxSteps {
+		return i.limitError(fmt.Sprintf("Step limit exceeded: more than %d executed statements.", i.limits.MaxSteps), location...)
+	}
+	return nil
+}
+
+// stepStatement counts the execution of stmt, which is reported as the location if the limit is exceeded.
+// It is kept small enough to be inlined into execute.
+func (i *Interpreter) stepStatement(stmt Stmt) error {
+	if i.limits.MaxSteps > 0 && i.steps >= i.limits.MaxSteps {
+		return i.stepLimitExceeded(stmt)
+	}
+	i.steps++
+	return nil
+}
+
+// stepLimitExceeded counts stmt, which exceeds the step limit, and returns the limit error.
+func (i *Interpreter) stepLimitExceeded(stmt Stmt) error {
+	if location, ok := stepLocation(stmt); ok {
+		return i.step(location)
+	}
+	return i.step()
+}
+
+// stepLocation returns the location of stmt reported if it exceeds the step limit.
+func stepLocation(stmt Stmt) (Token, bool) {
+	block, ok := stmt.(*StmtBlock)
+	if !ok {
+		return stmtLocation(stmt)
+	}
+	if block.OpenBrace.Lexeme == "" && len(block.Statements) > 0 {
+		// the implicit block around a for loop
+		return stepLocation(block.Statements[0])
+	}
+	return block.OpenBrace, true
+}
+
+// enterFunction increases the call depth, which must be decreased with leaveFunction.
+func (i *Interpreter) enterFunction(location ...Token) error {
+	if i.limits.MaxDepth > 0 && i.depth >= i.limits.MaxDepth {
+		return i.limitError(fmt.Sprintf("Depth limit exceeded: more than %d nested function calls.", i.limits.MaxDepth), location...)
+	}
+	i.depth++
+	return nil
+}
+
+func (i *Interpreter) leaveFunction() {
+	i.depth--
+}
+
+// allocate counts the memory used by a new string, list or map.
+func (i *Interpreter) allocate(bytes int, location ...Token) error {
+	i.memory += bytes
+	if i.limits.MaxMemory > 0 && i.memory > i.limits.MaxMemory {
+		return i.limitError(fmt.Sprintf("Memory limit exceeded: more than %d bytes allocated.", i.limits.MaxMemory), location...)
+	}
+	return nil
+}
+
+// limitError returns a runtime error at location or a CallError if the location is unknown.
+func (i *Interpreter) limitError(message string, location ...Token) error {
+	if len(location) == 0 {
+		return CallError{
+			Kind:    errorKindLimit,
+			Message: message,
+		}
+	}
+	return i.newError(errorKindLimit, message, location[0])
+}
@@ -2,6 +2,8 @@ package interpreter
 
 import (
 	"fmt"
+	"math"
+	"sort"
 	"strings"
 )
 
@@ -34,3 +36,91 @@ func (l list) equals(other list) bool {
 
 	return true
 }
+
+type hashMap map[any]any
+
+func (m hashMap) String() string {
+	text := "{"
+
+	for _, k := range m.sortedKeys() {
+		text = fmt.Sprintf("%s%v:%v", text, k, m[k])
+		text = fmt.Sprintf("%s,", text)
+	}
+
+	text = strings.TrimSuffix(text, ",")
+
+	text = text + "}"
+	return text
+}
+
+func (m hashMap) equals(other hashMap) bool {
+	if len(m) != len(other) {
+		return false
+	}
+
+	for k, v := range m {
+		otherValue, ok := other[k]
+		if !ok || !areEqual(v, otherValue) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sortedKeys returns the keys of the map ordered by type (numbers, strings, booleans) and then by value.
+func (m hashMap) sortedKeys() []any {
+	keys := make([]any, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	typeOrder := func(value any) int {
+		switch value.(type) {
+		case float64:
+			return 0
+		case string:
+			return 1
+		default:
+			return 2
+		}
+	}
+
+	sort.Slice(keys, func(a, b int) bool {
+		orderA, orderB := typeOrder(keys[a]), typeOrder(keys[b])
+		if orderA != orderB {
+			return orderA < orderB
+		}
+		switch keyA := keys[a].(type) {
+		case float64:
+			return keyA < keys[b].(float64)
+		case string:
+			return keyA < keys[b].(string)
+		case bool:
+			return !keyA && keys[b].(bool)
+		}
+		return false
+	})
+
+	return keys
+}
+
+func isValidMapKey(value any) bool {
+	return mapKeyError(value) == ""
+}
+
+// mapKeyError returns the reason why value cannot be used as a map key or an empty string if it can.
+func mapKeyError(value any) string {
+	switch v := value.(type) {
+	case float64:
+		// NaN is not equal to itself, so an entry with a NaN key could never be read again
+		if math.IsNaN(v) {
+			return "Map key cannot be NaN."
+		}
+		return ""
+	case string, bool:
+		return ""
+	default:
+		return "Map key must be a number, string or boolean."
+	}
+}
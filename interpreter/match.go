@@ -0,0 +1,97 @@
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// matchPatterns returns the values of the names bound by the first of patterns which matches value
+// in the order of patternBindings.
+func matchPatterns(patterns []Pattern, value any) ([]any, bool) {
+	for _, pattern := range patterns {
+		if bindings, ok := pattern.match(value, make([]any, 0)); ok {
+			return bindings, true
+		}
+	}
+	return nil, false
+}
+
+func (p Pattern) match(value any, bindings []any) ([]any, bool) {
+	switch p.Kind {
+	case PatternLiteral:
+		return bindings, areEqual(p.Value, value)
+	case PatternWildcard:
+		return bindings, true
+	case PatternBinding:
+		return append(bindings, value), true
+	case PatternList:
+		values, ok := value.(list)
+		if !ok || len(values) != len(p.Elements) {
+			return nil, false
+		}
+		for index, element := range p.Elements {
+			bindings, ok = element.match(values[index], bindings)
+			if !ok {
+				return nil, false
+			}
+		}
+		return bindings, true
+	}
+	return nil, false
+}
+
+// patternBindings returns the names bound by patterns from left to right.
+func patternBindings(patterns []Pattern) []Token {
+	names := make([]Token, 0)
+	for _, pattern := range patterns {
+		switch pattern.Kind {
+		case PatternBinding:
+			names = append(names, pattern.Token)
+		case PatternList:
+			names = append(names, patternBindings(pattern.Elements)...)
+		}
+	}
+	return names
+}
+
+// matchesEverything reports whether the case matches every value, so all following cases are unreachable.
+func (m MatchCase) matchesEverything() bool {
+	if m.Guard != nil {
+		return false
+	}
+	for _, pattern := range m.Patterns {
+		if pattern.Kind == PatternWildcard || pattern.Kind == PatternBinding {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Pattern) String() string {
+	switch p.Kind {
+	case PatternLiteral:
+		return toString(p.Value)
+	case PatternList:
+		elements := make([]string, len(p.Elements))
+		for index, element := range p.Elements {
+			elements[index] = element.String()
+		}
+		return fmt.Sprintf("[%s]", strings.Join(elements, ", "))
+	}
+	return p.Token.Lexeme
+}
+
+// casePatterns are the patterns of a case, which are stored as a constant of opMatch.
+type casePatterns struct {
+	patterns []Pattern
+	// the number of names bound by the patterns
+	bindings int
+}
+
+func (c *casePatterns) String() string {
+	patterns := make([]string, len(c.patterns))
+	for index, pattern := range c.patterns {
+		patterns[index] = pattern.String()
+	}
+	return strings.Join(patterns, ", ")
+}
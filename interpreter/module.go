@@ -0,0 +1,136 @@
+package interpreter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type module struct {
+	path    string
+	program []Stmt
+	exports map[string]variable
+}
+
+type moduleLoader struct {
+	modules map[string]*module
+	// files which are currently being checked, used to detect import cycles
+	stack []moduleStackEntry
+	// functions registered by the host program, which are available in every module
+	natives map[string]Callable
+}
+
+type moduleStackEntry struct {
+	absPath string
+	path    string
+}
+
+func newModuleLoader() *moduleLoader {
+	return &moduleLoader{
+		modules: make(map[string]*module),
+		stack:   make([]moduleStackEntry, 0),
+	}
+}
+
+func (l *moduleLoader) isNative(name string) bool {
+	if _, ok := nativeFunctions[name]; ok {
+		return true
+	}
+	_, ok := l.natives[name]
+	return ok
+}
+
+// namespace is the runtime value of an imported module.
+type namespace struct {
+	path string
+	env  *Environment
+}
+
+func (n namespace) String() string {
+	return fmt.Sprintf("<module %s>", n.path)
+}
+
+func (c *checker) loadModule(stmt *StmtImport) (*module, error) {
+	path := stmt.Path.Literal.(string)
+	if !filepath.IsAbs(path) && stmt.Path.File != nil {
+		path = filepath.Join(filepath.Dir(stmt.Path.File.Path), path)
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, c.newError(fmt.Sprintf("Invalid import path: %s", err), stmt.Path)
+	}
+
+	if len(c.loader.stack) == 0 && stmt.Keyword.File != nil {
+		importerPath, err := filepath.Abs(stmt.Keyword.File.Path)
+		if err == nil {
+			c.loader.stack = append(c.loader.stack, moduleStackEntry{
+				absPath: importerPath,
+				path:    stmt.Keyword.File.Path,
+			})
+		}
+	}
+
+	for index, entry := range c.loader.stack {
+		if entry.absPath == absPath {
+			cycle := make([]string, 0, len(c.loader.stack)-index+1)
+			for _, e := range c.loader.stack[index:] {
+				cycle = append(cycle, e.path)
+			}
+			cycle = append(cycle, path)
+			return nil, c.newError(fmt.Sprintf("Import cycle: %s.", strings.Join(cycle, " -> ")), stmt.Path)
+		}
+	}
+
+	if mod, ok := c.loader.modules[absPath]; ok {
+		return mod, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, c.newError(fmt.Sprintf("Failed to open '%s'.", path), stmt.Path)
+	}
+	tokens, err := Scan(file, path)
+	file.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	program, errs := Parse(tokens)
+	if len(errs) > 0 {
+		return nil, errorList(errs)
+	}
+
+	c.loader.stack = append(c.loader.stack, moduleStackEntry{
+		absPath: absPath,
+		path:    path,
+	})
+	moduleChecker := newChecker(c.loader)
+	moduleChecker.analysis = c.analysis
+	moduleChecker.check(program, false)
+	c.loader.stack = c.loader.stack[:len(c.loader.stack)-1]
+	// the errors are reported by the import statement
+	for _, d := range moduleChecker.diagnostics {
+		if d.Severity == SeverityWarning {
+			c.diagnostics = append(c.diagnostics, d)
+		}
+	}
+	if err := moduleChecker.errors(); err != nil {
+		return nil, err
+	}
+
+	exports := make(map[string]variable)
+	for name, v := range moduleChecker.scopes[0] {
+		if !c.loader.isNative(name) {
+			exports[name] = v
+		}
+	}
+
+	mod := &module{
+		path:    path,
+		program: program,
+		exports: exports,
+	}
+	c.loader.modules[absPath] = mod
+	return mod, nil
+}
@@ -1,9 +1,9 @@
 package interpreter
 
 import (
-	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"math"
 	"math/rand"
 	"os"
@@ -14,7 +14,10 @@ import (
 	"time"
 )
 
+// CallError is returned by native functions to report a runtime error at the location of the call.
 type CallError struct {
+	// Kind defaults to Error.
+	Kind    string
 	Message string
 }
 
@@ -23,23 +26,39 @@ func (t CallError) Error() string {
 }
 
 func newTypeError(value any, expectedType string) CallError {
-	var provided string
-	switch value.(type) {
+	return CallError{
+		Kind:    errorKindType,
+		Message: fmt.Sprintf("Wrong type. Expected '%s', got '%s'.", expectedType, typeName(value)),
+	}
+}
+
+// typeName returns the name of the type of value used in error messages.
+func typeName(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "Null"
 	case float64:
-		provided = "Float"
+		return "Float"
 	case string:
-		provided = "String"
+		return "String"
 	case bool:
-		provided = "Boolean"
+		return "Boolean"
 	case list:
-		provided = "List"
-	default:
-		provided = reflect.TypeOf(value).String()
-	}
-
-	return CallError{
-		Message: fmt.Sprintf("Wrong type. Expected '%s', got '%s'.", expectedType, provided),
+		return "List"
+	case hashMap:
+		return "Map"
+	case *instance:
+		return v.class.name
+	case *class:
+		return "Class"
+	case *fault:
+		return "Error"
+	case rangeValue:
+		return "Range"
+	case Callable:
+		return "Function"
 	}
+	return reflect.TypeOf(value).String()
 }
 
 var nativeFunctions = map[string]Callable{
@@ -52,9 +71,14 @@ var nativeFunctions = map[string]Callable{
 	"toBoolean":      funcToBoolean{},
 	"createList":     funcCreateList{},
 	"len":            funcLen{},
+	"range":          funcRange{},
 	"append":         funcAppend{},
 	"concat":         funcConcat{},
 	"remove":         funcRemove{},
+	"keys":           funcKeys{},
+	"values":         funcValues{},
+	"hasKey":         funcHasKey{},
+	"delete":         funcDelete{},
 	"fileExists":     funcFileExists{},
 	"readFileText":   funcReadFileText{},
 	"writeFileText":  funcWriteFileText{},
@@ -77,6 +101,9 @@ var nativeFunctions = map[string]Callable{
 	"ceil":           funcCeil{},
 	"round":          funcRound{},
 	"sqrt":           funcSqrt{},
+	"assert":         funcAssert{},
+	"assertEqual":    funcAssertEqual{},
+	"assertThrows":   funcAssertThrows{},
 }
 
 type funcPrint struct{}
@@ -93,8 +120,8 @@ func (f funcPrint) ReturnValueCount() int {
 	return 0
 }
 
-func (f funcPrint) Call(i *interpreter, args []any) (any, error) {
-	fmt.Print(strings.TrimSuffix(strings.TrimSuffix(fmt.Sprintln(args...), "\n"), "\r"))
+func (f funcPrint) Call(i *Interpreter, args []any) (any, error) {
+	fmt.Fprint(i.stdout, strings.TrimSuffix(strings.TrimSuffix(fmt.Sprintln(args...), "\n"), "\r"))
 	return nil, nil
 }
 
@@ -112,8 +139,8 @@ func (f funcPrintln) ReturnValueCount() int {
 	return 0
 }
 
-func (f funcPrintln) Call(i *interpreter, args []any) (any, error) {
-	fmt.Println(args...)
+func (f funcPrintln) Call(i *Interpreter, args []any) (any, error) {
+	fmt.Fprintln(i.stdout, args...)
 	return nil, nil
 }
 
@@ -131,11 +158,15 @@ func (f funcInput) ReturnValueCount() int {
 	return 1
 }
 
-func (f funcInput) Call(i *interpreter, args []any) (any, error) {
-	fmt.Print(args[0])
-	scanner := bufio.NewScanner(os.Stdin)
-	scanner.Scan()
-	return scanner.Text(), nil
+func (f funcInput) Call(i *Interpreter, args []any) (any, error) {
+	fmt.Fprint(i.stdout, args[0])
+	line, err := i.stdin.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, CallError{
+			Message: fmt.Sprintf("Failed to read input: %s", err),
+		}
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
 }
 
 type funcMillis struct{}
@@ -152,7 +183,7 @@ func (f funcMillis) ReturnValueCount() int {
 	return 1
 }
 
-func (f funcMillis) Call(i *interpreter, args []any) (any, error) {
+func (f funcMillis) Call(i *Interpreter, args []any) (any, error) {
 	return float64(time.Now().UnixMilli()), nil
 }
 
@@ -170,7 +201,7 @@ func (f funcToString) ReturnValueCount() int {
 	return 1
 }
 
-func (f funcToString) Call(i *interpreter, args []any) (any, error) {
+func (f funcToString) Call(i *Interpreter, args []any) (any, error) {
 	return fmt.Sprint(args[0]), nil
 }
 
@@ -188,10 +219,10 @@ func (f funcToNumber) ReturnValueCount() int {
 	return 1
 }
 
-func (f funcToNumber) Call(i *interpreter, args []any) (any, error) {
+func (f funcToNumber) Call(i *Interpreter, args []any) (any, error) {
 	number, err := strconv.ParseFloat(fmt.Sprint(args[0]), 64)
 	if err != nil {
-		return nil, i.NewException(fmt.Sprintf("Cannot convert '%v' to a number.", args[0]), -1)
+		return nil, i.NewException(&fault{kind: errorKindConversion, message: fmt.Sprintf("Cannot convert '%v' to a number.", args[0])})
 	}
 	return number, nil
 }
@@ -210,10 +241,10 @@ func (f funcToBoolean) ReturnValueCount() int {
 	return 1
 }
 
-func (f funcToBoolean) Call(i *interpreter, args []any) (any, error) {
+func (f funcToBoolean) Call(i *Interpreter, args []any) (any, error) {
 	boolean, err := strconv.ParseBool(fmt.Sprint(args[0]))
 	if err != nil {
-		return nil, i.NewException(fmt.Sprintf("Cannot convert '%v' to a boolean.", args[0]), -1)
+		return nil, i.NewException(&fault{kind: errorKindConversion, message: fmt.Sprintf("Cannot convert '%v' to a boolean.", args[0])})
 	}
 	return boolean, nil
 }
@@ -232,8 +263,11 @@ func (f funcCreateList) ReturnValueCount() int {
 	return 1
 }
 
-func (f funcCreateList) Call(i *interpreter, args []any) (any, error) {
+func (f funcCreateList) Call(i *Interpreter, args []any) (any, error) {
 	if size, ok := args[0].(float64); ok && size == float64(int(size)) {
+		if err := i.allocate(int(size) * valueSize); err != nil {
+			return nil, err
+		}
 		return make(list, int(size)), nil
 	}
 	return nil, newTypeError(args[1], "Integer")
@@ -253,14 +287,70 @@ func (f funcLen) ReturnValueCount() int {
 	return 1
 }
 
-func (f funcLen) Call(i *interpreter, args []any) (any, error) {
+func (f funcLen) Call(i *Interpreter, args []any) (any, error) {
 	if l, ok := args[0].(list); ok {
 		return float64(len(l)), nil
 	}
 	if s, ok := args[0].(string); ok {
 		return float64(len(s)), nil
 	}
-	return nil, newTypeError(args[0], "List|String")
+	if m, ok := args[0].(hashMap); ok {
+		return float64(len(m)), nil
+	}
+	if r, ok := args[0].(rangeValue); ok {
+		return float64(r.len()), nil
+	}
+	return nil, newTypeError(args[0], "List|String|Map|Range")
+}
+
+type funcRange struct{}
+
+func (f funcRange) Throws() bool {
+	return false
+}
+
+func (f funcRange) ArgumentCount() int {
+	return -1
+}
+
+func (f funcRange) ReturnValueCount() int {
+	return 1
+}
+
+// Call accepts range(end), range(start, end) and range(start, end, step).
+func (f funcRange) Call(i *Interpreter, args []any) (any, error) {
+	if len(args) < 1 || len(args) > 3 {
+		return nil, CallError{
+			Kind:    errorKindType,
+			Message: fmt.Sprintf("Wrong argument count. Expected 1 to 3, got %d.", len(args)),
+		}
+	}
+	numbers := make([]float64, len(args))
+	for index, a := range args {
+		n, ok := a.(float64)
+		if !ok {
+			return nil, newTypeError(a, "Number")
+		}
+		numbers[index] = n
+	}
+
+	r := rangeValue{
+		end:  numbers[0],
+		step: 1,
+	}
+	if len(numbers) > 1 {
+		r.start, r.end = numbers[0], numbers[1]
+	}
+	if len(numbers) > 2 {
+		r.step = numbers[2]
+	}
+	if r.step == 0 {
+		return nil, CallError{
+			Kind:    errorKindValue,
+			Message: "The step of a range must not be 0.",
+		}
+	}
+	return r, nil
 }
 
 type funcAppend struct{}
@@ -277,8 +367,11 @@ func (f funcAppend) ReturnValueCount() int {
 	return 1
 }
 
-func (f funcAppend) Call(i *interpreter, args []any) (any, error) {
+func (f funcAppend) Call(i *Interpreter, args []any) (any, error) {
 	if l, ok := args[0].(list); ok {
+		if err := i.allocate(valueSize); err != nil {
+			return nil, err
+		}
 		return append(l, args[1]), nil
 	}
 	return nil, newTypeError(args[0], "List")
@@ -298,9 +391,12 @@ func (f funcConcat) ReturnValueCount() int {
 	return 1
 }
 
-func (f funcConcat) Call(i *interpreter, args []any) (any, error) {
+func (f funcConcat) Call(i *Interpreter, args []any) (any, error) {
 	if l, ok := args[0].(list); ok {
 		if l2, ok := args[1].(list); ok {
+			if err := i.allocate(len(l2) * valueSize); err != nil {
+				return nil, err
+			}
 			return append(l, l2...), nil
 		}
 		return nil, newTypeError(args[1], "List")
@@ -322,11 +418,12 @@ func (f funcRemove) ReturnValueCount() int {
 	return 1
 }
 
-func (f funcRemove) Call(i *interpreter, args []any) (any, error) {
+func (f funcRemove) Call(i *Interpreter, args []any) (any, error) {
 	if l, ok := args[0].(list); ok {
 		if index, ok := args[1].(float64); ok && index == float64(int(index)) {
 			if int(index) >= len(l) || index < 0 {
 				return nil, CallError{
+					Kind:    errorKindIndex,
 					Message: "List index out of bounds.",
 				}
 			}
@@ -337,6 +434,102 @@ func (f funcRemove) Call(i *interpreter, args []any) (any, error) {
 	return nil, newTypeError(args[0], "List")
 }
 
+type funcKeys struct{}
+
+func (f funcKeys) Throws() bool {
+	return false
+}
+
+func (f funcKeys) ArgumentCount() int {
+	return 1
+}
+
+func (f funcKeys) ReturnValueCount() int {
+	return 1
+}
+
+func (f funcKeys) Call(i *Interpreter, args []any) (any, error) {
+	if m, ok := args[0].(hashMap); ok {
+		return list(m.sortedKeys()), nil
+	}
+	return nil, newTypeError(args[0], "Map")
+}
+
+type funcValues struct{}
+
+func (f funcValues) Throws() bool {
+	return false
+}
+
+func (f funcValues) ArgumentCount() int {
+	return 1
+}
+
+func (f funcValues) ReturnValueCount() int {
+	return 1
+}
+
+func (f funcValues) Call(i *Interpreter, args []any) (any, error) {
+	if m, ok := args[0].(hashMap); ok {
+		keys := m.sortedKeys()
+		values := make(list, len(keys))
+		for index, k := range keys {
+			values[index] = m[k]
+		}
+		return values, nil
+	}
+	return nil, newTypeError(args[0], "Map")
+}
+
+type funcHasKey struct{}
+
+func (f funcHasKey) Throws() bool {
+	return false
+}
+
+func (f funcHasKey) ArgumentCount() int {
+	return 2
+}
+
+func (f funcHasKey) ReturnValueCount() int {
+	return 1
+}
+
+func (f funcHasKey) Call(i *Interpreter, args []any) (any, error) {
+	if m, ok := args[0].(hashMap); ok {
+		if !isValidMapKey(args[1]) {
+			return false, nil
+		}
+		_, ok := m[args[1]]
+		return ok, nil
+	}
+	return nil, newTypeError(args[0], "Map")
+}
+
+type funcDelete struct{}
+
+func (f funcDelete) Throws() bool {
+	return false
+}
+
+func (f funcDelete) ArgumentCount() int {
+	return 2
+}
+
+func (f funcDelete) ReturnValueCount() int {
+	return 0
+}
+
+func (f funcDelete) Call(i *Interpreter, args []any) (any, error) {
+	if m, ok := args[0].(hashMap); ok {
+		if isValidMapKey(args[1]) {
+			delete(m, args[1])
+		}
+		return nil, nil
+	}
+	return nil, newTypeError(args[0], "Map")
+}
+
 type funcFileExists struct{}
 
 func (f funcFileExists) Throws() bool {
@@ -351,7 +544,7 @@ func (f funcFileExists) ReturnValueCount() int {
 	return 1
 }
 
-func (f funcFileExists) Call(i *interpreter, args []any) (any, error) {
+func (f funcFileExists) Call(i *Interpreter, args []any) (any, error) {
 	filepath := fmt.Sprint(args[0])
 	_, err := os.Stat(filepath)
 	return !errors.Is(err, os.ErrNotExist), nil
@@ -371,11 +564,14 @@ func (f funcReadFileText) ReturnValueCount() int {
 	return 1
 }
 
-func (f funcReadFileText) Call(i *interpreter, args []any) (any, error) {
+func (f funcReadFileText) Call(i *Interpreter, args []any) (any, error) {
 	filepath := fmt.Sprint(args[0])
 	data, err := os.ReadFile(filepath)
 	if err != nil {
-		return nil, i.NewException(err.Error(), -1)
+		return nil, i.NewException(&fault{kind: errorKindFile, message: err.Error()})
+	}
+	if err := i.allocate(len(data)); err != nil {
+		return nil, err
 	}
 	return string(data), nil
 }
@@ -394,15 +590,15 @@ func (f funcWriteFileText) ReturnValueCount() int {
 	return 0
 }
 
-func (f funcWriteFileText) Call(i *interpreter, args []any) (any, error) {
+func (f funcWriteFileText) Call(i *Interpreter, args []any) (any, error) {
 	filepath := fmt.Sprint(args[0])
 	err := os.MkdirAll(path.Dir(filepath), 0755)
 	if err != nil {
-		return nil, i.NewException(err.Error(), -1)
+		return nil, i.NewException(&fault{kind: errorKindFile, message: err.Error()})
 	}
 	err = os.WriteFile(filepath, []byte(fmt.Sprint(args[1])), 0755)
 	if err != nil {
-		return nil, i.NewException(err.Error(), -1)
+		return nil, i.NewException(&fault{kind: errorKindFile, message: err.Error()})
 	}
 	return nil, nil
 }
@@ -421,16 +617,16 @@ func (f funcAppendFileText) ReturnValueCount() int {
 	return 0
 }
 
-func (f funcAppendFileText) Call(i *interpreter, args []any) (any, error) {
+func (f funcAppendFileText) Call(i *Interpreter, args []any) (any, error) {
 	filepath := fmt.Sprint(args[0])
 	file, err := os.OpenFile(filepath, os.O_APPEND|os.O_WRONLY, 0755)
 	if err != nil {
-		return nil, i.NewException(err.Error(), -1)
+		return nil, i.NewException(&fault{kind: errorKindFile, message: err.Error()})
 	}
 	defer file.Close()
 	_, err = file.WriteString(fmt.Sprint(args[1]))
 	if err != nil {
-		return nil, i.NewException(err.Error(), -1)
+		return nil, i.NewException(&fault{kind: errorKindFile, message: err.Error()})
 	}
 	return nil, nil
 }
@@ -449,11 +645,11 @@ func (f funcDeleteFile) ReturnValueCount() int {
 	return 0
 }
 
-func (f funcDeleteFile) Call(i *interpreter, args []any) (any, error) {
+func (f funcDeleteFile) Call(i *Interpreter, args []any) (any, error) {
 	filepath := fmt.Sprint(args[0])
 	err := os.Remove(filepath)
 	if err != nil {
-		return nil, i.NewException(err.Error(), -1)
+		return nil, i.NewException(&fault{kind: errorKindFile, message: err.Error()})
 	}
 	return nil, nil
 }
@@ -472,11 +668,11 @@ func (f funcListFiles) ReturnValueCount() int {
 	return 1
 }
 
-func (f funcListFiles) Call(i *interpreter, args []any) (any, error) {
+func (f funcListFiles) Call(i *Interpreter, args []any) (any, error) {
 	filepath := fmt.Sprint(args[0])
 	entries, err := os.ReadDir(filepath)
 	if err != nil {
-		return nil, i.NewException(err.Error(), -1)
+		return nil, i.NewException(&fault{kind: errorKindFile, message: err.Error()})
 	}
 	files := make(list, len(entries))
 	for i, entry := range entries {
@@ -499,7 +695,7 @@ func (f funcToLower) ReturnValueCount() int {
 	return 1
 }
 
-func (f funcToLower) Call(i *interpreter, args []any) (any, error) {
+func (f funcToLower) Call(i *Interpreter, args []any) (any, error) {
 	str := fmt.Sprint(args[0])
 	return strings.ToLower(str), nil
 }
@@ -518,7 +714,7 @@ func (f funcToUpper) ReturnValueCount() int {
 	return 1
 }
 
-func (f funcToUpper) Call(i *interpreter, args []any) (any, error) {
+func (f funcToUpper) Call(i *Interpreter, args []any) (any, error) {
 	str := fmt.Sprint(args[0])
 	return strings.ToUpper(str), nil
 }
@@ -537,7 +733,7 @@ func (f funcContains) ReturnValueCount() int {
 	return 1
 }
 
-func (f funcContains) Call(i *interpreter, args []any) (any, error) {
+func (f funcContains) Call(i *Interpreter, args []any) (any, error) {
 	if l, ok := args[0].(list); ok {
 		for _, item := range l {
 			if areEqual(args[1], item) {
@@ -547,6 +743,18 @@ func (f funcContains) Call(i *interpreter, args []any) (any, error) {
 		return false, nil
 	}
 
+	if m, ok := args[0].(hashMap); ok {
+		if !isValidMapKey(args[1]) {
+			return false, nil
+		}
+		_, ok := m[args[1]]
+		return ok, nil
+	}
+
+	if r, ok := args[0].(rangeValue); ok {
+		return r.indexOf(args[1]) >= 0, nil
+	}
+
 	str := fmt.Sprint(args[0])
 	substring := fmt.Sprint(args[1])
 	return strings.Contains(str, substring), nil
@@ -566,7 +774,7 @@ func (f funcIndexOf) ReturnValueCount() int {
 	return 1
 }
 
-func (f funcIndexOf) Call(i *interpreter, args []any) (any, error) {
+func (f funcIndexOf) Call(i *Interpreter, args []any) (any, error) {
 	if l, ok := args[0].(list); ok {
 		for index, item := range l {
 			if areEqual(args[1], item) {
@@ -576,6 +784,10 @@ func (f funcIndexOf) Call(i *interpreter, args []any) (any, error) {
 		return -1, nil
 	}
 
+	if r, ok := args[0].(rangeValue); ok {
+		return float64(r.indexOf(args[1])), nil
+	}
+
 	str := fmt.Sprint(args[0])
 	substring := fmt.Sprint(args[1])
 	return strings.Index(str, substring), nil
@@ -595,7 +807,7 @@ func (f funcTrim) ReturnValueCount() int {
 	return 1
 }
 
-func (f funcTrim) Call(i *interpreter, args []any) (any, error) {
+func (f funcTrim) Call(i *Interpreter, args []any) (any, error) {
 	str := fmt.Sprint(args[0])
 	return strings.TrimSpace(str), nil
 }
@@ -614,7 +826,7 @@ func (f funcReplace) ReturnValueCount() int {
 	return 1
 }
 
-func (f funcReplace) Call(i *interpreter, args []any) (any, error) {
+func (f funcReplace) Call(i *Interpreter, args []any) (any, error) {
 	if l, ok := args[0].(list); ok {
 		for index, item := range l {
 			if areEqual(args[1], item) {
@@ -627,7 +839,11 @@ func (f funcReplace) Call(i *interpreter, args []any) (any, error) {
 	str := fmt.Sprint(args[0])
 	old := fmt.Sprint(args[1])
 	new := fmt.Sprint(args[2])
-	return strings.ReplaceAll(str, old, new), nil
+	result := strings.ReplaceAll(str, old, new)
+	if err := i.allocate(len(result)); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
 type funcSplit struct{}
@@ -644,7 +860,7 @@ func (f funcSplit) ReturnValueCount() int {
 	return 1
 }
 
-func (f funcSplit) Call(i *interpreter, args []any) (any, error) {
+func (f funcSplit) Call(i *Interpreter, args []any) (any, error) {
 	if l, ok := args[0].(list); ok {
 		lists := make(list, 0, 1)
 		segStart := 0
@@ -662,6 +878,9 @@ func (f funcSplit) Call(i *interpreter, args []any) (any, error) {
 	sep := fmt.Sprint(args[1])
 
 	parts := strings.Split(str, sep)
+	if err := i.allocate(len(parts)*valueSize + len(str)); err != nil {
+		return nil, err
+	}
 	l := make(list, len(parts))
 	for index, p := range parts {
 		l[index] = p
@@ -683,7 +902,7 @@ func (f funcJoin) ReturnValueCount() int {
 	return 1
 }
 
-func (f funcJoin) Call(i *interpreter, args []any) (any, error) {
+func (f funcJoin) Call(i *Interpreter, args []any) (any, error) {
 	l, ok := args[0].(list)
 	if !ok {
 		return args[0], nil
@@ -695,7 +914,11 @@ func (f funcJoin) Call(i *interpreter, args []any) (any, error) {
 		elems[index] = fmt.Sprint(item)
 	}
 
-	return strings.Join(elems, sep), nil
+	result := strings.Join(elems, sep)
+	if err := i.allocate(len(result)); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
 type funcRandom struct{}
@@ -712,7 +935,7 @@ func (f funcRandom) ReturnValueCount() int {
 	return 1
 }
 
-func (f funcRandom) Call(i *interpreter, args []any) (any, error) {
+func (f funcRandom) Call(i *Interpreter, args []any) (any, error) {
 	num1 := 0.0
 	if n1, ok := args[0].(float64); ok {
 		num1 = n1
@@ -728,6 +951,7 @@ func (f funcRandom) Call(i *interpreter, args []any) (any, error) {
 
 	if num1 > num2 {
 		return nil, CallError{
+			Kind:    errorKindValue,
 			Message: fmt.Sprintf("Second argument is less than the first argument."),
 		}
 	}
@@ -749,7 +973,7 @@ func (f funcRandomInt) ReturnValueCount() int {
 	return 1
 }
 
-func (f funcRandomInt) Call(i *interpreter, args []any) (any, error) {
+func (f funcRandomInt) Call(i *Interpreter, args []any) (any, error) {
 	num1 := 0.0
 	if n1, ok := args[0].(float64); ok && n1 == float64(int64(n1)) {
 		num1 = n1
@@ -765,6 +989,7 @@ func (f funcRandomInt) Call(i *interpreter, args []any) (any, error) {
 
 	if num1 > num2 {
 		return nil, CallError{
+			Kind:    errorKindValue,
 			Message: fmt.Sprintf("Second argument is less than the first argument."),
 		}
 	}
@@ -786,7 +1011,7 @@ func (f funcMin) ReturnValueCount() int {
 	return 1
 }
 
-func (f funcMin) Call(i *interpreter, args []any) (any, error) {
+func (f funcMin) Call(i *Interpreter, args []any) (any, error) {
 	num1 := 0.0
 	if n1, ok := args[0].(float64); ok {
 		num1 = n1
@@ -817,7 +1042,7 @@ func (f funcMax) ReturnValueCount() int {
 	return 1
 }
 
-func (f funcMax) Call(i *interpreter, args []any) (any, error) {
+func (f funcMax) Call(i *Interpreter, args []any) (any, error) {
 	num1 := 0.0
 	if n1, ok := args[0].(float64); ok {
 		num1 = n1
@@ -848,7 +1073,7 @@ func (f funcAbs) ReturnValueCount() int {
 	return 1
 }
 
-func (f funcAbs) Call(i *interpreter, args []any) (any, error) {
+func (f funcAbs) Call(i *Interpreter, args []any) (any, error) {
 	num := 0.0
 	if n, ok := args[0].(float64); ok {
 		num = n
@@ -873,7 +1098,7 @@ func (f funcFloor) ReturnValueCount() int {
 	return 1
 }
 
-func (f funcFloor) Call(i *interpreter, args []any) (any, error) {
+func (f funcFloor) Call(i *Interpreter, args []any) (any, error) {
 	num := 0.0
 	if n, ok := args[0].(float64); ok {
 		num = n
@@ -898,7 +1123,7 @@ func (f funcCeil) ReturnValueCount() int {
 	return 1
 }
 
-func (f funcCeil) Call(i *interpreter, args []any) (any, error) {
+func (f funcCeil) Call(i *Interpreter, args []any) (any, error) {
 	num := 0.0
 	if n, ok := args[0].(float64); ok {
 		num = n
@@ -923,7 +1148,7 @@ func (f funcRound) ReturnValueCount() int {
 	return 1
 }
 
-func (f funcRound) Call(i *interpreter, args []any) (any, error) {
+func (f funcRound) Call(i *Interpreter, args []any) (any, error) {
 	num := 0.0
 	if n, ok := args[0].(float64); ok {
 		num = n
@@ -948,7 +1173,7 @@ func (f funcSqrt) ReturnValueCount() int {
 	return 1
 }
 
-func (f funcSqrt) Call(i *interpreter, args []any) (any, error) {
+func (f funcSqrt) Call(i *Interpreter, args []any) (any, error) {
 	num := 0.0
 	if n, ok := args[0].(float64); ok {
 		num = n
@@ -958,3 +1183,143 @@ func (f funcSqrt) Call(i *interpreter, args []any) (any, error) {
 
 	return math.Sqrt(num), nil
 }
+
+type funcAssert struct{}
+
+func (f funcAssert) Throws() bool {
+	return false
+}
+
+func (f funcAssert) ArgumentCount() int {
+	return 1
+}
+
+func (f funcAssert) ReturnValueCount() int {
+	return 0
+}
+
+func (f funcAssert) Call(i *Interpreter, args []any) (any, error) {
+	if !isTruthy(args[0]) {
+		return nil, CallError{
+			Kind:    errorKindAssertion,
+			Message: "Assertion failed.",
+		}
+	}
+	return nil, nil
+}
+
+type funcAssertEqual struct{}
+
+func (f funcAssertEqual) Throws() bool {
+	return false
+}
+
+func (f funcAssertEqual) ArgumentCount() int {
+	return 2
+}
+
+func (f funcAssertEqual) ReturnValueCount() int {
+	return 0
+}
+
+func (f funcAssertEqual) Call(i *Interpreter, args []any) (any, error) {
+	actual, expected := args[0], args[1]
+	if areEqual(actual, expected) {
+		return nil, nil
+	}
+
+	actualList, actualOk := actual.(list)
+	expectedList, expectedOk := expected.(list)
+	if actualOk && expectedOk {
+		return nil, CallError{
+			Kind:    errorKindAssertion,
+			Message: fmt.Sprintf("Assertion failed: lists are not equal (- expected, + actual):\n%s", diffLists(expectedList, actualList)),
+		}
+	}
+
+	return nil, CallError{
+		Kind:    errorKindAssertion,
+		Message: fmt.Sprintf("Assertion failed: expected %s, got %s.", toString(expected), toString(actual)),
+	}
+}
+
+// diffLists returns a line based diff, which turns a into b.
+func diffLists(a, b list) string {
+	// lengths of the longest common subsequences of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if areEqual(a[i], b[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	lines := make([]string, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && areEqual(a[i], b[j]):
+			lines = append(lines, "  "+toString(a[i]))
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] > lcs[i+1][j]):
+			lines = append(lines, "+ "+toString(b[j]))
+			j++
+		default:
+			lines = append(lines, "- "+toString(a[i]))
+			i++
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+type funcAssertThrows struct{}
+
+func (f funcAssertThrows) Throws() bool {
+	return false
+}
+
+func (f funcAssertThrows) ArgumentCount() int {
+	return 1
+}
+
+func (f funcAssertThrows) ReturnValueCount() int {
+	return 1
+}
+
+func (f funcAssertThrows) Call(i *Interpreter, args []any) (any, error) {
+	callable, ok := args[0].(Callable)
+	if !ok {
+		return nil, newTypeError(args[0], "Function")
+	}
+	if callable.ArgumentCount() > 0 {
+		return nil, CallError{
+			Kind:    errorKindType,
+			Message: "The function passed to 'assertThrows' must not take any arguments.",
+		}
+	}
+
+	_, err := callable.Call(i, nil)
+	if runtimeError, ok := err.(RuntimeError); ok {
+		err = runtimeError.exception()
+	}
+	if exception, ok := err.(Exception); ok {
+		return exception.Value, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, CallError{
+		Kind:    errorKindAssertion,
+		Message: "Assertion failed: expected an exception.",
+	}
+}
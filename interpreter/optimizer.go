@@ -0,0 +1,222 @@
+package interpreter
+
+import (
+	"io"
+	"strings"
+)
+
+// Optimize folds expressions over literals and removes unreachable code from program and the modules imported by it.
+// The program must have been checked with Check. Its nodes are modified in place.
+//
+// Only expressions which can't fail are folded, so every remaining runtime error is reported at the same position
+// as without optimizations.
+func Optimize(program []Stmt) []Stmt {
+	o := &optimizer{
+		// evaluates the folded expressions exactly like the program would
+		folder:  newInterpreter(strings.NewReader(""), io.Discard, nil),
+		modules: make(map[*module]bool),
+	}
+	return o.statements(program)
+}
+
+type optimizer struct {
+	folder  *Interpreter
+	modules map[*module]bool
+}
+
+// statements optimizes stmts and removes all statements after a return, throw, break or continue statement.
+func (o *optimizer) statements(stmts []Stmt) []Stmt {
+	optimized := make([]Stmt, 0, len(stmts))
+	for _, stmt := range stmts {
+		stmt = o.stmt(stmt)
+		if stmt == nil {
+			continue
+		}
+		optimized = append(optimized, stmt)
+		switch stmt.(type) {
+		case *StmtReturn, *StmtThrow, *StmtLoopControl:
+			return optimized
+		}
+	}
+	return optimized
+}
+
+// body optimizes the body of a statement, which is replaced with an empty block if it is removed.
+func (o *optimizer) body(stmt Stmt) Stmt {
+	if stmt == nil {
+		return nil
+	}
+	stmt = o.stmt(stmt)
+	if stmt == nil {
+		return &StmtBlock{}
+	}
+	return stmt
+}
+
+// stmt returns the optimized stmt or nil if it can be removed.
+func (o *optimizer) stmt(stmt Stmt) Stmt {
+	switch s := stmt.(type) {
+	case *StmtExpression:
+		s.Expr = o.expr(s.Expr)
+	case *StmtBlock:
+		s.Statements = o.statements(s.Statements)
+	case *StmtVarDecl:
+		s.Expr = o.expr(s.Expr)
+	case *StmtFuncDecl:
+		s.Body = o.body(s.Body)
+	case *StmtClass:
+		for _, field := range s.Fields {
+			o.stmt(field)
+		}
+		for _, method := range s.Methods {
+			method.Body = o.body(method.Body)
+		}
+	case *StmtIf:
+		s.Condition = o.expr(s.Condition)
+		s.Body = o.body(s.Body)
+		s.ElseBody = o.body(s.ElseBody)
+		if condition, ok := s.Condition.(*ExprLiteral); ok {
+			if isTruthy(condition.Value) {
+				return s.Body
+			}
+			if s.ElseBody != nil {
+				return s.ElseBody
+			}
+			return nil
+		}
+	case *StmtWhile:
+		s.Condition = o.expr(s.Condition)
+		s.Body = o.body(s.Body)
+		if condition, ok := s.Condition.(*ExprLiteral); ok && !isTruthy(condition.Value) {
+			return nil
+		}
+	case *StmtFor:
+		s.Initializer = o.body(s.Initializer)
+		s.Condition = o.expr(s.Condition)
+		s.Increment = o.expr(s.Increment)
+		s.Body = o.body(s.Body)
+		if condition, ok := s.Condition.(*ExprLiteral); ok && !isTruthy(condition.Value) {
+			// the initializer is still executed in the implicit block around the loop
+			return s.Initializer
+		}
+	case *StmtForEach:
+		s.Collection = o.expr(s.Collection)
+		s.Body = o.body(s.Body)
+	case *StmtMatch:
+		s.Value = o.expr(s.Value)
+		for index := range s.Cases {
+			s.Cases[index].Guard = o.expr(s.Cases[index].Guard)
+			s.Cases[index].Body = o.body(s.Cases[index].Body)
+		}
+	case *StmtReturn:
+		o.exprs(s.Values)
+	case *StmtThrow:
+		s.Value = o.expr(s.Value)
+	case *StmtTry:
+		s.Body = o.body(s.Body)
+		for index := range s.Catches {
+			s.Catches[index].Body = o.body(s.Catches[index].Body)
+		}
+		s.Finally = o.body(s.Finally)
+	case *StmtDefer:
+		// the call itself is evaluated when the statement is executed, so only its parts can be folded
+		s.Call.Callee = o.expr(s.Call.Callee)
+		o.exprs(s.Call.Args)
+	case *StmtImport:
+		if s.Module != nil && !o.modules[s.Module] {
+			o.modules[s.Module] = true
+			s.Module.program = o.statements(s.Module.program)
+		}
+	}
+	return stmt
+}
+
+func (o *optimizer) exprs(exprs []Expr) {
+	for index, expr := range exprs {
+		exprs[index] = o.expr(expr)
+	}
+}
+
+// expr returns the optimized expr, which is a literal if expr only consists of literals and can't fail.
+func (o *optimizer) expr(expr Expr) Expr {
+	switch e := expr.(type) {
+	case *ExprTemplate:
+		o.exprs(e.Parts)
+	case *ExprCall:
+		e.Callee = o.expr(e.Callee)
+		o.exprs(e.Args)
+	case *ExprSubscript:
+		e.Object = o.expr(e.Object)
+		e.Subscript = o.expr(e.Subscript)
+	case *ExprProperty:
+		e.Object = o.expr(e.Object)
+	case *ExprGrouping:
+		e.Expr = o.expr(e.Expr)
+		if literal, ok := e.Expr.(*ExprLiteral); ok {
+			return literal
+		}
+	case *ExprList:
+		o.exprs(e.Values)
+	case *ExprMap:
+		o.exprs(e.Keys)
+		o.exprs(e.Values)
+	case *ExprUnary:
+		e.Right = o.expr(e.Right)
+		if isLiteral(e.Right) {
+			return o.fold(e)
+		}
+	case *ExprBinary:
+		e.Left = o.expr(e.Left)
+		e.Right = o.expr(e.Right)
+		if isLiteral(e.Left) && isLiteral(e.Right) {
+			return o.fold(e)
+		}
+	case *ExprLogical:
+		e.Left = o.expr(e.Left)
+		e.Right = o.expr(e.Right)
+		left, ok := e.Left.(*ExprLiteral)
+		if !ok {
+			break
+		}
+		// the right operand isn't evaluated if the left one already determines the result
+		shortCircuit := e.Operator.Type == OR && isTruthy(left.Value) || e.Operator.Type == AND && !isTruthy(left.Value)
+		if shortCircuit || isLiteral(e.Right) {
+			return o.fold(e)
+		}
+	case *ExprTernary:
+		e.Left = o.expr(e.Left)
+		e.Center = o.expr(e.Center)
+		e.Right = o.expr(e.Right)
+		if condition, ok := e.Left.(*ExprLiteral); ok && e.Operator1.Type == QUESTION_MARK {
+			if isTruthy(condition.Value) {
+				return e.Center
+			}
+			return e.Right
+		}
+	case *ExprAssign:
+		o.exprs(e.Assignees)
+		e.Expr = o.expr(e.Expr)
+	case *ExprAnonymousFunction:
+		e.Body = o.body(e.Body)
+	}
+	return expr
+}
+
+// fold evaluates expr, whose operands are literals, and returns the result as a literal.
+// expr is returned unchanged if the evaluation fails, so the error is reported when the program is executed.
+func (o *optimizer) fold(expr Expr) Expr {
+	value, err := expr.Accept(o.folder)
+	if err != nil {
+		return expr
+	}
+	switch value.(type) {
+	case float64, string, bool:
+		return &ExprLiteral{Value: value}
+	}
+	return expr
+}
+
+func isLiteral(expr Expr) bool {
+	_, ok := expr.(*ExprLiteral)
+	return ok
+}
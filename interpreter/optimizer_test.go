@@ -0,0 +1,175 @@
+package interpreter
+
+import (
+	"strings"
+	"testing"
+)
+
+// runOptimized checks source, optimizes it if optimize is set and runs its main function with engine.
+// It returns the printed AST of the executed program, the output and the error message of the program.
+func runOptimized(t *testing.T, source string, engine Engine, optimize bool) (ast, output, errorMessage string) {
+	t.Helper()
+	tokens, err := Scan(strings.NewReader(source), "test.cb")
+	if err != nil {
+		t.Fatalf("scan: %s", err)
+	}
+	program, errs := Parse(tokens)
+	if len(errs) > 0 {
+		t.Fatalf("parse: %s", errorList(errs))
+	}
+	if err := Errors(Check(program)); err != nil {
+		t.Fatalf("check: %s", err)
+	}
+	if optimize {
+		program = Optimize(program)
+	}
+
+	var printed strings.Builder
+	for _, stmt := range program {
+		printed.WriteString(PrintAST(stmt))
+	}
+
+	var stdout strings.Builder
+	if engine == EngineVM {
+		var bytecode *Bytecode
+		bytecode, err = Compile(program)
+		if err != nil {
+			t.Fatalf("compile: %s", err)
+		}
+		vm := newVM(strings.NewReader(""), &stdout, nil)
+		err = vm.runScript(bytecode)
+		if err == nil {
+			_, err = vm.call(vm.interpreter.env.names["main"].(*closure), nil, Token{Line: -1})
+		}
+	} else {
+		err = newInterpreter(strings.NewReader(""), &stdout, nil).run(program, "main")
+	}
+	if err != nil {
+		errorMessage = err.Error()
+	}
+	return printed.String(), stdout.String(), errorMessage
+}
+
+// TestOptimize checks that optimized programs produce the same output and errors at the same positions as
+// unoptimized programs.
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		output string
+		// the location in the error message or empty if the program doesn't fail
+		location string
+	}{
+		{
+			name: "folding",
+			source: `
+func main() {
+	println(2 * 3 + 1, "a" + "b" + 1, !true, -(1 + 2), 7 % 4 == 3 ? "yes" : "no");
+}
+`,
+			output: "7 ab1 false -3 yes\n",
+		},
+		{
+			name: "failing expression",
+			source: `
+func main() {
+	println("before");
+	var x = 2 * 3 + (1 + true);
+	println(x);
+}
+`,
+			output:   "before\n",
+			location: "[test.cb:4:21]",
+		},
+		{
+			name: "if with literal condition",
+			source: `
+func main() {
+	if (false) {
+		println("never");
+	}
+	if (1 > 2) {
+		println("never");
+	} else {
+		println("else");
+	}
+	if (true) {
+		var x = "then";
+		println(x);
+	}
+	var x = 1;
+	println(x);
+}
+`,
+			output: "else\nthen\n1\n",
+		},
+		{
+			name: "code after return",
+			source: `
+func f() 1 {
+	return 1;
+	println("unreachable");
+}
+
+func main() throws {
+	for (var i = 0; i < 3; i++) {
+		if (i == 1) {
+			continue;
+			println("unreachable");
+		}
+		println(i);
+	}
+	println(f());
+	throw "end";
+	println("unreachable");
+}
+`,
+			output:   "0\n2\n1\n",
+			location: "[test.cb:16] in main",
+		},
+		{
+			name: "for with literal false condition",
+			source: `
+func start() 1 {
+	println("initializer");
+	return 5;
+}
+
+func main() {
+	for (var i = start(); false; i++) {
+		println("never");
+	}
+	while (false) {
+		println("never");
+	}
+	var i = 2;
+	println(i);
+	for (var j = 1 + true; false; j++) {}
+}
+`,
+			output:   "initializer\n2\n",
+			location: "[test.cb:16:17]",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, engine := range []Engine{EngineTree, EngineVM} {
+				ast, output, err := runOptimized(t, test.source, engine, false)
+				optimizedAST, optimizedOutput, optimizedErr := runOptimized(t, test.source, engine, true)
+				if optimizedAST == ast {
+					t.Errorf("%s: the program wasn't optimized", engine)
+				}
+				if output != test.output || optimizedOutput != test.output {
+					t.Errorf("%s: got %q without and %q with optimizations, want %q", engine, output, optimizedOutput, test.output)
+				}
+				if optimizedErr != err {
+					t.Errorf("%s: got %q without and %q with optimizations", engine, err, optimizedErr)
+				}
+				if (test.location == "") != (err == "") || !strings.Contains(err, test.location) {
+					t.Errorf("%s: got error %q, want an error at %s", engine, err, test.location)
+				}
+			}
+		})
+	}
+}
@@ -2,19 +2,21 @@ package interpreter
 
 import (
 	"fmt"
+	"path/filepath"
+	"strings"
 )
 
 type parser struct {
 	tokens  []Token
 	current int
-	lines   [][]rune
 	errors  []error
+	// allow statements which are not declarations at the top level
+	allowTopLevelStatements bool
 }
 
-func Parse(tokens []Token, lines [][]rune) ([]Stmt, []error) {
+func Parse(tokens []Token) ([]Stmt, []error) {
 	parser := &parser{
 		tokens: tokens,
-		lines:  lines,
 		errors: make([]error, 0),
 	}
 	return parser.parse()
@@ -23,20 +25,26 @@ func Parse(tokens []Token, lines [][]rune) ([]Stmt, []error) {
 func (p *parser) parse() ([]Stmt, []error) {
 	statements := make([]Stmt, 0)
 	for p.peek().Type != EOF {
-		statements = append(statements, p.declaration(false))
+		if stmt := p.declaration(true); stmt != nil {
+			statements = append(statements, stmt)
+		}
 	}
 	return statements, p.errors
 }
 
-func (p *parser) declaration(allowNonDeclarationStatements bool) Stmt {
+func (p *parser) declaration(topLevel bool) Stmt {
 	var stmt Stmt
 	var err error
 	if p.match(VAR) {
 		stmt, err = p.varDecl()
+	} else if topLevel && p.match(IMPORT) {
+		stmt, err = p.importDecl()
 	} else if p.peek().Type == FUNC && p.peekNext().Type == IDENTIFIER {
 		p.match(FUNC)
 		stmt, err = p.funcDecl()
-	} else if allowNonDeclarationStatements {
+	} else if p.match(CLASS) {
+		stmt, err = p.classDecl()
+	} else if !topLevel || p.allowTopLevelStatements {
 		stmt, err = p.statement()
 	}
 
@@ -88,6 +96,45 @@ func (p *parser) varDecl() (Stmt, error) {
 	}, nil
 }
 
+func (p *parser) importDecl() (Stmt, error) {
+	keyword := p.previous()
+
+	if !p.match(STRING) {
+		return nil, p.newError("Expect file path after 'import' keyword.")
+	}
+	path := p.previous()
+
+	var namespace Token
+	if p.match(AS) {
+		if !p.match(IDENTIFIER) {
+			return nil, p.newError("Expect namespace name after 'as'.")
+		}
+		namespace = p.previous()
+	} else {
+		name := strings.TrimSuffix(filepath.Base(path.Literal.(string)), filepath.Ext(path.Literal.(string)))
+		if !isIdentifier(name) {
+			return nil, p.newErrorAt(fmt.Sprintf("Cannot use '%s' as a namespace name. Specify one with 'as'.", name), path)
+		}
+		namespace = Token{
+			Line:   path.Line,
+			Column: path.Column,
+			Type:   IDENTIFIER,
+			Lexeme: name,
+			File:   path.File,
+		}
+	}
+
+	if !p.match(SEMICOLON) {
+		return nil, p.newError("Missing semicolon.")
+	}
+
+	return &StmtImport{
+		Keyword:   keyword,
+		Path:      path,
+		Namespace: namespace,
+	}, nil
+}
+
 func (p *parser) funcDecl() (Stmt, error) {
 	if !p.match(IDENTIFIER) {
 		return nil, p.newError("Expect identifier after 'func' keyword.")
@@ -99,12 +146,12 @@ func (p *parser) funcDecl() (Stmt, error) {
 		return nil, p.newError("Expect '(' after function name.")
 	}
 
-	parameters := make([]string, 0)
+	parameters := make([]Token, 0)
 	for p.peek().Type != CLOSE_PAREN {
 		if !p.match(IDENTIFIER) {
 			return nil, p.newError("Invalid parameter name.")
 		}
-		parameters = append(parameters, p.previous().Lexeme)
+		parameters = append(parameters, p.previous())
 		if p.peek().Type == CLOSE_PAREN {
 			break
 		}
@@ -150,6 +197,48 @@ func (p *parser) funcDecl() (Stmt, error) {
 	}, nil
 }
 
+func (p *parser) classDecl() (Stmt, error) {
+	if !p.match(IDENTIFIER) {
+		return nil, p.newError("Expect identifier after 'class' keyword.")
+	}
+	name := p.previous()
+
+	if !p.match(OPEN_BRACE) {
+		return nil, p.newError("Expect '{' after class name.")
+	}
+	openBrace := p.previous()
+
+	fields := make([]*StmtVarDecl, 0)
+	methods := make([]*StmtFuncDecl, 0)
+	for p.peek().Type != CLOSE_BRACE && p.peek().Type != EOF {
+		if p.match(VAR) {
+			field, err := p.varDecl()
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, field.(*StmtVarDecl))
+		} else if p.match(FUNC) {
+			method, err := p.funcDecl()
+			if err != nil {
+				return nil, err
+			}
+			methods = append(methods, method.(*StmtFuncDecl))
+		} else {
+			return nil, p.newError("Expect field or method declaration.")
+		}
+	}
+
+	if !p.match(CLOSE_BRACE) {
+		return nil, p.newErrorAt("Class body never closed.", openBrace)
+	}
+
+	return &StmtClass{
+		Name:    name,
+		Fields:  fields,
+		Methods: methods,
+	}, nil
+}
+
 func (p *parser) statement() (Stmt, error) {
 	if p.match(OPEN_BRACE) {
 		return p.block()
@@ -163,6 +252,9 @@ func (p *parser) statement() (Stmt, error) {
 	if p.match(FOR) {
 		return p.forLoop()
 	}
+	if p.match(MATCH) {
+		return p.matchStmt()
+	}
 	if p.match(BREAK, CONTINUE) {
 		return p.loopControl()
 	}
@@ -175,6 +267,9 @@ func (p *parser) statement() (Stmt, error) {
 	if p.match(TRY) {
 		return p.tryStmt()
 	}
+	if p.match(DEFER) {
+		return p.deferStmt()
+	}
 	return p.expressionStmt()
 }
 
@@ -214,6 +309,134 @@ func (p *parser) ifStmt() (Stmt, error) {
 	}, nil
 }
 
+func (p *parser) matchStmt() (Stmt, error) {
+	keyword := p.previous()
+	if !p.match(OPEN_PAREN) {
+		return nil, p.newError("Expect '(' after 'match'.")
+	}
+
+	value, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.match(CLOSE_PAREN) {
+		return nil, p.newError("Expect ')' after match value.")
+	}
+	if !p.match(OPEN_BRACE) {
+		return nil, p.newError("Expect '{' after match value.")
+	}
+	if p.peek().Type != CASE {
+		return nil, p.newError("Expect 'case' after '{'.")
+	}
+
+	cases := make([]MatchCase, 0)
+	for p.match(CASE) {
+		matchCase := MatchCase{
+			Keyword:  p.previous(),
+			Patterns: make([]Pattern, 0, 1),
+		}
+		for {
+			pattern, err := p.pattern()
+			if err != nil {
+				return nil, err
+			}
+			matchCase.Patterns = append(matchCase.Patterns, pattern)
+			if !p.match(COMMA) {
+				break
+			}
+		}
+
+		if p.match(IF) {
+			matchCase.Guard, err = p.expression()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if !p.match(COLON) {
+			return nil, p.newError("Expect ':' after case pattern.")
+		}
+
+		matchCase.Body, err = p.statement()
+		if err != nil {
+			return nil, err
+		}
+		cases = append(cases, matchCase)
+	}
+
+	if !p.match(CLOSE_BRACE) {
+		return nil, p.newError("Expect 'case' or '}' after case body.")
+	}
+
+	return &StmtMatch{
+		Keyword: keyword,
+		Value:   value,
+		Cases:   cases,
+	}, nil
+}
+
+func (p *parser) pattern() (Pattern, error) {
+	token := p.peek()
+	if p.match(NUMBER, STRING, TRUE, FALSE) {
+		return Pattern{
+			Kind:  PatternLiteral,
+			Token: token,
+			Value: token.Literal,
+		}, nil
+	}
+
+	if p.match(MINUS) {
+		if !p.match(NUMBER) {
+			return Pattern{}, p.newError("Expect number after '-' in pattern.")
+		}
+		return Pattern{
+			Kind:  PatternLiteral,
+			Token: token,
+			Value: -p.previous().Literal.(float64),
+		}, nil
+	}
+
+	if p.match(IDENTIFIER) {
+		if token.Lexeme == "_" {
+			return Pattern{
+				Kind:  PatternWildcard,
+				Token: token,
+			}, nil
+		}
+		return Pattern{
+			Kind:  PatternBinding,
+			Token: token,
+		}, nil
+	}
+
+	if p.match(OPEN_BRACKET) {
+		elements := make([]Pattern, 0)
+		if !p.match(CLOSE_BRACKET) {
+			for {
+				element, err := p.pattern()
+				if err != nil {
+					return Pattern{}, err
+				}
+				elements = append(elements, element)
+				if !p.match(COMMA) {
+					break
+				}
+			}
+			if !p.match(CLOSE_BRACKET) {
+				return Pattern{}, p.newError("Expect ']' after list pattern.")
+			}
+		}
+		return Pattern{
+			Kind:     PatternList,
+			Token:    token,
+			Elements: elements,
+		}, nil
+	}
+
+	return Pattern{}, p.newError("Expect pattern.")
+}
+
 func (p *parser) whileLoop() (Stmt, error) {
 	keyword := p.previous()
 	if !p.match(OPEN_PAREN) {
@@ -247,6 +470,10 @@ func (p *parser) forLoop() (Stmt, error) {
 		return nil, p.newError("Expect '(' after 'while'.")
 	}
 
+	if p.isForEach() {
+		return p.forEachLoop(keyword)
+	}
+
 	var initializer Stmt
 	var err error
 	if !p.match(SEMICOLON) {
@@ -303,6 +530,7 @@ func (p *parser) forLoop() (Stmt, error) {
 	}
 
 	return &StmtBlock{
+		CloseBrace: p.previous(),
 		Statements: []Stmt{&StmtFor{
 			Keyword:     keyword,
 			Initializer: initializer,
@@ -323,6 +551,57 @@ func (p *parser) loopControl() (Stmt, error) {
 	}, nil
 }
 
+// isForEach reports whether the tokens after '(' of a for loop start a for-each loop.
+func (p *parser) isForEach() bool {
+	next := func(offset int) TokenType {
+		if p.current+offset >= len(p.tokens) {
+			return EOF
+		}
+		return p.tokens[p.current+offset].Type
+	}
+	if next(0) != VAR || next(1) != IDENTIFIER {
+		return false
+	}
+	return next(2) == IN || next(2) == COMMA && next(3) == IDENTIFIER && next(4) == IN
+}
+
+func (p *parser) forEachLoop(keyword Token) (Stmt, error) {
+	p.match(VAR)
+	p.match(IDENTIFIER)
+	var index Token
+	element := p.previous()
+	if p.match(COMMA) {
+		p.match(IDENTIFIER)
+		index = element
+		element = p.previous()
+	}
+	p.match(IN)
+	in := p.previous()
+
+	collection, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.match(CLOSE_PAREN) {
+		return nil, p.newError("Expect ')' after for loop collection.")
+	}
+
+	body, err := p.statement()
+	if err != nil {
+		return nil, err
+	}
+
+	return &StmtForEach{
+		Keyword:    keyword,
+		Index:      index,
+		Element:    element,
+		In:         in,
+		Collection: collection,
+		Body:       body,
+	}, nil
+}
+
 func (p *parser) returnStmt() (Stmt, error) {
 	keyword := p.previous()
 
@@ -378,34 +657,79 @@ func (p *parser) tryStmt() (Stmt, error) {
 		return nil, err
 	}
 
-	if !p.match(CATCH) {
-		return nil, p.newError("Expect 'catch' after try body.")
+	if p.peek().Type != CATCH && p.peek().Type != FINALLY {
+		return nil, p.newError("Expect 'catch' or 'finally' after try body.")
 	}
 
-	var exceptionName Token
-	if p.match(OPEN_PAREN) {
-		if !p.match(IDENTIFIER) {
-			return nil, p.newError("Expect exception name.")
+	catches := make([]CatchClause, 0, 1)
+	for p.match(CATCH) {
+		clause := CatchClause{
+			Keyword: p.previous(),
 		}
-		exceptionName = p.previous()
-		if !p.match(CLOSE_PAREN) {
-			return nil, p.newError("Expect ')' after exception name.")
+		if p.match(OPEN_PAREN) {
+			if !p.match(IDENTIFIER) {
+				return nil, p.newError("Expect exception name.")
+			}
+			clause.Name = p.previous()
+			if p.match(COLON) {
+				if !p.match(IDENTIFIER) {
+					return nil, p.newError("Expect error kind after ':'.")
+				}
+				clause.Kind = p.previous()
+			}
+			if !p.match(CLOSE_PAREN) {
+				return nil, p.newError("Expect ')' after exception name.")
+			}
+		}
+
+		if !p.match(OPEN_BRACE) {
+			return nil, p.newError("Expect '{' after 'catch'.")
+		}
+		clause.Body, err = p.block()
+		if err != nil {
+			return nil, err
 		}
+		catches = append(catches, clause)
 	}
 
-	if !p.match(OPEN_BRACE) {
-		return nil, p.newError("Expect '{' after 'catch'.")
+	var finally Stmt
+	if p.match(FINALLY) {
+		if !p.match(OPEN_BRACE) {
+			return nil, p.newError("Expect '{' after 'finally'.")
+		}
+		finally, err = p.block()
+		if err != nil {
+			return nil, err
+		}
 	}
-	catchBody, err := p.block()
+
+	return &StmtTry{
+		Keyword: keyword,
+		Body:    body,
+		Catches: catches,
+		Finally: finally,
+	}, nil
+}
+
+func (p *parser) deferStmt() (Stmt, error) {
+	keyword := p.previous()
+
+	expr, err := p.expression()
 	if err != nil {
 		return nil, err
 	}
+	call, ok := expr.(*ExprCall)
+	if !ok {
+		return nil, p.newErrorAt("Expect function call after 'defer'.", keyword)
+	}
 
-	return &StmtTry{
-		Keyword:       keyword,
-		Body:          body,
-		CatchBody:     catchBody,
-		ExceptionName: exceptionName,
+	if !p.match(SEMICOLON) {
+		return nil, p.newError("Missing semicolon.")
+	}
+
+	return &StmtDefer{
+		Keyword: keyword,
+		Call:    call,
 	}, nil
 }
 
@@ -429,8 +753,9 @@ func (p *parser) block() (Stmt, error) {
 	statements := make([]Stmt, 0)
 
 	for p.peek().Type != CLOSE_BRACE && p.peek().Type != EOF {
-		stmt := p.declaration(true)
-		statements = append(statements, stmt)
+		if stmt := p.declaration(false); stmt != nil {
+			statements = append(statements, stmt)
+		}
 	}
 
 	if !p.match(CLOSE_BRACE) {
@@ -438,6 +763,8 @@ func (p *parser) block() (Stmt, error) {
 	}
 
 	return &StmtBlock{
+		OpenBrace:  openBrace,
+		CloseBrace: p.previous(),
 		Statements: statements,
 	}, nil
 }
@@ -475,6 +802,8 @@ func (p *parser) assign() (Expr, error) {
 				assignees = append(assignees, v)
 			} else if s, ok := expr.(*ExprSubscript); ok {
 				assignees = append(assignees, s)
+			} else if property, ok := expr.(*ExprProperty); ok {
+				assignees = append(assignees, property)
 			} else {
 				return nil, p.newErrorAt("Can only assign to variables.", operator)
 			}
@@ -511,6 +840,7 @@ func (p *parser) assign() (Expr, error) {
 					Type:   tokenType,
 					Column: operator.Column,
 					Lexeme: operator.Lexeme,
+					File:   operator.File,
 				},
 				Left:  exprs[0],
 				Right: right,
@@ -736,10 +1066,10 @@ func (p *parser) postfix() (Expr, error) {
 	}
 	if p.match(PLUS_PLUS, MINUS_MINUS) {
 		operator := p.previous()
-		if _, ok := expr.(*ExprVariable); !ok {
-			if _, ok := expr.(*ExprSubscript); !ok {
-				return nil, p.newErrorAt("Can only increment/decrement variables.", operator)
-			}
+		switch expr.(type) {
+		case *ExprVariable, *ExprSubscript, *ExprProperty:
+		default:
+			return nil, p.newErrorAt("Can only increment/decrement variables.", operator)
 		}
 		tokenType := PLUS
 		if operator.Type == MINUS_MINUS {
@@ -753,6 +1083,7 @@ func (p *parser) postfix() (Expr, error) {
 					Type:   tokenType,
 					Lexeme: operator.Lexeme,
 					Column: operator.Column,
+					File:   operator.File,
 				},
 				Left: expr,
 				Right: &ExprLiteral{
@@ -769,9 +1100,21 @@ func (p *parser) subscriptOrCall() (Expr, error) {
 	if err != nil {
 		return nil, err
 	}
-	for p.match(OPEN_BRACKET, OPEN_PAREN) {
+	for p.match(OPEN_BRACKET, OPEN_PAREN, DOT) {
 		token := p.previous()
 
+		if token.Type == DOT {
+			if !p.match(IDENTIFIER) {
+				return nil, p.newError("Expect property name after '.'.")
+			}
+			expr = &ExprProperty{
+				Dot:    token,
+				Object: expr,
+				Name:   p.previous(),
+			}
+			continue
+		}
+
 		if token.Type == OPEN_BRACKET {
 			subscript, err := p.expression()
 			if err != nil {
@@ -826,12 +1169,12 @@ func (p *parser) anonymousFunc() (Expr, error) {
 		return nil, p.newError("Expect '(' after 'func'.")
 	}
 
-	parameters := make([]string, 0)
+	parameters := make([]Token, 0)
 	for p.peek().Type != CLOSE_PAREN {
 		if !p.match(IDENTIFIER) {
 			return nil, p.newError("Invalid parameter name.")
 		}
-		parameters = append(parameters, p.previous().Lexeme)
+		parameters = append(parameters, p.previous())
 		if p.peek().Type == CLOSE_PAREN {
 			break
 		}
@@ -884,12 +1227,22 @@ func (p *parser) primary() (Expr, error) {
 		}, nil
 	}
 
+	if p.match(INTERPOLATION) {
+		return p.template()
+	}
+
 	if p.match(IDENTIFIER) {
 		return &ExprVariable{
 			Name: p.previous(),
 		}, nil
 	}
 
+	if p.match(THIS) {
+		return &ExprThis{
+			Keyword: p.previous(),
+		}, nil
+	}
+
 	if p.match(OPEN_PAREN) {
 		openingParen := p.previous()
 		expr, err := p.expression()
@@ -908,9 +1261,48 @@ func (p *parser) primary() (Expr, error) {
 		return p.list()
 	}
 
+	if p.match(OPEN_BRACE) {
+		return p.mapLiteral()
+	}
+
 	return nil, p.newError(fmt.Sprintf("Unexpected token '%s'", p.peek().Lexeme))
 }
 
+func (p *parser) template() (Expr, error) {
+	start := p.previous()
+
+	parts := make([]Expr, 0)
+	for {
+		if text := p.previous().Literal.(string); text != "" {
+			parts = append(parts, &ExprLiteral{
+				Value: text,
+			})
+		}
+		if p.previous().Type == STRING {
+			break
+		}
+
+		if isTemplateContinuation(p.peek()) {
+			return nil, p.newError("Expect expression after '${'.")
+		}
+		expr, err := p.conditional()
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, expr)
+
+		if !isTemplateContinuation(p.peek()) {
+			return nil, p.newError("Expect '}' after interpolated expression.")
+		}
+		p.current++
+	}
+
+	return &ExprTemplate{
+		Start: start,
+		Parts: parts,
+	}, nil
+}
+
 func (p *parser) list() (Expr, error) {
 	openingBracket := p.previous()
 
@@ -938,6 +1330,46 @@ func (p *parser) list() (Expr, error) {
 	}, nil
 }
 
+func (p *parser) mapLiteral() (Expr, error) {
+	openingBrace := p.previous()
+
+	keys := make([]Expr, 0)
+	values := make([]Expr, 0)
+
+	for p.peek().Type != CLOSE_BRACE {
+		key, err := p.conditional()
+		if err != nil {
+			return nil, err
+		}
+
+		if !p.match(COLON) {
+			return nil, p.newError("Expect ':' after map key.")
+		}
+
+		value, err := p.conditional()
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+		values = append(values, value)
+
+		if !p.match(COMMA) {
+			break
+		}
+	}
+
+	if !p.match(CLOSE_BRACE) {
+		return nil, p.newErrorAt("Brace never closed.", openingBrace)
+	}
+
+	return &ExprMap{
+		OpenBrace: openingBrace,
+		Keys:      keys,
+		Values:    values,
+	}, nil
+}
+
 func (p *parser) match(types ...TokenType) bool {
 	for _, t := range types {
 		if p.peek().Type == t {
@@ -970,7 +1402,7 @@ func (p *parser) synchronize() {
 		case SEMICOLON:
 			p.current++
 			return
-		case VAR, FUNC, IF, WHILE, FOR:
+		case VAR, FUNC, CLASS, IF, WHILE, FOR, MATCH, IMPORT:
 			return
 		}
 		p.current++
@@ -984,14 +1416,14 @@ type ParseError struct {
 }
 
 func (p ParseError) Error() string {
-	return generateErrorText(p.Message, p.Line, p.Token.Line, p.Token.Column, p.Token.Column+len([]rune(p.Token.Lexeme)))
+	return generateErrorText(p.Message, p.Token.path(), p.Line, p.Token.Line, p.Token.Column, p.Token.Column+len([]rune(p.Token.Lexeme)))
 }
 
 func (p *parser) newError(message string) error {
 	return ParseError{
 		Token:   p.peek(),
 		Message: message,
-		Line:    p.lines[p.peek().Line],
+		Line:    p.peek().lineText(),
 	}
 }
 
@@ -999,6 +1431,6 @@ func (p *parser) newErrorAt(message string, token Token) error {
 	return ParseError{
 		Token:   token,
 		Message: message,
-		Line:    p.lines[token.Line],
+		Line:    token.lineText(),
 	}
 }
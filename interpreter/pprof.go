@@ -0,0 +1,162 @@
+package interpreter
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// protoBuffer encodes the subset of the protocol buffer wire format needed for pprof profiles.
+// See https://github.com/google/pprof/blob/main/proto/profile.proto
+type protoBuffer struct {
+	data []byte
+}
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.data = append(b.data, byte(x)|0x80)
+		x >>= 7
+	}
+	b.data = append(b.data, byte(x))
+}
+
+func (b *protoBuffer) uint64(field int, x uint64) {
+	if x == 0 {
+		return
+	}
+	b.varint(uint64(field) << 3)
+	b.varint(x)
+}
+
+func (b *protoBuffer) int64(field int, x int64) {
+	b.uint64(field, uint64(x))
+}
+
+func (b *protoBuffer) bytes(field int, data []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(data)))
+	b.data = append(b.data, data...)
+}
+
+func (b *protoBuffer) message(field int, encode func(m *protoBuffer)) {
+	m := &protoBuffer{}
+	encode(m)
+	b.bytes(field, m.data)
+}
+
+func (b *protoBuffer) packed(field int, values []uint64) {
+	m := &protoBuffer{}
+	for _, v := range values {
+		m.varint(v)
+	}
+	b.bytes(field, m.data)
+}
+
+// pprofLocation is a line of a function.
+type pprofLocation struct {
+	function *ProfileEntry
+	line     int
+}
+
+// WritePprof writes the profile as a gzip-compressed protocol buffer readable by 'go tool pprof' to w.
+// Every sample contains the number of executions and the self time of a line with its call stack.
+func (p *Profile) WritePprof(w io.Writer) error {
+	table := []string{""}
+	stringIDs := map[string]uint64{"": 0}
+	str := func(s string) int64 {
+		id, ok := stringIDs[s]
+		if !ok {
+			id = uint64(len(table))
+			table = append(table, s)
+			stringIDs[s] = id
+		}
+		return int64(id)
+	}
+
+	var functions []*ProfileEntry
+	functionIDs := make(map[*ProfileEntry]uint64)
+	var locations []pprofLocation
+	locationIDs := make(map[pprofLocation]uint64)
+	location := func(function *ProfileEntry, line int) uint64 {
+		if _, ok := functionIDs[function]; !ok {
+			functions = append(functions, function)
+			functionIDs[function] = uint64(len(functions))
+		}
+		l := pprofLocation{function: function, line: line}
+		id, ok := locationIDs[l]
+		if !ok {
+			locations = append(locations, l)
+			id = uint64(len(locations))
+			locationIDs[l] = id
+		}
+		return id
+	}
+
+	b := &protoBuffer{}
+	valueType := func(field int, typ, unit string) {
+		b.message(field, func(m *protoBuffer) {
+			m.int64(1, str(typ))
+			m.int64(2, str(unit))
+		})
+	}
+	valueType(1, "calls", "count")
+	valueType(1, "time", "nanoseconds")
+
+	var walk func(node *profileNode)
+	walk = func(node *profileNode) {
+		if !node.function || node.self > 0 {
+			var stack []uint64
+			for n := node; n != nil; n = n.parent {
+				if n.function {
+					stack = append(stack, location(n.entry, n.entry.Line))
+					continue
+				}
+				// a line and the function containing it form a single location
+				stack = append(stack, location(n.parent.entry, n.entry.Line))
+				n = n.parent
+			}
+			count := uint64(0)
+			if !node.function {
+				count = uint64(node.count)
+			}
+			b.message(2, func(m *protoBuffer) {
+				m.packed(1, stack)
+				m.packed(2, []uint64{count, uint64(node.self)})
+			})
+		}
+		for _, child := range node.children {
+			walk(child)
+		}
+	}
+	walk(p.root)
+
+	for index, l := range locations {
+		b.message(4, func(m *protoBuffer) {
+			m.uint64(1, uint64(index+1))
+			m.message(4, func(line *protoBuffer) {
+				line.uint64(1, functionIDs[l.function])
+				line.int64(2, int64(l.line+1))
+			})
+		})
+	}
+	for index, f := range functions {
+		b.message(5, func(m *protoBuffer) {
+			m.uint64(1, uint64(index+1))
+			// without a system name, pprof doesn't try to demangle names like '<script>'
+			m.int64(2, str(f.Name))
+			m.int64(4, str(f.Path))
+			m.int64(5, int64(f.Line+1))
+		})
+	}
+	b.int64(10, int64(p.Duration))
+	valueType(11, "time", "nanoseconds")
+	b.int64(14, str("time"))
+	for _, s := range table {
+		b.bytes(6, []byte(s))
+	}
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(b.data); err != nil {
+		return err
+	}
+	return gz.Close()
+}
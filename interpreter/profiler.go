@@ -0,0 +1,297 @@
+package interpreter
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Profile records how much time a program spent in each of its functions and lines.
+type Profile struct {
+	// Duration is the time the whole program took.
+	Duration time.Duration
+	// Functions contains all called functions sorted by their self time.
+	Functions []ProfileEntry
+	// Lines contains all executed lines sorted by their self time.
+	Lines []ProfileEntry
+	root  *profileNode
+}
+
+// ProfileEntry is a function or line of a profiled program.
+type ProfileEntry struct {
+	// Name is the name of the function or the source code of the line.
+	Name string
+	// Path is the file containing the function or line.
+	Path string
+	// Line is the line of the function declaration or the line itself, starting at 0.
+	Line int
+	// Count is the number of calls of the function or executions of the line.
+	Count int
+	// Self is the time spent in the function or line itself without the functions and nested statements it executed.
+	Self time.Duration
+	// Total is the time spent in the function or line including everything it executed.
+	Total time.Duration
+	// the number of active calls or executions, recursive ones are only added to Total once
+	active int
+}
+
+// profileNode is a function or line in the tree of all call stacks of the program.
+// The children of a function are its lines, the children of a line are the functions called by it.
+type profileNode struct {
+	entry    *ProfileEntry
+	function bool
+	parent   *profileNode
+	children map[*ProfileEntry]*profileNode
+	self     time.Duration
+	count    int
+}
+
+func (n *profileNode) child(entry *ProfileEntry, function bool) *profileNode {
+	child, ok := n.children[entry]
+	if !ok {
+		child = &profileNode{
+			entry:    entry,
+			function: function,
+			parent:   n,
+			children: make(map[*ProfileEntry]*profileNode),
+		}
+		n.children[entry] = child
+	}
+	return child
+}
+
+// profileActivation is an active function call or statement.
+type profileActivation struct {
+	node  *profileNode
+	start time.Time
+	// the time spent in nested activations
+	children time.Duration
+}
+
+type profileKey struct {
+	path string
+	line int
+	name string
+}
+
+// profiler measures the time of every function call and statement executed by the tree-walking interpreter.
+type profiler struct {
+	start     time.Time
+	root      *profileNode
+	functions map[profileKey]*ProfileEntry
+	lines     map[profileKey]*ProfileEntry
+	// the innermost activation is the last one
+	activations []profileActivation
+	// the index of the innermost function call in activations
+	calls []int
+}
+
+func newProfiler() *profiler {
+	p := &profiler{
+		functions: make(map[profileKey]*ProfileEntry),
+		lines:     make(map[profileKey]*ProfileEntry),
+	}
+	script := &ProfileEntry{Name: "<script>", Line: -1}
+	p.functions[profileKey{line: -1, name: script.Name}] = script
+	p.root = &profileNode{
+		entry:    script,
+		function: true,
+		children: make(map[*ProfileEntry]*profileNode),
+	}
+	p.start = time.Now()
+	p.begin(p.root)
+	p.calls = append(p.calls, 0)
+	return p
+}
+
+// enterFunction starts measuring a call of the function declared at location, which must be ended with leaveFunction.
+func (p *profiler) enterFunction(name string, location Token) {
+	key := profileKey{path: location.path(), line: location.Line, name: name}
+	entry, ok := p.functions[key]
+	if !ok {
+		entry = &ProfileEntry{Name: name, Path: key.path, Line: key.line}
+		p.functions[key] = entry
+	}
+	parent := p.activations[len(p.activations)-1].node
+	p.calls = append(p.calls, len(p.activations))
+	p.begin(parent.child(entry, true))
+}
+
+func (p *profiler) leaveFunction() {
+	p.calls = p.calls[:len(p.calls)-1]
+	p.end()
+}
+
+// beforeStatement starts measuring the execution of stmt, which must be ended with afterStatement if it returns true.
+// Blocks and statements without a known location are attributed to the enclosing statement.
+func (p *profiler) beforeStatement(stmt Stmt) bool {
+	if _, ok := stmt.(*StmtBlock); ok {
+		return false
+	}
+	location, ok := stmtLocation(stmt)
+	if !ok {
+		return false
+	}
+	key := profileKey{path: location.path(), line: location.Line}
+	entry, ok := p.lines[key]
+	if !ok {
+		entry = &ProfileEntry{
+			Name: strings.TrimSpace(string(location.lineText())),
+			Path: key.path,
+			Line: key.line,
+		}
+		p.lines[key] = entry
+	}
+	function := p.activations[p.calls[len(p.calls)-1]].node
+	p.begin(function.child(entry, false))
+	return true
+}
+
+func (p *profiler) afterStatement() {
+	p.end()
+}
+
+func (p *profiler) begin(node *profileNode) {
+	node.count++
+	node.entry.Count++
+	node.entry.active++
+	p.activations = append(p.activations, profileActivation{
+		node:  node,
+		start: time.Now(),
+	})
+}
+
+func (p *profiler) end() {
+	a := p.activations[len(p.activations)-1]
+	p.activations = p.activations[:len(p.activations)-1]
+
+	elapsed := time.Since(a.start)
+	self := elapsed - a.children
+	a.node.self += self
+	a.node.entry.Self += self
+	if !a.node.function {
+		// the self time of a line is also part of the self time of its function
+		a.node.parent.entry.Self += self
+	}
+	a.node.entry.active--
+	if a.node.entry.active == 0 {
+		a.node.entry.Total += elapsed
+	}
+	if len(p.activations) > 0 {
+		p.activations[len(p.activations)-1].children += elapsed
+	}
+}
+
+// finish ends all activations, e.g. after an error, and returns the profile.
+func (p *profiler) finish() *Profile {
+	for len(p.activations) > 0 {
+		p.end()
+	}
+	profile := &Profile{
+		Duration:  time.Since(p.start),
+		Functions: sortedProfileEntries(p.functions),
+		Lines:     sortedProfileEntries(p.lines),
+		root:      p.root,
+	}
+	return profile
+}
+
+func sortedProfileEntries(entries map[profileKey]*ProfileEntry) []ProfileEntry {
+	sorted := make([]ProfileEntry, 0, len(entries))
+	for _, e := range entries {
+		sorted = append(sorted, *e)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Self != b.Self {
+			return a.Self > b.Self
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Name < b.Name
+	})
+	return sorted
+}
+
+// location returns the path and line of the entry, e.g. 'main.cb:12'.
+func (e ProfileEntry) location() string {
+	if e.Line < 0 {
+		return ""
+	}
+	if e.Path == "" {
+		return fmt.Sprint(e.Line + 1)
+	}
+	return fmt.Sprintf("%s:%d", e.Path, e.Line+1)
+}
+
+// WriteText writes a report of the functions and lines sorted by their self time to w.
+func (p *Profile) WriteText(w io.Writer) error {
+	percent := func(d time.Duration) float64 {
+		if p.Duration <= 0 {
+			return 0
+		}
+		return float64(d) / float64(p.Duration) * 100
+	}
+	milliseconds := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Total time: %.3fms\n", milliseconds(p.Duration))
+
+	fmt.Fprintf(&b, "\nFunctions:\n%12s %7s %12s %7s %10s  %s\n", "self (ms)", "self%", "total (ms)", "total%", "calls", "function")
+	for _, f := range p.Functions {
+		name := f.Name
+		if location := f.location(); location != "" {
+			name = fmt.Sprintf("%s (%s)", name, location)
+		}
+		fmt.Fprintf(&b, "%12.3f %6.2f%% %12.3f %6.2f%% %10d  %s\n", milliseconds(f.Self), percent(f.Self), milliseconds(f.Total), percent(f.Total), f.Count, name)
+	}
+
+	fmt.Fprintf(&b, "\nLines:\n%12s %7s %12s %7s %10s  %s\n", "self (ms)", "self%", "total (ms)", "total%", "count", "line")
+	for _, l := range p.Lines {
+		fmt.Fprintf(&b, "%12.3f %6.2f%% %12.3f %6.2f%% %10d  %s: %s\n", milliseconds(l.Self), percent(l.Self), milliseconds(l.Total), percent(l.Total), l.Count, l.location(), l.Name)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteFolded writes the call stacks of the program in the folded format used by flame graph tools to w.
+// Every line contains the names of the functions of a call stack separated by ';' and the self time
+// of the innermost function in microseconds.
+func (p *Profile) WriteFolded(w io.Writer) error {
+	stacks := make(map[string]time.Duration)
+	var walk func(node *profileNode, stack string)
+	walk = func(node *profileNode, stack string) {
+		if node.function {
+			name := strings.ReplaceAll(node.entry.Name, ";", ":")
+			if stack != "" {
+				stack += ";"
+			}
+			stack += name
+		}
+		stacks[stack] += node.self
+		for _, child := range node.children {
+			walk(child, stack)
+		}
+	}
+	walk(p.root, "")
+
+	folded := make([]string, 0, len(stacks))
+	for stack, self := range stacks {
+		if microseconds := self.Microseconds(); microseconds > 0 {
+			folded = append(folded, fmt.Sprintf("%s %d\n", stack, microseconds))
+		}
+	}
+	sort.Strings(folded)
+
+	_, err := io.WriteString(w, strings.Join(folded, ""))
+	return err
+}
@@ -0,0 +1,289 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// Engine selects how a Runtime executes programs.
+type Engine string
+
+const (
+	// EngineTree walks the syntax tree.
+	EngineTree Engine = "tree"
+	// EngineVM compiles the program to bytecode and executes it with the virtual machine.
+	EngineVM Engine = "vm"
+)
+
+// Runtime embeds crab into a Go program.
+// It loads a program, after which the functions and variables of the program can be accessed from Go.
+type Runtime struct {
+	engine  Engine
+	stdin   io.Reader
+	stdout  io.Writer
+	stderr  io.Writer
+	natives map[string]Callable
+	limits  Limits
+	// set by Load
+	interpreter *Interpreter
+}
+
+// Option configures a Runtime.
+type Option func(r *Runtime)
+
+// WithStdin sets the reader the program reads its input from. The default is os.Stdin.
+func WithStdin(stdin io.Reader) Option {
+	return func(r *Runtime) {
+		r.stdin = stdin
+	}
+}
+
+// WithStdout sets the writer the program writes its output to. The default is os.Stdout.
+func WithStdout(stdout io.Writer) Option {
+	return func(r *Runtime) {
+		r.stdout = stdout
+	}
+}
+
+// WithStderr sets the writer warnings of the checker are written to. The default is os.Stderr.
+func WithStderr(stderr io.Writer) Option {
+	return func(r *Runtime) {
+		r.stderr = stderr
+	}
+}
+
+// WithEngine sets the engine which executes the program. The default is EngineTree.
+func WithEngine(engine Engine) Option {
+	return func(r *Runtime) {
+		r.engine = engine
+	}
+}
+
+// WithLimits restricts the resources the program can use. By default there are no limits.
+func WithLimits(limits Limits) Option {
+	return func(r *Runtime) {
+		r.limits = limits
+	}
+}
+
+// WithFunction makes fn available under name in the program and all modules it imports, just like a builtin function.
+func WithFunction(name string, fn Callable) Option {
+	return func(r *Runtime) {
+		r.natives[name] = fn
+	}
+}
+
+// NewRuntime returns a runtime without a loaded program.
+func NewRuntime(options ...Option) *Runtime {
+	r := &Runtime{
+		engine:  EngineTree,
+		stdin:   os.Stdin,
+		stdout:  os.Stdout,
+		stderr:  os.Stderr,
+		natives: make(map[string]Callable),
+	}
+	for _, option := range options {
+		option(r)
+	}
+	return r
+}
+
+// Load scans, parses and checks source and executes all of its top-level declarations.
+// Unlike Interpret no main function is required. Warnings are written to stderr.
+// A runtime can only load one program.
+func (r *Runtime) Load(source io.Reader, path string) error {
+	if r.interpreter != nil {
+		return errors.New("A program is already loaded.")
+	}
+	if r.engine != EngineTree && r.engine != EngineVM {
+		return fmt.Errorf("Unknown engine '%s'.", r.engine)
+	}
+	for name := range r.natives {
+		if _, ok := nativeFunctions[name]; ok {
+			return fmt.Errorf("Cannot register function '%s': the name is already used by a builtin function.", name)
+		}
+		tokens, err := Scan(strings.NewReader(name), "")
+		if err != nil || len(tokens) != 2 || tokens[0].Type != IDENTIFIER {
+			return fmt.Errorf("Cannot register function '%s': the name is not a valid identifier.", name)
+		}
+	}
+
+	tokens, err := Scan(source, path)
+	if err != nil {
+		return err
+	}
+	program, errs := Parse(tokens)
+	if len(errs) > 0 {
+		return errorList(errs)
+	}
+
+	loader := newModuleLoader()
+	loader.natives = r.natives
+	checker := newChecker(loader)
+	// the globals are used by the host program
+	checker.check(program, false)
+	for _, d := range checker.diagnostics {
+		if d.Severity == SeverityWarning {
+			fmt.Fprintln(r.stderr, d)
+		}
+	}
+	if err := checker.errors(); err != nil {
+		return err
+	}
+
+	if r.engine == EngineVM {
+		bytecode, err := Compile(program)
+		if err != nil {
+			return err
+		}
+		vm := newVM(r.stdin, r.stdout, r.natives)
+		vm.interpreter.limits = r.limits
+		r.interpreter = vm.interpreter
+		return vm.runScript(bytecode)
+	}
+
+	r.interpreter = newInterpreter(r.stdin, r.stdout, r.natives)
+	r.interpreter.limits = r.limits
+	for _, stmt := range program {
+		err := r.interpreter.executeTopLevel(stmt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Call calls the global function name of the loaded program with args converted by ToValue.
+// The return values are converted by FromValue. Uncaught exceptions are returned as Exception errors.
+func (r *Runtime) Call(name string, args ...any) ([]any, error) {
+	if r.interpreter == nil {
+		return nil, errors.New("No program loaded.")
+	}
+	value, ok := r.interpreter.env.names[name]
+	if !ok {
+		return nil, fmt.Errorf("Undefined function '%s'.", name)
+	}
+	callable, ok := value.(Callable)
+	if !ok {
+		return nil, fmt.Errorf("'%s' is not a function.", name)
+	}
+	if callable.ArgumentCount() != -1 && callable.ArgumentCount() != len(args) {
+		return nil, fmt.Errorf("Wrong argument count. Expected %d, got %d.", callable.ArgumentCount(), len(args))
+	}
+
+	values := make([]any, len(args))
+	for index, a := range args {
+		v, err := ToValue(a)
+		if err != nil {
+			return nil, err
+		}
+		values[index] = v
+	}
+
+	result, err := callable.Call(r.interpreter, values)
+	if err != nil {
+		return nil, err
+	}
+
+	if ret, ok := result.(multiValueReturn); ok {
+		results := make([]any, len(ret))
+		for index, v := range ret {
+			results[index] = FromValue(v)
+		}
+		return results, nil
+	}
+	if result == nil && callable.ReturnValueCount() == 0 {
+		return []any{}, nil
+	}
+	return []any{FromValue(result)}, nil
+}
+
+// Global returns the value of the global variable name of the loaded program converted by FromValue.
+func (r *Runtime) Global(name string) (any, bool) {
+	if r.interpreter == nil {
+		return nil, false
+	}
+	value, ok := r.interpreter.env.names[name]
+	if !ok {
+		return nil, false
+	}
+	return FromValue(value), true
+}
+
+// ToValue converts a Go value to a crab value.
+// All integer and floating point types become numbers, slices and arrays become lists and maps become maps.
+// Booleans, strings, nil and values returned by FromValue are kept as they are.
+func ToValue(value any) (any, error) {
+	switch v := value.(type) {
+	case nil, bool, string, float64, list, hashMap, rangeValue, Callable, *instance, *class, namespace:
+		return v, nil
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return rv.Bool(), nil
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.Slice, reflect.Array:
+		values := make(list, rv.Len())
+		for index := range values {
+			v, err := ToValue(rv.Index(index).Interface())
+			if err != nil {
+				return nil, err
+			}
+			values[index] = v
+		}
+		return values, nil
+	case reflect.Map:
+		values := make(hashMap, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			key, err := ToValue(iter.Key().Interface())
+			if err != nil {
+				return nil, err
+			}
+			if !isValidMapKey(key) {
+				return nil, fmt.Errorf("Cannot convert map with key type '%s': map key must be a number, string or boolean.", rv.Type().Key())
+			}
+			v, err := ToValue(iter.Value().Interface())
+			if err != nil {
+				return nil, err
+			}
+			values[key] = v
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("Cannot convert value of type '%T' to a crab value.", value)
+}
+
+// FromValue converts a crab value to a Go value.
+// Numbers are float64, lists become []any and maps become map[any]any.
+// Functions, classes, instances and modules are returned as they are and can be passed back with ToValue.
+func FromValue(value any) any {
+	switch v := value.(type) {
+	case list:
+		values := make([]any, len(v))
+		for index, element := range v {
+			values[index] = FromValue(element)
+		}
+		return values
+	case hashMap:
+		values := make(map[any]any, len(v))
+		for key, element := range v {
+			values[key] = FromValue(element)
+		}
+		return values
+	}
+	return value
+}
@@ -0,0 +1,20 @@
+package interpreter_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Bananenpro/crab/interpreter"
+)
+
+func TestRuntimeErrorsWithoutColors(t *testing.T) {
+	r := interpreter.NewRuntime(interpreter.WithStdout(io.Discard), interpreter.WithStderr(io.Discard))
+	err := r.Load(strings.NewReader("func main() {\n\tprintln(missing);\n}\n"), "test.cb")
+	if err == nil {
+		t.Fatal("expected an error for an undefined name")
+	}
+	if strings.Contains(err.Error(), "\x1b[") {
+		t.Errorf("error contains ANSI escape sequences: %q", err.Error())
+	}
+}
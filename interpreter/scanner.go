@@ -5,28 +5,39 @@ import (
 	"fmt"
 	"io"
 	"strconv"
+	"strings"
 )
 
 type scanner struct {
 	fileScanner      *bufio.Scanner
-	lines            [][]rune
+	file             *SourceFile
 	line             int
 	tokenStartColumn int
 	currentColumn    int
 	tokens           []Token
+	// emit COMMENT tokens instead of discarding comments
+	keepComments bool
 }
 
-func Scan(source io.Reader) ([]Token, [][]rune, error) {
+func Scan(source io.Reader, path string) ([]Token, error) {
+	return scan(source, path, false)
+}
+
+func scan(source io.Reader, path string, keepComments bool) ([]Token, error) {
 	fileScanner := bufio.NewScanner(source)
 
 	srcScanner := &scanner{
 		fileScanner: fileScanner,
-		line:        -1,
+		file: &SourceFile{
+			Path: path,
+		},
+		line:         -1,
+		keepComments: keepComments,
 	}
 
 	err := srcScanner.scan()
 
-	return srcScanner.tokens, srcScanner.lines, err
+	return srcScanner.tokens, err
 }
 
 func (s *scanner) scan() error {
@@ -36,155 +47,172 @@ func (s *scanner) scan() error {
 	}
 
 	for c != '\000' {
-		switch c {
-		case '+':
-			if s.match('=') {
-				s.addToken(PLUS_EQUAL, nil)
-			} else if s.match('+') {
-				s.addToken(PLUS_PLUS, nil)
-			} else {
-				s.addToken(PLUS, nil)
-			}
-		case '-':
-			if s.match('=') {
-				s.addToken(MINUS_EQUAL, nil)
-			} else if s.match('-') {
-				s.addToken(MINUS_MINUS, nil)
-			} else {
-				s.addToken(MINUS, nil)
-			}
-		case '*':
-			if s.match('=') {
-				s.addToken(ASTERISK_EQUAL, nil)
-			} else if s.match('*') {
-				if s.match('=') {
-					s.addToken(ASTERISK_ASTERISK_EQUAL, nil)
-				} else {
-					s.addToken(ASTERISK_ASTERISK, nil)
-				}
-			} else {
-				s.addToken(ASTERISK, nil)
-			}
-		case '%':
-			if s.match('=') {
-				s.addToken(PERCENT_EQUAL, nil)
-			} else {
-				s.addToken(PERCENT, nil)
-			}
+		err = s.scanToken(c)
+		if err != nil {
+			return err
+		}
 
-		case '(':
-			s.addToken(OPEN_PAREN, nil)
-		case ')':
-			s.addToken(CLOSE_PAREN, nil)
-		case '{':
-			s.addToken(OPEN_BRACE, nil)
-		case '}':
-			s.addToken(CLOSE_BRACE, nil)
-		case '[':
-			s.addToken(OPEN_BRACKET, nil)
-		case ']':
-			s.addToken(CLOSE_BRACKET, nil)
-
-		case '=':
-			if s.match('=') {
-				s.addToken(EQUAL_EQUAL, nil)
-			} else {
-				s.addToken(EQUAL, nil)
-			}
-		case '!':
-			if s.match('=') {
-				s.addToken(BANG_EQUAL, nil)
-			} else {
-				s.addToken(BANG, nil)
-			}
-		case '<':
-			if s.match('=') {
-				s.addToken(LESS_EQUAL, nil)
-			} else {
-				s.addToken(LESS, nil)
-			}
-		case '>':
+		c, err = s.nextCharacter()
+		if err != nil {
+			return err
+		}
+		s.tokenStartColumn = s.currentColumn
+	}
+
+	if s.line < 0 {
+		s.file.Lines = append(s.file.Lines, []rune{})
+		s.line = 0
+	}
+
+	s.tokens = append(s.tokens, Token{
+		Line:   s.line,
+		Column: len(s.file.Lines[s.line]),
+		Type:   EOF,
+		Lexeme: "",
+		File:   s.file,
+	})
+
+	return nil
+}
+
+// scanToken scans the token starting with c.
+func (s *scanner) scanToken(c rune) error {
+	switch c {
+	case '+':
+		if s.match('=') {
+			s.addToken(PLUS_EQUAL, nil)
+		} else if s.match('+') {
+			s.addToken(PLUS_PLUS, nil)
+		} else {
+			s.addToken(PLUS, nil)
+		}
+	case '-':
+		if s.match('=') {
+			s.addToken(MINUS_EQUAL, nil)
+		} else if s.match('-') {
+			s.addToken(MINUS_MINUS, nil)
+		} else {
+			s.addToken(MINUS, nil)
+		}
+	case '*':
+		if s.match('=') {
+			s.addToken(ASTERISK_EQUAL, nil)
+		} else if s.match('*') {
 			if s.match('=') {
-				s.addToken(GREATER_EQUAL, nil)
+				s.addToken(ASTERISK_ASTERISK_EQUAL, nil)
 			} else {
-				s.addToken(GREATER, nil)
+				s.addToken(ASTERISK_ASTERISK, nil)
 			}
+		} else {
+			s.addToken(ASTERISK, nil)
+		}
+	case '%':
+		if s.match('=') {
+			s.addToken(PERCENT_EQUAL, nil)
+		} else {
+			s.addToken(PERCENT, nil)
+		}
 
-		case '&':
-			if s.match('&') {
-				s.addToken(AND, nil)
-			} else {
-				return s.newError(fmt.Sprintf("Unexpected character '%c'.", c))
-			}
-		case '|':
-			if s.match('|') {
-				s.addToken(OR, nil)
-			} else {
-				return s.newError(fmt.Sprintf("Unexpected character '%c'.", c))
-			}
-		case '^':
-			if s.match('^') {
-				s.addToken(XOR, nil)
-			} else {
-				return s.newError(fmt.Sprintf("Unexpected character '%c'.", c))
-			}
+	case '(':
+		s.addToken(OPEN_PAREN, nil)
+	case ')':
+		s.addToken(CLOSE_PAREN, nil)
+	case '{':
+		s.addToken(OPEN_BRACE, nil)
+	case '}':
+		s.addToken(CLOSE_BRACE, nil)
+	case '[':
+		s.addToken(OPEN_BRACKET, nil)
+	case ']':
+		s.addToken(CLOSE_BRACKET, nil)
+
+	case '=':
+		if s.match('=') {
+			s.addToken(EQUAL_EQUAL, nil)
+		} else {
+			s.addToken(EQUAL, nil)
+		}
+	case '!':
+		if s.match('=') {
+			s.addToken(BANG_EQUAL, nil)
+		} else {
+			s.addToken(BANG, nil)
+		}
+	case '<':
+		if s.match('=') {
+			s.addToken(LESS_EQUAL, nil)
+		} else {
+			s.addToken(LESS, nil)
+		}
+	case '>':
+		if s.match('=') {
+			s.addToken(GREATER_EQUAL, nil)
+		} else {
+			s.addToken(GREATER, nil)
+		}
 
-		case '/':
-			if s.match('/') {
-				s.comment()
-			} else if s.match('*') {
-				err := s.blockComment()
-				if err != nil {
-					return err
-				}
-			} else if s.match('=') {
-				s.addToken(SLASH_EQUAL, nil)
-			} else {
-				s.addToken(SLASH, nil)
-			}
+	case '&':
+		if s.match('&') {
+			s.addToken(AND, nil)
+		} else {
+			return s.newError(fmt.Sprintf("Unexpected character '%c'.", c))
+		}
+	case '|':
+		if s.match('|') {
+			s.addToken(OR, nil)
+		} else {
+			return s.newError(fmt.Sprintf("Unexpected character '%c'.", c))
+		}
+	case '^':
+		if s.match('^') {
+			s.addToken(XOR, nil)
+		} else {
+			return s.newError(fmt.Sprintf("Unexpected character '%c'.", c))
+		}
 
-		case ';':
-			s.addToken(SEMICOLON, nil)
-		case ',':
-			s.addToken(COMMA, nil)
-		case '?':
-			s.addToken(QUESTION_MARK, nil)
-		case ':':
-			s.addToken(COLON, nil)
-
-		case '"':
-			err := s.string()
+	case '/':
+		if s.match('/') {
+			s.comment()
+		} else if s.match('*') {
+			err := s.blockComment()
 			if err != nil {
 				return err
 			}
-
-		case ' ', '\t':
-			break
-
-		default:
-			if isDigit(c) {
-				s.number()
-			} else if isAlpha(c) {
-				s.identifier()
-			} else {
-				return s.newError(fmt.Sprintf("Unexpected character '%c'.", c))
-			}
+		} else if s.match('=') {
+			s.addToken(SLASH_EQUAL, nil)
+		} else {
+			s.addToken(SLASH, nil)
 		}
 
-		c, err = s.nextCharacter()
+	case ';':
+		s.addToken(SEMICOLON, nil)
+	case ',':
+		s.addToken(COMMA, nil)
+	case '.':
+		s.addToken(DOT, nil)
+	case '?':
+		s.addToken(QUESTION_MARK, nil)
+	case ':':
+		s.addToken(COLON, nil)
+
+	case '"':
+		err := s.string()
 		if err != nil {
 			return err
 		}
-		s.tokenStartColumn = s.currentColumn
-	}
 
-	s.tokens = append(s.tokens, Token{
-		Line:   s.line,
-		Column: len(s.lines[s.line]),
-		Type:   EOF,
-		Lexeme: "",
-	})
+	case ' ', '\t':
+		break
 
+	default:
+		if isDigit(c) {
+			s.number()
+		} else if isAlpha(c) {
+			s.identifier()
+		} else {
+			return s.newError(fmt.Sprintf("Unexpected character '%c'.", c))
+		}
+	}
 	return nil
 }
 
@@ -200,7 +228,7 @@ func (s *scanner) number() {
 		}
 	}
 
-	value, _ := strconv.ParseFloat(string(s.lines[s.line][s.tokenStartColumn:s.currentColumn+1]), 64)
+	value, _ := strconv.ParseFloat(string(s.file.Lines[s.line][s.tokenStartColumn:s.currentColumn+1]), 64)
 	s.addToken(NUMBER, value)
 }
 
@@ -223,9 +251,21 @@ func (s *scanner) string() error {
 				characters = append(characters, '\\')
 			case '"':
 				characters = append(characters, '"')
+			case '$':
+				characters = append(characters, '$')
 			default:
 				return s.newError("Unknown escape sequence.")
 			}
+		} else if c == '$' && s.peek() == '{' {
+			s.nextCharacter()
+			s.addToken(INTERPOLATION, string(characters))
+			characters = make([]rune, 0)
+			err := s.interpolation()
+			if err != nil {
+				return err
+			}
+			// the next part of the string starts with the closing '}'
+			s.tokenStartColumn = s.currentColumn
 		} else {
 			characters = append(characters, c)
 		}
@@ -237,12 +277,40 @@ func (s *scanner) string() error {
 	return nil
 }
 
+// interpolation scans the tokens of an expression embedded in a string literal up to and including the closing '}'.
+func (s *scanner) interpolation() error {
+	line := s.line
+	depth := 0
+	for {
+		if s.peek() == '\n' {
+			return s.newError("Unterminated string interpolation.")
+		}
+		c, _ := s.nextCharacter()
+		if c == '}' {
+			if depth == 0 {
+				return nil
+			}
+			depth--
+		} else if c == '{' {
+			depth++
+		}
+		s.tokenStartColumn = s.currentColumn
+		err := s.scanToken(c)
+		if err != nil {
+			return err
+		}
+		if s.line != line {
+			return s.newError("Unterminated string interpolation.")
+		}
+	}
+}
+
 func (s *scanner) identifier() {
 	for isAlphaNum(s.peek()) {
 		s.nextCharacter()
 	}
 
-	name := string(s.lines[s.line][s.tokenStartColumn : s.currentColumn+1])
+	name := string(s.file.Lines[s.line][s.tokenStartColumn : s.currentColumn+1])
 
 	switch name {
 	case "true":
@@ -261,6 +329,12 @@ func (s *scanner) identifier() {
 		s.addToken(WHILE, nil)
 	case "for":
 		s.addToken(FOR, nil)
+	case "in":
+		s.addToken(IN, nil)
+	case "match":
+		s.addToken(MATCH, nil)
+	case "case":
+		s.addToken(CASE, nil)
 	case "break":
 		s.addToken(BREAK, nil)
 	case "continue":
@@ -271,10 +345,22 @@ func (s *scanner) identifier() {
 		s.addToken(TRY, nil)
 	case "catch":
 		s.addToken(CATCH, nil)
+	case "finally":
+		s.addToken(FINALLY, nil)
+	case "defer":
+		s.addToken(DEFER, nil)
 	case "throw":
 		s.addToken(THROW, nil)
 	case "throws":
 		s.addToken(THROWS, nil)
+	case "import":
+		s.addToken(IMPORT, nil)
+	case "as":
+		s.addToken(AS, nil)
+	case "class":
+		s.addToken(CLASS, nil)
+	case "this":
+		s.addToken(THIS, nil)
 	default:
 		s.addToken(IDENTIFIER, nil)
 	}
@@ -284,9 +370,14 @@ func (s *scanner) comment() {
 	for s.peek() != '\n' {
 		s.nextCharacter()
 	}
+	if s.keepComments {
+		s.addToken(COMMENT, nil)
+	}
 }
 
 func (s *scanner) blockComment() error {
+	startLine := s.line
+	startColumn := s.tokenStartColumn
 	nestingLevel := 1
 	for nestingLevel > 0 {
 		c, err := s.nextCharacter()
@@ -302,35 +393,55 @@ func (s *scanner) blockComment() error {
 			continue
 		}
 	}
+
+	if s.keepComments {
+		lines := make([]string, 0, s.line-startLine+1)
+		lines = append(lines, string(s.file.Lines[startLine][startColumn:]))
+		for line := startLine + 1; line < s.line; line++ {
+			lines = append(lines, string(s.file.Lines[line]))
+		}
+		if s.line > startLine {
+			lines = append(lines, string(s.file.Lines[s.line][:s.currentColumn+1]))
+		} else {
+			lines[0] = string(s.file.Lines[startLine][startColumn : s.currentColumn+1])
+		}
+		s.tokens = append(s.tokens, Token{
+			Line:   startLine,
+			Column: startColumn,
+			Type:   COMMENT,
+			Lexeme: strings.Join(lines, "\n"),
+			File:   s.file,
+		})
+	}
 	return nil
 }
 
 func (s *scanner) nextCharacter() (rune, error) {
 	s.currentColumn++
-	for s.line == -1 || s.currentColumn >= len(s.lines[s.line]) {
+	for s.line == -1 || s.currentColumn >= len(s.file.Lines[s.line]) {
 		notDone, err := s.nextLine()
 		if !notDone {
 			return '\000', err
 		}
 	}
 
-	return s.lines[s.line][s.currentColumn], nil
+	return s.file.Lines[s.line][s.currentColumn], nil
 }
 
 func (s *scanner) peek() rune {
-	if s.currentColumn+1 == len(s.lines[s.line]) {
+	if s.currentColumn+1 == len(s.file.Lines[s.line]) {
 		return '\n'
 	}
 
-	return s.lines[s.line][s.currentColumn+1]
+	return s.file.Lines[s.line][s.currentColumn+1]
 }
 
 func (s *scanner) peekNext() rune {
-	if s.currentColumn+2 == len(s.lines[s.line]) {
+	if s.currentColumn+2 == len(s.file.Lines[s.line]) {
 		return '\n'
 	}
 
-	return s.lines[s.line][s.currentColumn+2]
+	return s.file.Lines[s.line][s.currentColumn+2]
 }
 
 func (s *scanner) match(char rune) bool {
@@ -345,7 +456,7 @@ func (s *scanner) nextLine() (bool, error) {
 	if !s.fileScanner.Scan() {
 		return false, s.fileScanner.Err()
 	}
-	s.lines = append(s.lines, []rune(s.fileScanner.Text()))
+	s.file.Lines = append(s.file.Lines, []rune(s.fileScanner.Text()))
 	s.line++
 	s.currentColumn = 0
 	s.tokenStartColumn = 0
@@ -358,11 +469,17 @@ func (s *scanner) addToken(tokenType TokenType, literal any) {
 		Line:    s.line,
 		Column:  s.tokenStartColumn,
 		Type:    tokenType,
-		Lexeme:  string(s.lines[s.line][s.tokenStartColumn : s.currentColumn+1]),
+		Lexeme:  string(s.file.Lines[s.line][s.tokenStartColumn : s.currentColumn+1]),
 		Literal: literal,
+		File:    s.file,
 	})
 }
 
+// isTemplateContinuation reports whether t is the part of a string literal which starts with the closing '}' of an interpolation.
+func isTemplateContinuation(t Token) bool {
+	return (t.Type == INTERPOLATION || t.Type == STRING) && strings.HasPrefix(t.Lexeme, "}")
+}
+
 func isDigit(char rune) bool {
 	return char >= '0' && char <= '9'
 }
@@ -375,7 +492,20 @@ func isAlphaNum(char rune) bool {
 	return isDigit(char) || isAlpha(char)
 }
 
+func isIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		if !isAlpha(c) && (i == 0 || !isDigit(c)) {
+			return false
+		}
+	}
+	return true
+}
+
 type ScanError struct {
+	Path     string
 	Line     int
 	LineText []rune
 	Column   int
@@ -383,13 +513,14 @@ type ScanError struct {
 }
 
 func (s ScanError) Error() string {
-	return generateErrorText(s.Message, s.LineText, s.Line, s.Column, s.Column+1)
+	return generateErrorText(s.Message, s.Path, s.LineText, s.Line, s.Column, s.Column+1)
 }
 
 func (s *scanner) newError(msg string) error {
 	return ScanError{
+		Path:     s.file.Path,
 		Line:     s.line,
-		LineText: s.lines[s.line],
+		LineText: s.file.Lines[s.line],
 		Column:   s.currentColumn,
 		Message:  msg,
 	}
@@ -0,0 +1,143 @@
+package interpreter
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Session executes consecutive inputs of an interactive shell.
+// Names defined by previous inputs stay available in later ones.
+type Session struct {
+	checker     *checker
+	interpreter *Interpreter
+	// receives the warnings of the inputs
+	stderr io.Writer
+}
+
+// NewSession returns a session whose programs read their input from stdin and write their output to stdout.
+// If the shell reads its inputs from the same source, it should pass a *bufio.Reader, which is shared with the programs
+// instead of buffering input meant for the shell.
+func NewSession(stdin io.Reader, stdout, stderr io.Writer) *Session {
+	checker := newChecker(newModuleLoader())
+	checker.state["canThrow"] = true
+
+	return &Session{
+		checker:     checker,
+		interpreter: newInterpreter(stdin, stdout, nil),
+		stderr:      stderr,
+	}
+}
+
+// Execute runs all declarations and statements in tokens and returns the values of top-level expression statements.
+// A missing semicolon at the end of the input is inserted automatically.
+func (s *Session) Execute(tokens []Token) ([]string, error) {
+	if len(tokens) > 1 {
+		last := tokens[len(tokens)-2]
+		if last.Type != SEMICOLON && last.Type != CLOSE_BRACE {
+			eof := tokens[len(tokens)-1]
+			tokens = append(tokens[:len(tokens)-1:len(tokens)-1], Token{
+				Line:   last.Line,
+				Column: last.Column + len([]rune(last.Lexeme)),
+				Type:   SEMICOLON,
+				Lexeme: ";",
+				File:   last.File,
+			}, eof)
+		}
+	}
+
+	program, ok := parseMapLiteral(tokens)
+	if !ok {
+		parser := &parser{
+			tokens:                  tokens,
+			errors:                  make([]error, 0),
+			allowTopLevelStatements: true,
+		}
+		var errs []error
+		program, errs = parser.parse()
+		if len(errs) > 0 {
+			return nil, errorList(errs)
+		}
+	}
+
+	globals := make(map[string]variable, len(s.checker.scopes[0]))
+	for name, v := range s.checker.scopes[0] {
+		globals[name] = v
+	}
+
+	s.checker.check(program, false)
+	for _, d := range s.checker.diagnostics {
+		if d.Severity == SeverityWarning {
+			fmt.Fprintln(s.stderr, d)
+		}
+	}
+	err := s.checker.errors()
+	if err != nil {
+		s.checker.scopes = s.checker.scopes[:1]
+		s.checker.ends = s.checker.ends[:1]
+		s.checker.scope = 0
+		s.checker.scopes[0] = globals
+		return nil, err
+	}
+
+	results := make([]string, 0)
+	globalEnv := s.interpreter.env
+	for _, stmt := range program {
+		if exprStmt, ok := stmt.(*StmtExpression); ok {
+			var value any
+			value, err = exprStmt.Expr.Accept(s.interpreter)
+			if err != nil {
+				break
+			}
+			if values, ok := value.(multiValueReturn); ok {
+				texts := make([]string, len(values))
+				for i, v := range values {
+					texts[i] = toString(v)
+				}
+				results = append(results, strings.Join(texts, ", "))
+			} else if value != nil {
+				results = append(results, toString(value))
+			}
+			continue
+		}
+
+		err = s.interpreter.executeTopLevel(stmt)
+		if err != nil {
+			break
+		}
+	}
+
+	if err != nil {
+		s.interpreter.env = globalEnv
+		// forget names which the checker knows about but which were never defined because of the error
+		for name := range s.checker.scopes[0] {
+			if _, ok := globals[name]; !ok && !globalEnv.Exists(name) {
+				delete(s.checker.scopes[0], name)
+			}
+		}
+		return results, err
+	}
+
+	return results, nil
+}
+
+// parseMapLiteral parses tokens as a single expression statement if they start with an opening brace,
+// so a map literal is evaluated instead of being parsed as a block.
+func parseMapLiteral(tokens []Token) ([]Stmt, bool) {
+	if len(tokens) == 0 || tokens[0].Type != OPEN_BRACE {
+		return nil, false
+	}
+	parser := &parser{
+		tokens: tokens,
+		errors: make([]error, 0),
+	}
+	expr, err := parser.expression()
+	if err != nil || len(parser.errors) > 0 {
+		return nil, false
+	}
+	parser.match(SEMICOLON)
+	if parser.peek().Type != EOF {
+		return nil, false
+	}
+	return []Stmt{&StmtExpression{Expr: expr}}, true
+}
@@ -8,14 +8,21 @@ type StmtVisitor interface {
 	VisitIf(stmt *StmtIf) error
 	VisitWhile(stmt *StmtWhile) error
 	VisitFor(stmt *StmtFor) error
+	VisitForEach(stmt *StmtForEach) error
+	VisitMatch(stmt *StmtMatch) error
 	VisitLoopControl(stmt *StmtLoopControl) error
 	VisitReturn(stmt *StmtReturn) error
 	VisitThrow(stmt *StmtThrow) error
 	VisitTry(stmt *StmtTry) error
+	VisitDefer(stmt *StmtDefer) error
+	VisitImport(stmt *StmtImport) error
+	VisitClass(stmt *StmtClass) error
 }
 
 type Stmt interface {
 	Accept(visitor StmtVisitor) error
+	// execute executes the statement with the tree-walking interpreter and reports how it completed.
+	execute(i *Interpreter) (completion, error)
 }
 
 type StmtExpression struct {
@@ -26,7 +33,14 @@ func (s *StmtExpression) Accept(visitor StmtVisitor) error {
 	return visitor.VisitExpression(s)
 }
 
+func (s *StmtExpression) execute(i *Interpreter) (completion, error) {
+	return i.executeExpression(s)
+}
+
 type StmtBlock struct {
+	// OpenBrace is empty for the implicit block around for loops, whose CloseBrace is the last token of the loop body.
+	OpenBrace  Token
+	CloseBrace Token
 	Statements []Stmt
 }
 
@@ -34,6 +48,10 @@ func (s *StmtBlock) Accept(visitor StmtVisitor) error {
 	return visitor.VisitBlock(s)
 }
 
+func (s *StmtBlock) execute(i *Interpreter) (completion, error) {
+	return i.executeBlock(s)
+}
+
 type StmtVarDecl struct {
 	Operator Token
 	Names    []Token
@@ -44,10 +62,14 @@ func (s *StmtVarDecl) Accept(visitor StmtVisitor) error {
 	return visitor.VisitVarDecl(s)
 }
 
+func (s *StmtVarDecl) execute(i *Interpreter) (completion, error) {
+	return i.executeVarDecl(s)
+}
+
 type StmtFuncDecl struct {
 	Name             Token
 	Body             Stmt
-	Parameters       []string
+	Parameters       []Token
 	ReturnValueCount int
 	Throws           bool
 }
@@ -56,6 +78,24 @@ func (s *StmtFuncDecl) Accept(visitor StmtVisitor) error {
 	return visitor.VisitFuncDecl(s)
 }
 
+func (s *StmtFuncDecl) execute(i *Interpreter) (completion, error) {
+	return i.executeFuncDecl(s)
+}
+
+type StmtClass struct {
+	Name    Token
+	Fields  []*StmtVarDecl
+	Methods []*StmtFuncDecl
+}
+
+func (s *StmtClass) Accept(visitor StmtVisitor) error {
+	return visitor.VisitClass(s)
+}
+
+func (s *StmtClass) execute(i *Interpreter) (completion, error) {
+	return i.executeClass(s)
+}
+
 type StmtIf struct {
 	Keyword   Token
 	Condition Expr
@@ -67,6 +107,10 @@ func (s *StmtIf) Accept(visitor StmtVisitor) error {
 	return visitor.VisitIf(s)
 }
 
+func (s *StmtIf) execute(i *Interpreter) (completion, error) {
+	return i.executeIf(s)
+}
+
 type StmtWhile struct {
 	Keyword   Token
 	Condition Expr
@@ -77,6 +121,10 @@ func (s *StmtWhile) Accept(visitor StmtVisitor) error {
 	return visitor.VisitWhile(s)
 }
 
+func (s *StmtWhile) execute(i *Interpreter) (completion, error) {
+	return i.executeWhile(s)
+}
+
 type StmtFor struct {
 	Keyword     Token
 	Initializer Stmt
@@ -89,6 +137,74 @@ func (s *StmtFor) Accept(visitor StmtVisitor) error {
 	return visitor.VisitFor(s)
 }
 
+func (s *StmtFor) execute(i *Interpreter) (completion, error) {
+	return i.executeFor(s)
+}
+
+// StmtForEach iterates over the elements of a list, the characters of a string or the numbers of a range.
+type StmtForEach struct {
+	Keyword Token
+	// empty if the loop only declares a variable for the element
+	Index      Token
+	Element    Token
+	In         Token
+	Collection Expr
+	Body       Stmt
+}
+
+func (s *StmtForEach) Accept(visitor StmtVisitor) error {
+	return visitor.VisitForEach(s)
+}
+
+func (s *StmtForEach) execute(i *Interpreter) (completion, error) {
+	return i.executeForEach(s)
+}
+
+// StmtMatch executes the body of the first case with a pattern matching Value and a true guard.
+type StmtMatch struct {
+	Keyword Token
+	Value   Expr
+	Cases   []MatchCase
+}
+
+// MatchCase is a case of a match statement. Only a case with a single pattern can bind names.
+type MatchCase struct {
+	Keyword  Token
+	Patterns []Pattern
+	// nil if the case has no guard
+	Guard Expr
+	Body  Stmt
+}
+
+func (s *StmtMatch) Accept(visitor StmtVisitor) error {
+	return visitor.VisitMatch(s)
+}
+
+func (s *StmtMatch) execute(i *Interpreter) (completion, error) {
+	return i.executeMatch(s)
+}
+
+type PatternKind int
+
+const (
+	// matches values equal to Value
+	PatternLiteral PatternKind = iota
+	// '_' matches every value
+	PatternWildcard
+	// matches every value and binds it to the name Token
+	PatternBinding
+	// matches lists with one element for every pattern in Elements
+	PatternList
+)
+
+// Pattern is a pattern of a case in a match statement. Token is the first token of the pattern.
+type Pattern struct {
+	Kind     PatternKind
+	Token    Token
+	Value    any
+	Elements []Pattern
+}
+
 type StmtLoopControl struct {
 	Keyword Token
 }
@@ -97,6 +213,10 @@ func (s *StmtLoopControl) Accept(visitor StmtVisitor) error {
 	return visitor.VisitLoopControl(s)
 }
 
+func (s *StmtLoopControl) execute(i *Interpreter) (completion, error) {
+	return i.executeLoopControl(s)
+}
+
 type StmtReturn struct {
 	Keyword Token
 	Values  []Expr
@@ -106,6 +226,10 @@ func (s *StmtReturn) Accept(visitor StmtVisitor) error {
 	return visitor.VisitReturn(s)
 }
 
+func (s *StmtReturn) execute(i *Interpreter) (completion, error) {
+	return i.executeReturn(s)
+}
+
 type StmtThrow struct {
 	Keyword Token
 	Value   Expr
@@ -115,13 +239,59 @@ func (s *StmtThrow) Accept(visitor StmtVisitor) error {
 	return visitor.VisitThrow(s)
 }
 
+func (s *StmtThrow) execute(i *Interpreter) (completion, error) {
+	return i.executeThrow(s)
+}
+
 type StmtTry struct {
-	Keyword       Token
-	Body          Stmt
-	CatchBody     Stmt
-	ExceptionName Token
+	Keyword Token
+	Body    Stmt
+	Catches []CatchClause
+	// nil if there is no finally block
+	Finally Stmt
+}
+
+// CatchClause handles the exceptions of a try statement. Name and Kind are empty if they are omitted.
+type CatchClause struct {
+	Keyword Token
+	Name    Token
+	Kind    Token
+	Body    Stmt
 }
 
 func (s *StmtTry) Accept(visitor StmtVisitor) error {
 	return visitor.VisitTry(s)
 }
+
+func (s *StmtTry) execute(i *Interpreter) (completion, error) {
+	return i.executeTry(s)
+}
+
+// StmtDefer delays Call until the enclosing function returns. The callee and the arguments are evaluated immediately.
+type StmtDefer struct {
+	Keyword Token
+	Call    *ExprCall
+}
+
+func (s *StmtDefer) Accept(visitor StmtVisitor) error {
+	return visitor.VisitDefer(s)
+}
+
+func (s *StmtDefer) execute(i *Interpreter) (completion, error) {
+	return i.executeDefer(s)
+}
+
+type StmtImport struct {
+	Keyword   Token
+	Path      Token
+	Namespace Token
+	Module    *module
+}
+
+func (s *StmtImport) Accept(visitor StmtVisitor) error {
+	return visitor.VisitImport(s)
+}
+
+func (s *StmtImport) execute(i *Interpreter) (completion, error) {
+	return i.executeImport(s)
+}
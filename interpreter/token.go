@@ -43,9 +43,12 @@ const (
 	NUMBER     TokenType = "NUMBER"
 	STRING     TokenType = "STRING"
 	IDENTIFIER TokenType = "IDENTIFIER"
+	// a part of a string literal which is followed by an interpolated expression
+	INTERPOLATION TokenType = "INTERPOLATION"
 
 	SEMICOLON     TokenType = "SEMICOLON"
 	COMMA         TokenType = "COMMA"
+	DOT           TokenType = "DOT"
 	QUESTION_MARK TokenType = "QUESTION_MARK"
 	COLON         TokenType = "COLON"
 
@@ -57,25 +60,57 @@ const (
 	ELSE     TokenType = "ELSE"
 	WHILE    TokenType = "WHILE"
 	FOR      TokenType = "FOR"
+	IN       TokenType = "IN"
+	MATCH    TokenType = "MATCH"
+	CASE     TokenType = "CASE"
 	BREAK    TokenType = "BREAK"
 	CONTINUE TokenType = "CONTINUE"
 	RETURN   TokenType = "RETURN"
 	TRY      TokenType = "TRY"
 	CATCH    TokenType = "CATCH"
+	FINALLY  TokenType = "FINALLY"
+	DEFER    TokenType = "DEFER"
 	THROW    TokenType = "THROW"
 	THROWS   TokenType = "THROWS"
+	IMPORT   TokenType = "IMPORT"
+	AS       TokenType = "AS"
+	CLASS    TokenType = "CLASS"
+	THIS     TokenType = "THIS"
+
+	// only emitted when scanning for the formatter
+	COMMENT TokenType = "COMMENT"
 
 	EOF TokenType = "EOF"
 )
 
+type SourceFile struct {
+	Path  string
+	Lines [][]rune
+}
+
 type Token struct {
 	Line    int
 	Column  int
 	Type    TokenType
 	Lexeme  string
 	Literal any
+	File    *SourceFile
 }
 
 func (t Token) String() string {
 	return fmt.Sprintf("([%d:%d] %v %v %v)", t.Line+1, t.Column+1, t.Type, t.Lexeme, t.Literal)
 }
+
+func (t Token) path() string {
+	if t.File == nil {
+		return ""
+	}
+	return t.File.Path
+}
+
+func (t Token) lineText() []rune {
+	if t.File == nil || t.Line < 0 || t.Line >= len(t.File.Lines) {
+		return nil
+	}
+	return t.File.Lines[t.Line]
+}
@@ -0,0 +1,803 @@
+package interpreter
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+type closure struct {
+	proto    *prototype
+	upvalues []*upvalue
+	globals  *Environment
+}
+
+func (c *closure) Throws() bool {
+	return c.proto.throws
+}
+
+func (c *closure) ArgumentCount() int {
+	return c.proto.arity
+}
+
+func (c *closure) ReturnValueCount() int {
+	return c.proto.returnValueCount
+}
+
+func (c *closure) Call(i *Interpreter, args []any) (any, error) {
+	return i.vm.call(c, args, Token{Line: -1})
+}
+
+func (c *closure) String() string {
+	return fmt.Sprintf("<func %s>", c.proto.name)
+}
+
+// upvalue is a variable captured by a closure. It refers to a stack slot until the slot is discarded.
+type upvalue struct {
+	index  int
+	open   bool
+	closed any
+}
+
+type callFrame struct {
+	closure *closure
+	ip      int
+	// stack index of slot 0
+	base        int
+	handlerBase int
+	callSite    Token
+	// set if the frame initializes a new instance, which is returned instead of the return values
+	constructor bool
+	// the calls delayed by defer statements
+	deferred []deferredCall
+}
+
+type exceptionHandler struct {
+	frame    int
+	stackTop int
+	catchIP  int
+}
+
+type vm struct {
+	stack        []any
+	frames       []callFrame
+	handlers     []exceptionHandler
+	openUpvalues []*upvalue
+	modules      map[*module]namespace
+	// passed to native functions
+	interpreter *Interpreter
+}
+
+// RunBytecode executes a compiled program by calling its main function.
+func RunBytecode(bytecode *Bytecode, limits Limits) error {
+	return RunBytecodeFunction(bytecode, "main", limits)
+}
+
+// RunBytecodeFunction executes all top-level statements of a compiled program and calls the function name without any arguments.
+func RunBytecodeFunction(bytecode *Bytecode, name string, limits Limits) error {
+	vm := newVM(os.Stdin, os.Stdout, nil)
+	vm.interpreter.limits = limits
+	err := vm.runScript(bytecode)
+	if err != nil {
+		return err
+	}
+
+	fn, ok := vm.interpreter.env.names[name].(*closure)
+	if !ok || fn.ArgumentCount() != 0 {
+		return fmt.Errorf("No %s function.", name)
+	}
+
+	_, err = vm.call(fn, nil, Token{Line: -1})
+	return err
+}
+
+func newVM(stdin io.Reader, stdout io.Writer, natives map[string]Callable) *vm {
+	vm := &vm{
+		stack:   make([]any, 0, 256),
+		frames:  make([]callFrame, 0, 64),
+		modules: make(map[*module]namespace),
+	}
+	vm.interpreter = newInterpreter(stdin, stdout, natives)
+	vm.interpreter.vm = vm
+	return vm
+}
+
+// runScript executes all top-level statements of a compiled program in the global environment of the interpreter.
+func (vm *vm) runScript(bytecode *Bytecode) error {
+	_, err := vm.call(&closure{
+		proto:   bytecode.script,
+		globals: vm.interpreter.env,
+	}, nil, Token{Line: -1})
+	return err
+}
+
+// call calls callee and returns when it has returned.
+func (vm *vm) call(callee Callable, args []any, callSite Token) (any, error) {
+	if callee.ArgumentCount() != -1 && callee.ArgumentCount() != len(args) {
+		return nil, CallError{
+			Message: fmt.Sprintf("Wrong argument count. Expected %d, got %d.", callee.ArgumentCount(), len(args)),
+		}
+	}
+
+	baseFrame := len(vm.frames)
+	stackTop := len(vm.stack)
+	vm.stack = append(vm.stack, callee)
+	vm.stack = append(vm.stack, args...)
+	err := vm.callValue(len(args), callSite)
+	if err != nil {
+		vm.stack = vm.stack[:stackTop]
+		return nil, err
+	}
+	if len(vm.frames) == baseFrame {
+		return vm.pop(), nil
+	}
+	return vm.run(baseFrame)
+}
+
+func (vm *vm) pushFrame(c *closure, argCount int, callSite Token) error {
+	if !c.proto.script {
+		err := vm.interpreter.enterFunction(callSite)
+		if err != nil {
+			return err
+		}
+	}
+	vm.frames = append(vm.frames, callFrame{
+		closure:     c,
+		base:        len(vm.stack) - argCount - 1,
+		handlerBase: len(vm.handlers),
+		callSite:    callSite,
+	})
+	return nil
+}
+
+// run executes instructions until the frame at index baseFrame returns.
+func (vm *vm) run(baseFrame int) (any, error) {
+	frame := &vm.frames[len(vm.frames)-1]
+	chunk := &frame.closure.proto.chunk
+	code := chunk.code
+
+	for {
+		start := frame.ip
+		op := opcode(code[frame.ip])
+		frame.ip++
+
+		var err error
+		switch op {
+		case opConstant:
+			vm.push(chunk.constants[chunk.readShort(frame.ip)])
+			frame.ip += 2
+		case opNull:
+			vm.push(nil)
+		case opTrue:
+			vm.push(true)
+		case opFalse:
+			vm.push(false)
+		case opPop:
+			vm.stack = vm.stack[:len(vm.stack)-1]
+		case opDup:
+			vm.push(vm.peek(0))
+
+		case opDefineGlobal:
+			name := chunk.constants[chunk.readShort(frame.ip)].(string)
+			frame.ip += 2
+			err = frame.closure.globals.Define(name, vm.pop())
+			if err == ErrAlreadyDefined {
+				err = vm.newError(errorKindName, fmt.Sprintf("'%s' is already defined in this scope", name), chunk.tokens[start])
+			}
+		case opGetGlobal:
+			name := chunk.constants[chunk.readShort(frame.ip)].(string)
+			frame.ip += 2
+			vm.push(frame.closure.globals.names[name])
+		case opSetGlobal:
+			name := chunk.constants[chunk.readShort(frame.ip)].(string)
+			frame.ip += 2
+			frame.closure.globals.names[name] = vm.peek(0)
+		case opGetLocal:
+			vm.push(vm.stack[frame.base+chunk.readShort(frame.ip)])
+			frame.ip += 2
+		case opSetLocal:
+			vm.stack[frame.base+chunk.readShort(frame.ip)] = vm.peek(0)
+			frame.ip += 2
+		case opGetUpvalue:
+			u := frame.closure.upvalues[chunk.readShort(frame.ip)]
+			frame.ip += 2
+			if u.open {
+				vm.push(vm.stack[u.index])
+			} else {
+				vm.push(u.closed)
+			}
+		case opSetUpvalue:
+			u := frame.closure.upvalues[chunk.readShort(frame.ip)]
+			frame.ip += 2
+			if u.open {
+				vm.stack[u.index] = vm.peek(0)
+			} else {
+				u.closed = vm.peek(0)
+			}
+		case opCloseUpvalue:
+			vm.closeUpvalues(len(vm.stack) - 1)
+			vm.stack = vm.stack[:len(vm.stack)-1]
+
+		case opGetSubscript:
+			subscript := vm.pop()
+			object := vm.pop()
+			var value any
+			value, err = vm.interpreter.getSubscript(object, subscript, chunk.tokens[start])
+			vm.push(value)
+		case opSetSubscript:
+			subscript := vm.pop()
+			object := vm.pop()
+			err = vm.interpreter.setSubscript(object, subscript, vm.peek(0), chunk.tokens[start])
+		case opGetProperty:
+			frame.ip += 2
+			var value any
+			value, err = vm.interpreter.getProperty(vm.pop(), chunk.tokens[start], chunk.tokens[start])
+			vm.push(value)
+		case opSetProperty:
+			frame.ip += 2
+			object := vm.pop()
+			err = vm.interpreter.setProperty(object, chunk.tokens[start], vm.peek(0), chunk.tokens[start])
+		case opInitField:
+			name := chunk.constants[chunk.readShort(frame.ip)].(string)
+			frame.ip += 2
+			vm.stack[frame.base].(*instance).fields[name] = vm.pop()
+
+		case opList:
+			count := chunk.readShort(frame.ip)
+			frame.ip += 2
+			values := make(list, count)
+			copy(values, vm.stack[len(vm.stack)-count:])
+			vm.stack = vm.stack[:len(vm.stack)-count]
+			for _, v := range values {
+				if err = vm.interpreter.errorIfMultiValue(v, chunk.tokens[start]); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				err = vm.interpreter.allocate(count*valueSize, chunk.tokens[start])
+			}
+			vm.push(values)
+		case opTemplate:
+			count := chunk.readShort(frame.ip)
+			frame.ip += 2
+			var text strings.Builder
+			for _, v := range vm.stack[len(vm.stack)-count:] {
+				if err = vm.interpreter.errorIfMultiValue(v, chunk.tokens[start]); err != nil {
+					break
+				}
+				fmt.Fprint(&text, v)
+			}
+			vm.stack = vm.stack[:len(vm.stack)-count]
+			if err == nil {
+				err = vm.interpreter.allocate(text.Len(), chunk.tokens[start])
+			}
+			vm.push(text.String())
+		case opMap:
+			count := chunk.readShort(frame.ip)
+			frame.ip += 2
+			values := make(hashMap, count)
+			entries := vm.stack[len(vm.stack)-2*count:]
+			for i := 0; i < len(entries) && err == nil; i += 2 {
+				key, value := entries[i], entries[i+1]
+				if err = vm.interpreter.errorIfMultiValue(key, chunk.tokens[start]); err != nil {
+					break
+				}
+				key = unwrapFault(key)
+				if message := mapKeyError(key); message != "" {
+					err = vm.newError(errorKindType, message, chunk.tokens[start])
+					break
+				}
+				if err = vm.interpreter.errorIfMultiValue(value, chunk.tokens[start]); err != nil {
+					break
+				}
+				values[key] = value
+			}
+			if err == nil {
+				err = vm.interpreter.allocate(2*len(values)*valueSize, chunk.tokens[start])
+			}
+			vm.stack = vm.stack[:len(vm.stack)-2*count]
+			vm.push(values)
+		case opUnpack:
+			count := chunk.readShort(frame.ip)
+			frame.ip += 2
+			value := vm.pop()
+			values, ok := value.(multiValueReturn)
+			if !ok {
+				values = multiValueReturn{value}
+			}
+			if len(values) != count {
+				err = vm.newError(errorKindType, fmt.Sprintf("Cannot assign %d values to %d variables.", len(values), count), chunk.tokens[start])
+				break
+			}
+			vm.stack = append(vm.stack, values...)
+
+		case opAdd, opSubtract, opMultiply, opDivide, opModulo, opLess, opLessEqual, opGreater, opGreaterEqual, opPower, opEqual, opNotEqual:
+			right := vm.pop()
+			left := vm.peek(0)
+			if l, ok := left.(float64); ok {
+				if r, ok := right.(float64); ok && op != opPower && op != opEqual && op != opNotEqual {
+					vm.stack[len(vm.stack)-1] = arithmetic(op, l, r)
+					break
+				}
+			}
+			vm.stack[len(vm.stack)-1], err = vm.interpreter.binary(chunk.tokens[start], left, right)
+
+		case opNegate:
+			if number, ok := vm.peek(0).(float64); ok {
+				vm.stack[len(vm.stack)-1] = -number
+				break
+			}
+			vm.stack[len(vm.stack)-1], err = vm.interpreter.unary(chunk.tokens[start], vm.peek(0))
+		case opNot:
+			err = vm.interpreter.errorIfMultiValue(vm.peek(0), chunk.tokens[start])
+			vm.stack[len(vm.stack)-1] = !isTruthy(vm.peek(0))
+		case opToBoolean:
+			err = vm.interpreter.errorIfMultiValue(vm.peek(0), chunk.tokens[start])
+			vm.stack[len(vm.stack)-1] = isTruthy(vm.peek(0))
+		case opXor:
+			right := vm.pop()
+			left := vm.peek(0)
+			if err = vm.interpreter.errorIfMultiValue(left, chunk.tokens[start]); err != nil {
+				break
+			}
+			if err = vm.interpreter.errorIfMultiValue(right, chunk.tokens[start]); err != nil {
+				break
+			}
+			vm.stack[len(vm.stack)-1] = isTruthy(left) != isTruthy(right)
+
+		case opJump:
+			frame.ip += 2 + chunk.readShort(frame.ip)
+		case opJumpIfFalse:
+			condition := vm.pop()
+			if condition, ok := condition.(bool); ok {
+				if condition {
+					frame.ip += 2
+				} else {
+					frame.ip += 2 + chunk.readShort(frame.ip)
+				}
+				break
+			}
+			if err = vm.interpreter.errorIfMultiValue(condition, chunk.tokens[start]); err != nil {
+				break
+			}
+			if isTruthy(condition) {
+				frame.ip += 2
+			} else {
+				frame.ip += 2 + chunk.readShort(frame.ip)
+			}
+		case opLoop:
+			frame.ip = frame.ip + 2 - chunk.readShort(frame.ip)
+		case opStep:
+			hasLocation := chunk.readShort(frame.ip) == 1
+			frame.ip += 2
+			if vm.interpreter.limits.MaxSteps == 0 {
+				// only counted if the limit is enabled
+				break
+			}
+			if hasLocation {
+				err = vm.interpreter.step(chunk.tokens[start])
+			} else {
+				err = vm.interpreter.step()
+			}
+
+		case opIterator:
+			if err = vm.interpreter.errorIfMultiValue(vm.peek(0), chunk.tokens[start]); err != nil {
+				break
+			}
+			vm.stack[len(vm.stack)-1], err = vm.interpreter.newIterator(vm.peek(0), chunk.tokens[start])
+		case opNext:
+			withIndex := chunk.readShort(frame.ip) == 1
+			offset := chunk.readShort(frame.ip + 2)
+			frame.ip += 4
+			index, element, ok := vm.peek(0).(*iterator).next()
+			if !ok {
+				frame.ip += offset
+				break
+			}
+			if withIndex {
+				vm.push(float64(index))
+			}
+			vm.push(element)
+		case opMatch:
+			patterns := chunk.constants[chunk.readShort(frame.ip)].(*casePatterns)
+			frame.ip += 2
+			value := vm.pop()
+			if err = vm.interpreter.errorIfMultiValue(value, chunk.tokens[start]); err != nil {
+				break
+			}
+			bindings, ok := matchPatterns(patterns.patterns, value)
+			if !ok {
+				bindings = make([]any, patterns.bindings)
+			}
+			vm.stack = append(vm.stack, bindings...)
+			vm.push(ok)
+		case opCall:
+			argCount := chunk.readShort(frame.ip)
+			frame.ip += 2
+			err = vm.callValue(argCount, chunk.tokens[start])
+			frame = &vm.frames[len(vm.frames)-1]
+			chunk = &frame.closure.proto.chunk
+			code = chunk.code
+		case opClosure:
+			proto := chunk.constants[chunk.readShort(frame.ip)].(*prototype)
+			frame.ip += 2
+			c := &closure{
+				proto:    proto,
+				upvalues: make([]*upvalue, proto.upvalueCount),
+				globals:  frame.closure.globals,
+			}
+			for i := range c.upvalues {
+				isLocal := chunk.readShort(frame.ip) == 1
+				index := chunk.readShort(frame.ip + 2)
+				frame.ip += 4
+				if isLocal {
+					c.upvalues[i] = vm.captureUpvalue(frame.base + index)
+				} else {
+					c.upvalues[i] = frame.closure.upvalues[index]
+				}
+			}
+			vm.push(c)
+		case opReturn:
+			count := chunk.readShort(frame.ip)
+			frame.ip += 2
+			var result any
+			values := vm.stack[len(vm.stack)-count:]
+			for _, v := range values {
+				if err = vm.interpreter.errorIfMultiValue(v, chunk.tokens[start]); err != nil {
+					break
+				}
+			}
+			if err != nil {
+				break
+			}
+			if frame.constructor {
+				result = vm.stack[frame.base]
+			} else if count == 1 {
+				result = values[0]
+			} else if count > 1 {
+				result = make(multiValueReturn, count)
+				copy(result.(multiValueReturn), values)
+			}
+
+			if len(frame.deferred) > 0 {
+				// the deferred calls are executed outside of the try statements of the function
+				vm.handlers = vm.handlers[:frame.handlerBase]
+				err = vm.runDeferred()
+				frame = &vm.frames[len(vm.frames)-1]
+				if err != nil {
+					break
+				}
+			}
+
+			vm.popFrame()
+			if len(vm.frames) == baseFrame {
+				return result, nil
+			}
+			vm.push(result)
+			frame = &vm.frames[len(vm.frames)-1]
+			chunk = &frame.closure.proto.chunk
+			code = chunk.code
+
+		case opThrow:
+			err = vm.interpreter.NewException(vm.pop(), chunk.tokens[start])
+		case opTry:
+			offset := chunk.readShort(frame.ip)
+			frame.ip += 2
+			vm.handlers = append(vm.handlers, exceptionHandler{
+				frame:    len(vm.frames) - 1,
+				stackTop: len(vm.stack),
+				catchIP:  frame.ip + offset,
+			})
+		case opEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		case opIsKind:
+			kind := chunk.constants[chunk.readShort(frame.ip)].(string)
+			frame.ip += 2
+			vm.push(vm.peek(0).(*fault).kind == kind)
+		case opRethrow:
+			err = vm.pop().(*fault).rethrow()
+		case opDefer:
+			argCount := chunk.readShort(frame.ip)
+			frame.ip += 2
+			var callable Callable
+			callable, err = vm.callee(argCount, chunk.tokens[start])
+			if err != nil {
+				break
+			}
+			frame.deferred = append(frame.deferred, deferredCall{
+				callable:  callable,
+				args:      append([]any{}, vm.stack[len(vm.stack)-argCount:]...),
+				openParen: chunk.tokens[start],
+			})
+			vm.stack = vm.stack[:len(vm.stack)-argCount-1]
+		case opImport:
+			mod := chunk.constants[chunk.readShort(frame.ip)].(*compiledModule)
+			frame.ip += 2
+			var ns namespace
+			ns, err = vm.importModule(mod)
+			vm.push(ns)
+
+		case opClass:
+			proto := chunk.constants[chunk.readShort(frame.ip)].(*classPrototype)
+			frame.ip += 2
+			vm.push(&class{
+				name:    proto.name,
+				fields:  proto.fields,
+				methods: make(map[string]Callable),
+			})
+		case opMethod:
+			name := chunk.constants[chunk.readShort(frame.ip)].(string)
+			frame.ip += 2
+			method := vm.pop().(*closure)
+			c := vm.peek(0).(*class)
+			if name == "init" {
+				c.constructor = method
+			} else {
+				c.methods[name] = method
+			}
+
+		default:
+			return nil, fmt.Errorf("Unknown opcode %d.", op)
+		}
+
+		if err != nil {
+			err = vm.catch(err, baseFrame)
+			if err != nil {
+				return nil, vm.unwind(err, baseFrame)
+			}
+			frame = &vm.frames[len(vm.frames)-1]
+			chunk = &frame.closure.proto.chunk
+			code = chunk.code
+		}
+	}
+}
+
+// callValue calls the value below the argCount arguments on top of the stack.
+// Closures get a new call frame, all other callables are executed immediately.
+func (vm *vm) callValue(argCount int, token Token) error {
+	callable, err := vm.callee(argCount, token)
+	if err != nil {
+		return err
+	}
+	args := vm.stack[len(vm.stack)-argCount:]
+
+	switch c := callable.(type) {
+	case *closure:
+		return vm.pushFrame(c, argCount, token)
+	case *boundMethod:
+		vm.stack[len(vm.stack)-argCount-1] = c.receiver
+		return vm.pushFrame(c.method, argCount, token)
+	case *class:
+		vm.stack[len(vm.stack)-argCount-1] = newInstance(c)
+		err = vm.pushFrame(c.constructor.(*closure), argCount, token)
+		if err != nil {
+			return err
+		}
+		vm.frames[len(vm.frames)-1].constructor = true
+		return nil
+	}
+
+	args = append([]any{}, args...)
+	unwrapFaults(args)
+	vm.stack = vm.stack[:len(vm.stack)-argCount-1]
+	value, err := callable.Call(vm.interpreter, args)
+	vm.push(value)
+	if callError, ok := err.(CallError); ok {
+		return vm.newError(callError.kind(), callError.Message, token)
+	}
+	if exception, ok := err.(Exception); ok {
+		exception.StackTrace = vm.interpreter.appendFrame(exception.StackTrace, token)
+		return exception
+	}
+	if runtimeError, ok := err.(RuntimeError); ok {
+		runtimeError.stack = vm.interpreter.appendFrame(runtimeError.stack, token)
+		return runtimeError
+	}
+	return err
+}
+
+// callee returns the value below the argCount arguments on top of the stack after checking that it can be called with them.
+func (vm *vm) callee(argCount int, token Token) (Callable, error) {
+	callee := vm.stack[len(vm.stack)-argCount-1]
+	err := vm.interpreter.errorIfMultiValue(callee, token)
+	if err != nil {
+		return nil, err
+	}
+	callee = unwrapFault(callee)
+	vm.stack[len(vm.stack)-argCount-1] = callee
+	callable, ok := callee.(Callable)
+	if !ok {
+		return nil, vm.newError(errorKindType, "Can only call functions.", token)
+	}
+
+	if callable.ArgumentCount() != -1 && callable.ArgumentCount() != argCount {
+		return nil, vm.newError(errorKindType, fmt.Sprintf("Wrong argument count. Expected %d, got %d.", callable.ArgumentCount(), argCount), token)
+	}
+
+	for _, a := range vm.stack[len(vm.stack)-argCount:] {
+		err = vm.interpreter.errorIfMultiValue(a, token)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return callable, nil
+}
+
+// runDeferred executes the deferred calls of the current frame in reverse order and returns the last error.
+func (vm *vm) runDeferred() error {
+	var err error
+	for {
+		frame := &vm.frames[len(vm.frames)-1]
+		if len(frame.deferred) == 0 {
+			return err
+		}
+		d := frame.deferred[len(frame.deferred)-1]
+		frame.deferred = frame.deferred[:len(frame.deferred)-1]
+		_, deferredErr := vm.call(d.callable, d.args, d.openParen)
+		if deferredErr != nil {
+			err = deferredErr
+		}
+	}
+}
+
+// arithmetic applies the numeric operator op to left and right.
+func arithmetic(op opcode, left, right float64) any {
+	switch op {
+	case opAdd:
+		return left + right
+	case opSubtract:
+		return left - right
+	case opMultiply:
+		return left * right
+	case opDivide:
+		return left / right
+	case opModulo:
+		return math.Mod(left, right)
+	case opLess:
+		return left < right
+	case opLessEqual:
+		return left <= right
+	case opGreater:
+		return left > right
+	default:
+		return left >= right
+	}
+}
+
+// catch transfers control to the innermost exception handler inside of the frames started by the current run.
+// If err cannot be caught, it is returned or replaced by the error of a deferred call of a left frame.
+func (vm *vm) catch(err error, baseFrame int) error {
+	if _, ok := asException(err); !ok || len(vm.handlers) == 0 {
+		return err
+	}
+	handler := vm.handlers[len(vm.handlers)-1]
+	if handler.frame < baseFrame {
+		return err
+	}
+
+	for len(vm.frames)-1 > handler.frame {
+		err = vm.leaveFrame(err)
+	}
+	exception, ok := asException(err)
+	if !ok {
+		return err
+	}
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	vm.closeUpvalues(handler.stackTop)
+	vm.stack = vm.stack[:handler.stackTop]
+	vm.push(exception.caught())
+	vm.frames[len(vm.frames)-1].ip = handler.catchIP
+	return nil
+}
+
+// unwind discards all frames started by the current run.
+func (vm *vm) unwind(err error, baseFrame int) error {
+	for len(vm.frames) > baseFrame {
+		err = vm.leaveFrame(err)
+	}
+	return err
+}
+
+// leaveFrame executes the deferred calls of the current frame, whose errors replace err, and pops it.
+// The call site of the frame is added to the stack trace of exceptions and runtime errors.
+func (vm *vm) leaveFrame(err error) error {
+	if len(vm.frames[len(vm.frames)-1].deferred) > 0 {
+		vm.handlers = vm.handlers[:vm.frames[len(vm.frames)-1].handlerBase]
+		if deferredErr := vm.runDeferred(); deferredErr != nil {
+			err = deferredErr
+		}
+	}
+
+	callSite := vm.frames[len(vm.frames)-1].callSite
+	vm.popFrame()
+	switch e := err.(type) {
+	case Exception:
+		e.StackTrace = vm.interpreter.appendFrame(e.StackTrace, callSite)
+		return e
+	case RuntimeError:
+		e.stack = vm.interpreter.appendFrame(e.stack, callSite)
+		return e
+	}
+	return err
+}
+
+func (vm *vm) popFrame() {
+	frame := vm.frames[len(vm.frames)-1]
+	if !frame.closure.proto.script {
+		vm.interpreter.leaveFunction()
+	}
+	vm.closeUpvalues(frame.base)
+	vm.stack = vm.stack[:frame.base]
+	vm.handlers = vm.handlers[:frame.handlerBase]
+	vm.frames = vm.frames[:len(vm.frames)-1]
+}
+
+func (vm *vm) importModule(mod *compiledModule) (namespace, error) {
+	if ns, ok := vm.modules[mod.module]; ok {
+		return ns, nil
+	}
+
+	globals := vm.interpreter.newGlobalEnvironment()
+	_, err := vm.call(&closure{
+		proto:   mod.script,
+		globals: globals,
+	}, nil, Token{Line: -1})
+	if err != nil {
+		return namespace{}, err
+	}
+
+	ns := namespace{
+		path: mod.module.path,
+		env:  globals,
+	}
+	vm.modules[mod.module] = ns
+	return ns, nil
+}
+
+func (vm *vm) captureUpvalue(index int) *upvalue {
+	for _, u := range vm.openUpvalues {
+		if u.index == index {
+			return u
+		}
+	}
+	u := &upvalue{
+		index: index,
+		open:  true,
+	}
+	vm.openUpvalues = append(vm.openUpvalues, u)
+	return u
+}
+
+// closeUpvalues moves the values of all upvalues referring to stack slots at or above index into the upvalues.
+func (vm *vm) closeUpvalues(index int) {
+	open := vm.openUpvalues[:0]
+	for _, u := range vm.openUpvalues {
+		if u.index >= index {
+			u.closed = vm.stack[u.index]
+			u.open = false
+		} else {
+			open = append(open, u)
+		}
+	}
+	vm.openUpvalues = open
+}
+
+func (vm *vm) push(value any) {
+	vm.stack = append(vm.stack, value)
+}
+
+func (vm *vm) pop() any {
+	value := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return value
+}
+
+func (vm *vm) peek(distance int) any {
+	return vm.stack[len(vm.stack)-1-distance]
+}
+
+func (vm *vm) newError(kind, message string, token Token) error {
+	return vm.interpreter.newError(kind, message, token)
+}
@@ -0,0 +1,406 @@
+// Package lsp implements a language server for crab, which communicates over JSON-RPC as specified by the Language Server Protocol.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/Bananenpro/crab/interpreter"
+)
+
+type document struct {
+	uri   string
+	path  string
+	lines [][]rune
+	// the last analysis which got past the scanner, used while the code contains invalid tokens
+	analysis *interpreter.Analysis
+}
+
+type server struct {
+	reader    *bufio.Reader
+	writer    io.Writer
+	documents map[string]*document
+	shutdown  bool
+}
+
+// Serve reads requests from in and writes responses to out until the client sends the exit notification.
+// An error is returned if the connection breaks or the client exits without requesting a shutdown first.
+func Serve(in io.Reader, out io.Writer) error {
+	s := &server{
+		reader:    bufio.NewReader(in),
+		writer:    out,
+		documents: make(map[string]*document),
+	}
+
+	for {
+		content, err := s.read()
+		if err != nil {
+			return err
+		}
+
+		var req request
+		err = json.Unmarshal(content, &req)
+		if err != nil {
+			err = s.respondError(nil, errorInvalidRequest, fmt.Sprintf("Invalid message: %s", err))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("Received exit notification without shutdown request.")
+			}
+			return nil
+		}
+
+		result, err := s.handle(req)
+		if req.ID == nil {
+			// notifications don't have a response
+			continue
+		}
+		if rpcErr, ok := err.(responseError); ok {
+			err = s.respondError(req.ID, rpcErr.Code, rpcErr.Message)
+		} else {
+			err = s.write(response{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Result:  result,
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (e responseError) Error() string {
+	return e.Message
+}
+
+func (s *server) handle(req request) (any, error) {
+	switch req.Method {
+	case "initialize":
+		return initializeResult{
+			Capabilities: serverCapabilities{
+				TextDocumentSync:   1,
+				HoverProvider:      true,
+				DefinitionProvider: true,
+				CompletionProvider: completionOptions{},
+			},
+			ServerInfo: serverInfo{
+				Name: "crab",
+			},
+		}, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := unmarshalParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return nil, s.update(params.TextDocument.URI, params.TextDocument.Text)
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := unmarshalParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		if len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+		return nil, s.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err := unmarshalParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		delete(s.documents, params.TextDocument.URI)
+		return nil, s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+			URI:         params.TextDocument.URI,
+			Diagnostics: make([]diagnostic, 0),
+		})
+	case "textDocument/definition":
+		doc, ref, err := s.referenceAt(req.Params)
+		if err != nil || ref == nil || ref.Symbol.Name.Line < 0 || ref.Symbol.Name.File == nil {
+			return nil, err
+		}
+		return location{
+			URI:   pathToURI(ref.Symbol.Name.File.Path),
+			Range: doc.tokenRange(ref.Symbol.Name),
+		}, nil
+	case "textDocument/hover":
+		doc, ref, err := s.referenceAt(req.Params)
+		if err != nil || ref == nil {
+			return nil, err
+		}
+		return hover{
+			Contents: markupContent{
+				Kind:  "markdown",
+				Value: fmt.Sprintf("```crab\n%s\n```\n%s", ref.Symbol.Detail, ref.Symbol.Kind),
+			},
+			Range: doc.tokenRange(ref.Name),
+		}, nil
+	case "textDocument/completion":
+		var params textDocumentPositionParams
+		if err := unmarshalParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		doc, ok := s.documents[params.TextDocument.URI]
+		items := make([]completionItem, 0)
+		if !ok || doc.analysis == nil {
+			return items, nil
+		}
+		line, column := doc.position(params.Position)
+		for _, symbol := range doc.analysis.SymbolsInScope(line, column) {
+			items = append(items, completionItem{
+				Label:  symbol.Name.Lexeme,
+				Kind:   completionKind(symbol.Kind),
+				Detail: symbol.Detail,
+			})
+		}
+		return items, nil
+	}
+
+	if strings.HasPrefix(req.Method, "$/") || req.ID == nil {
+		// optional notifications can be ignored
+		return nil, nil
+	}
+	return nil, responseError{
+		Code:    errorMethodNotFound,
+		Message: fmt.Sprintf("Unsupported method '%s'.", req.Method),
+	}
+}
+
+// update analyses the new text of a document and publishes the resulting diagnostics.
+func (s *server) update(uri, text string) error {
+	doc, ok := s.documents[uri]
+	if !ok {
+		doc = &document{
+			uri:  uri,
+			path: uriToPath(uri),
+		}
+		s.documents[uri] = doc
+	}
+
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	doc.lines = make([][]rune, len(lines))
+	for i, l := range lines {
+		doc.lines[i] = []rune(l)
+	}
+
+	analysis := interpreter.Analyze(strings.NewReader(text), doc.path)
+	if len(analysis.Symbols) > 0 {
+		doc.analysis = analysis
+	}
+
+	diagnostics := make([]diagnostic, 0, len(analysis.Diagnostics))
+	for _, d := range analysis.Diagnostics {
+		if d.Line >= 0 && d.Path != doc.path {
+			// errors in imported modules are reported at the beginning of the importing file
+			if d.Severity != interpreter.SeverityError {
+				continue
+			}
+			d.Message = fmt.Sprintf("%s:%d:%d: %s", d.Path, d.Line+1, d.Column+1, d.Message)
+			d.Line, d.Column, d.EndColumn = 0, 0, 0
+		}
+		severity := diagnosticSeverityError
+		if d.Severity == interpreter.SeverityWarning {
+			severity = diagnosticSeverityWarning
+		}
+		line := d.Line
+		if line < 0 {
+			line = 0
+		}
+		diagnostics = append(diagnostics, diagnostic{
+			Range: textRange{
+				Start: doc.lspPosition(line, d.Column),
+				End:   doc.lspPosition(line, d.EndColumn),
+			},
+			Severity: severity,
+			Code:     d.Code,
+			Source:   "crab",
+			Message:  d.Message,
+		})
+	}
+
+	return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: diagnostics,
+	})
+}
+
+// referenceAt returns the reference at the position specified by rawParams or nil if there is none.
+func (s *server) referenceAt(rawParams json.RawMessage) (*document, *interpreter.Reference, error) {
+	var params textDocumentPositionParams
+	if err := unmarshalParams(rawParams, &params); err != nil {
+		return nil, nil, err
+	}
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok || doc.analysis == nil {
+		return nil, nil, nil
+	}
+	line, column := doc.position(params.Position)
+	ref, ok := doc.analysis.ReferenceAt(line, column)
+	if !ok {
+		return doc, nil, nil
+	}
+	return doc, &ref, nil
+}
+
+// read returns the content of the next message.
+func (s *server) read() ([]byte, error) {
+	length := -1
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		name, value, found := strings.Cut(line, ":")
+		if found && strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("Invalid Content-Length header: %s", err)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, errors.New("Missing Content-Length header.")
+	}
+
+	content := make([]byte, length)
+	_, err := io.ReadFull(s.reader, content)
+	return content, err
+}
+
+func (s *server) write(message any) error {
+	content, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.writer, "Content-Length: %d\r\n\r\n%s", len(content), content)
+	return err
+}
+
+func (s *server) notify(method string, params any) error {
+	return s.write(notification{
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  params,
+	})
+}
+
+func (s *server) respondError(id *json.RawMessage, code int, message string) error {
+	return s.write(errorResponse{
+		JSONRPC: "2.0",
+		ID:      id,
+		Error: responseError{
+			Code:    code,
+			Message: message,
+		},
+	})
+}
+
+func unmarshalParams(params json.RawMessage, v any) error {
+	err := json.Unmarshal(params, v)
+	if err != nil {
+		return responseError{
+			Code:    errorInvalidParams,
+			Message: fmt.Sprintf("Invalid params: %s", err),
+		}
+	}
+	return nil
+}
+
+// position converts an LSP position, whose character offset is counted in UTF-16 code units, to a line and rune column.
+func (d *document) position(pos position) (int, int) {
+	if pos.Line < 0 || pos.Line >= len(d.lines) {
+		return pos.Line, pos.Character
+	}
+	units := 0
+	for column, r := range d.lines[pos.Line] {
+		if units >= pos.Character {
+			return pos.Line, column
+		}
+		units += len(utf16.Encode([]rune{r}))
+	}
+	return pos.Line, len(d.lines[pos.Line])
+}
+
+// lspPosition converts a line and rune column to an LSP position.
+func (d *document) lspPosition(line, column int) position {
+	if line < 0 || line >= len(d.lines) {
+		return position{Line: line, Character: column}
+	}
+	text := d.lines[line]
+	if column > len(text) {
+		column = len(text)
+	}
+	return position{
+		Line:      line,
+		Character: len(utf16.Encode(text[:column])),
+	}
+}
+
+func (d *document) tokenRange(token interpreter.Token) textRange {
+	end := token.Column + len([]rune(token.Lexeme))
+	if token.File == nil || token.File.Path != d.path {
+		// the text of other files is unknown, so columns are used as they are
+		return textRange{
+			Start: position{Line: token.Line, Character: token.Column},
+			End:   position{Line: token.Line, Character: end},
+		}
+	}
+	return textRange{
+		Start: d.lspPosition(token.Line, token.Column),
+		End:   d.lspPosition(token.Line, end),
+	}
+}
+
+func completionKind(symbolKind string) int {
+	switch symbolKind {
+	case "function":
+		return completionKindFunction
+	case "method":
+		return completionKindMethod
+	case "field":
+		return completionKindField
+	case "class":
+		return completionKindClass
+	case "module":
+		return completionKindModule
+	}
+	return completionKindVariable
+}
+
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+func pathToURI(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	u := url.URL{
+		Scheme: "file",
+		Path:   filepath.ToSlash(path),
+	}
+	return u.String()
+}
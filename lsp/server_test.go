@@ -0,0 +1,253 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const testURI = "file:///tmp/test.cb"
+
+const testSource = `func add(a, b) 1 {
+	return a + b;
+}
+
+func main() {
+	var sum = add(1, 2);
+	println(sum);
+	println(missing);
+	var unused = 3;
+}
+`
+
+// client sends framed messages to a server started with Serve and reads its replies.
+type client struct {
+	t      *testing.T
+	writer io.Writer
+	reader *bufio.Reader
+	nextID int
+}
+
+type message struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *responseError  `json:"error"`
+}
+
+func (c *client) send(id *int, method string, params any) {
+	c.t.Helper()
+	msg := map[string]any{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+	}
+	if id != nil {
+		msg["id"] = *id
+	}
+	content, err := json.Marshal(msg)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if _, err := fmt.Fprintf(c.writer, "Content-Length: %d\r\n\r\n%s", len(content), content); err != nil {
+		c.t.Fatalf("send %s: %s", method, err)
+	}
+}
+
+func (c *client) receive() message {
+	c.t.Helper()
+	length := -1
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			c.t.Fatalf("receive: %s", err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if value := strings.TrimPrefix(line, "Content-Length: "); value != line {
+			length, err = strconv.Atoi(value)
+			if err != nil {
+				c.t.Fatalf("receive: invalid Content-Length: %s", err)
+			}
+		}
+	}
+	if length < 0 {
+		c.t.Fatal("receive: missing Content-Length header")
+	}
+	content := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, content); err != nil {
+		c.t.Fatalf("receive: %s", err)
+	}
+	var msg message
+	if err := json.Unmarshal(content, &msg); err != nil {
+		c.t.Fatalf("receive: %s", err)
+	}
+	return msg
+}
+
+// request sends a request and decodes the result of its response into result.
+func (c *client) request(method string, params any, result any) {
+	c.t.Helper()
+	c.nextID++
+	id := c.nextID
+	c.send(&id, method, params)
+	msg := c.receive()
+	if msg.ID == nil || *msg.ID != id {
+		c.t.Fatalf("%s: expected response with id %d, got %+v", method, id, msg)
+	}
+	if msg.Error != nil {
+		c.t.Fatalf("%s: %s", method, msg.Error.Message)
+	}
+	if result != nil {
+		if err := json.Unmarshal(msg.Result, result); err != nil {
+			c.t.Fatalf("%s: %s", method, err)
+		}
+	}
+}
+
+// diagnostics sends a notification and returns the diagnostics published in reaction to it.
+func (c *client) diagnostics(method string, params any) []diagnostic {
+	c.t.Helper()
+	c.send(nil, method, params)
+	msg := c.receive()
+	if msg.Method != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("%s: expected publishDiagnostics, got %+v", method, msg)
+	}
+	var published publishDiagnosticsParams
+	if err := json.Unmarshal(msg.Params, &published); err != nil {
+		c.t.Fatal(err)
+	}
+	if published.URI != testURI {
+		c.t.Errorf("%s: diagnostics published for %q, want %q", method, published.URI, testURI)
+	}
+	return published.Diagnostics
+}
+
+func startServer(t *testing.T) (*client, chan error) {
+	clientIn, serverOut := io.Pipe()
+	serverIn, clientOut := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(serverIn, serverOut)
+		serverOut.Close()
+	}()
+	t.Cleanup(func() {
+		clientOut.Close()
+		clientIn.Close()
+	})
+	return &client{
+		t:      t,
+		writer: clientOut,
+		reader: bufio.NewReader(clientIn),
+	}, done
+}
+
+func at(line, character int) textDocumentPositionParams {
+	return textDocumentPositionParams{
+		TextDocument: textDocumentIdentifier{URI: testURI},
+		Position:     position{Line: line, Character: character},
+	}
+}
+
+func TestServe(t *testing.T) {
+	c, done := startServer(t)
+
+	var initialized initializeResult
+	c.request("initialize", map[string]any{}, &initialized)
+	if initialized.ServerInfo.Name != "crab" || !initialized.Capabilities.HoverProvider || !initialized.Capabilities.DefinitionProvider {
+		t.Errorf("initialize: unexpected result %+v", initialized)
+	}
+	c.send(nil, "initialized", map[string]any{})
+
+	diagnostics := c.diagnostics("textDocument/didOpen", didOpenParams{
+		TextDocument: textDocumentItem{URI: testURI, Text: testSource},
+	})
+	if len(diagnostics) != 2 {
+		t.Fatalf("didOpen: expected 2 diagnostics, got %+v", diagnostics)
+	}
+	wantRange := textRange{Start: position{Line: 7, Character: 9}, End: position{Line: 7, Character: 16}}
+	if d := diagnostics[0]; d.Severity != diagnosticSeverityError || d.Range != wantRange || d.Message != "Undefined name." {
+		t.Errorf("didOpen: unexpected diagnostic %+v", d)
+	}
+	unusedRange := textRange{Start: position{Line: 8, Character: 5}, End: position{Line: 8, Character: 11}}
+	if d := diagnostics[1]; d.Severity != diagnosticSeverityWarning || d.Code != "unused-variable" || d.Range != unusedRange {
+		t.Errorf("didOpen: expected an unused variable warning, got %+v", d)
+	}
+
+	var h hover
+	c.request("textDocument/hover", at(5, 12), &h)
+	if !strings.Contains(h.Contents.Value, "add") || !strings.Contains(h.Contents.Value, "function") {
+		t.Errorf("hover: unexpected contents %q", h.Contents.Value)
+	}
+	if want := (textRange{Start: position{Line: 5, Character: 11}, End: position{Line: 5, Character: 14}}); h.Range != want {
+		t.Errorf("hover: got range %+v, want %+v", h.Range, want)
+	}
+
+	var loc location
+	c.request("textDocument/definition", at(6, 10), &loc)
+	if want := (location{URI: testURI, Range: textRange{Start: position{Line: 5, Character: 5}, End: position{Line: 5, Character: 8}}}); loc != want {
+		t.Errorf("definition: got %+v, want %+v", loc, want)
+	}
+
+	var items []completionItem
+	c.request("textDocument/completion", at(6, 0), &items)
+	found := make(map[string]int)
+	for _, item := range items {
+		found[item.Label] = item.Kind
+	}
+	if found["add"] != completionKindFunction || found["sum"] != completionKindVariable || found["println"] != completionKindFunction {
+		t.Errorf("completion: unexpected items %+v", items)
+	}
+
+	diagnostics = c.diagnostics("textDocument/didChange", map[string]any{
+		"textDocument":   textDocumentIdentifier{URI: testURI},
+		"contentChanges": []map[string]string{{"text": strings.Replace(testSource, "missing", "sum", 1)}},
+	})
+	if len(diagnostics) != 1 || diagnostics[0].Severity != diagnosticSeverityWarning || diagnostics[0].Range != unusedRange {
+		t.Errorf("didChange: expected only the unused variable warning, got %+v", diagnostics)
+	}
+
+	diagnostics = c.diagnostics("textDocument/didClose", didCloseParams{
+		TextDocument: textDocumentIdentifier{URI: testURI},
+	})
+	if len(diagnostics) != 0 {
+		t.Errorf("didClose: expected the diagnostics to be cleared, got %+v", diagnostics)
+	}
+
+	c.request("shutdown", nil, nil)
+	c.send(nil, "exit", nil)
+	if err := <-done; err != nil {
+		t.Errorf("exit: %s", err)
+	}
+}
+
+func TestServeExitWithoutShutdown(t *testing.T) {
+	c, done := startServer(t)
+	c.request("initialize", map[string]any{}, nil)
+	c.send(nil, "exit", nil)
+	if err := <-done; err == nil {
+		t.Error("expected an error when exiting without shutdown")
+	}
+}
+
+func TestServeUnknownMethod(t *testing.T) {
+	c, done := startServer(t)
+	id := 1
+	c.send(&id, "workspace/unknown", map[string]any{})
+	msg := c.receive()
+	if msg.Error == nil || msg.Error.Code != errorMethodNotFound {
+		t.Errorf("expected method not found error, got %+v", msg)
+	}
+	c.request("shutdown", nil, nil)
+	c.send(nil, "exit", nil)
+	if err := <-done; err != nil {
+		t.Errorf("exit: %s", err)
+	}
+}
@@ -9,68 +9,174 @@ import (
 	"time"
 
 	"github.com/Bananenpro/crab/interpreter"
+	"github.com/Bananenpro/crab/lsp"
 )
 
 func main() {
 	rand.Seed(time.Now().UnixNano())
+	interpreter.SetColors(useColors(os.Stderr))
 
-	verbose := flag.Bool("verbose", false, "Print verbose output.")
+	if len(os.Args) > 1 && os.Args[1] == "test" {
+		os.Exit(runTests(os.Args[2:]))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "fmt" {
+		os.Exit(runFormat(os.Args[2:]))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "cover" {
+		os.Exit(runCover(os.Args[2:]))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "debug" {
+		os.Exit(runDebug(os.Args[2:]))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "lsp" {
+		err := lsp.Serve(os.Stdin, os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var options runOptions
+	flag.BoolVar(&options.verbose, "verbose", false, "Print verbose output.")
+	flag.StringVar(&options.engine, "engine", "tree", "The execution engine: 'tree' (tree-walking interpreter) or 'vm' (bytecode virtual machine).")
+	limits := limitFlags(flag.CommandLine)
+	flag.StringVar(&options.profilePath, "profile", "", "Write a profile of the program to this file, its call stacks to <name>.folded and a pprof profile to <name>.pb.gz (only with -engine=tree).")
+	flag.StringVar(&options.coveragePath, "coverage", "", "Write the statement and branch coverage of the program to this file, which can be viewed with 'cover' (only with -engine=tree).")
+	noOptimizations := flag.Bool("O0", false, "Disable optimizations like constant folding and the removal of unreachable code.")
+	diagnosticsFormat := flag.String("diagnostics", diagnosticsText, "The format of errors and warnings: 'text', 'json' (one object per line) or 'sarif'.")
 
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [options] <file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] [file]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s test [options] [files or directories]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s fmt [options] [files or directories]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s cover [options] coverage-file\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s debug [options] file\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s lsp\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nStarts an interactive session if no file is provided.\n")
 		fmt.Fprintf(os.Stderr, "\nOptions:\n")
 		flag.PrintDefaults()
 	}
 
 	flag.Parse()
 
-	if flag.NArg() != 1 {
+	if flag.NArg() == 0 {
+		runREPL()
+		return
+	}
+
+	if flag.NArg() != 1 || (options.engine != "tree" && options.engine != "vm") || ((options.profilePath != "" || options.coveragePath != "") && options.engine != "tree") {
 		flag.Usage()
 		os.Exit(1)
 	}
-
-	sourceFile, err := os.Open(flag.Arg(0))
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to open source file: %s\n", err)
+	if options.profilePath != "" && options.coveragePath != "" {
+		fmt.Fprintln(os.Stderr, "Cannot use -profile and -coverage at the same time.")
+		flag.Usage()
 		os.Exit(1)
 	}
 
-	tokens, lines, err := interpreter.Scan(sourceFile)
-	sourceFile.Close()
+	diagnostics, err := newDiagnosticsPrinter(*diagnosticsFormat, os.Stderr)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(1)
+	}
+	options.limits = *limits
+	// unreachable code has to be kept to be reported as not covered
+	options.optimize = !*noOptimizations && options.coveragePath == ""
+	err = run(flag.Arg(0), options, diagnostics)
+	diagnostics.flush()
+	if err != nil {
 		os.Exit(1)
 	}
+}
+
+// runOptions determine how a program is executed by run.
+type runOptions struct {
+	engine  string
+	verbose bool
+	limits  interpreter.Limits
+	// a profile or the coverage of the program is written to these files if they are not empty
+	profilePath  string
+	coveragePath string
+	// whether the program is optimized with interpreter.Optimize
+	optimize bool
+}
 
-	if *verbose {
+// run executes the program in path and reports all of its errors to diagnostics.
+// The returned error is only used to determine the exit code.
+func run(path string, options runOptions, diagnostics *diagnosticsPrinter) error {
+	tokens, program, loadDiagnostics := interpreter.LoadFile(path, false)
+	if options.verbose && tokens != nil {
 		fmt.Println("Tokens:", tokens)
 		fmt.Println(strings.Repeat("=", 50))
 	}
-
-	program, errs := interpreter.Parse(tokens, lines)
-	for _, err := range errs {
-		fmt.Fprintln(os.Stderr, err)
-	}
-	if len(errs) > 0 {
-		os.Exit(1)
+	diagnostics.print(loadDiagnostics...)
+	if err := interpreter.Errors(loadDiagnostics); err != nil {
+		return err
 	}
 
-	err = interpreter.Check(program, lines)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+	if options.optimize {
+		program = interpreter.Optimize(program)
 	}
 
-	if *verbose {
+	if options.verbose {
 		for _, stmt := range program {
 			fmt.Println(interpreter.PrintAST(stmt))
 		}
 		fmt.Println(strings.Repeat("=", 50))
 	}
 
-	err = interpreter.Interpret(program, lines)
+	var err error
+	if options.engine == "vm" {
+		var bytecode *interpreter.Bytecode
+		bytecode, err = interpreter.Compile(program)
+		if err != nil {
+			diagnostics.printError(err)
+			return err
+		}
+		if options.verbose {
+			fmt.Println(bytecode)
+			fmt.Println(strings.Repeat("=", 50))
+		}
+		err = interpreter.RunBytecode(bytecode, options.limits)
+	} else if options.profilePath != "" {
+		var profile *interpreter.Profile
+		profile, err = interpreter.InterpretWithProfile(program, options.limits)
+		if profileErr := writeProfile(profile, options.profilePath); profileErr != nil {
+			diagnostics.printError(profileErr)
+			if err == nil {
+				err = profileErr
+			}
+		}
+	} else if options.coveragePath != "" {
+		coverage := interpreter.NewCoverage()
+		coverage.Add(program)
+		err = interpreter.InterpretFunctionWithCoverage(program, "main", options.limits, coverage)
+		if coverageErr := writeCoverage(coverage, options.coveragePath); coverageErr != nil {
+			diagnostics.printError(coverageErr)
+			if err == nil {
+				err = coverageErr
+			}
+		}
+	} else {
+		err = interpreter.Interpret(program, options.limits)
+	}
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		diagnostics.printError(err)
 	}
+	return err
+}
+
+// limitFlags defines the flags for the resource limits of a program.
+func limitFlags(flags *flag.FlagSet) *interpreter.Limits {
+	limits := &interpreter.Limits{}
+	flags.IntVar(&limits.MaxSteps, "max-steps", 0, "The maximum number of executed statements (0 = unlimited).")
+	flags.IntVar(&limits.MaxDepth, "max-depth", 10000, "The maximum number of nested function calls (0 = unlimited).")
+	flags.IntVar(&limits.MaxMemory, "max-memory", 0, "The approximate maximum number of bytes allocated for strings, lists and maps (0 = unlimited).")
+	return limits
 }
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Bananenpro/crab/interpreter"
+)
+
+// writeProfile writes the text report of profile to path, its call stacks in the folded format to
+// <name>.folded and a pprof profile to <name>.pb.gz, where <name> is path without its extension.
+func writeProfile(profile *interpreter.Profile, path string) error {
+	name := strings.TrimSuffix(path, filepath.Ext(path))
+	files := []struct {
+		path  string
+		write func(w io.Writer) error
+	}{
+		{path, profile.WriteText},
+		{name + ".folded", profile.WriteFolded},
+		{name + ".pb.gz", profile.WritePprof},
+	}
+	for _, f := range files {
+		file, err := os.Create(f.path)
+		if err != nil {
+			return fmt.Errorf("Failed to write profile: %s", err)
+		}
+		err = f.write(file)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to write profile: %s", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Bananenpro/crab/interpreter"
+)
+
+func runREPL() {
+	// the session and the programs it executes share the input, so neither of them buffers input meant for the other
+	input := bufio.NewReader(os.Stdin)
+	session := interpreter.NewSession(input, os.Stdout, os.Stderr)
+
+	source := ""
+	fmt.Print("> ")
+	for {
+		line, err := input.ReadString('\n')
+		if line == "" && err != nil {
+			if err != io.EOF {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			break
+		}
+		source += strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r") + "\n"
+
+		tokens, err := interpreter.Scan(strings.NewReader(source), "<stdin>")
+		if err == nil && isIncomplete(tokens) {
+			fmt.Print("... ")
+			continue
+		}
+
+		if err == nil {
+			var results []string
+			results, err = session.Execute(tokens)
+			for _, result := range results {
+				fmt.Println(result)
+			}
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+
+		source = ""
+		fmt.Print("> ")
+	}
+	fmt.Println()
+}
+
+// isIncomplete reports whether tokens contain more opening than closing braces, brackets or parentheses.
+func isIncomplete(tokens []interpreter.Token) bool {
+	depth := 0
+	for _, t := range tokens {
+		switch t.Type {
+		case interpreter.OPEN_BRACE, interpreter.OPEN_BRACKET, interpreter.OPEN_PAREN:
+			depth++
+		case interpreter.CLOSE_BRACE, interpreter.CLOSE_BRACKET, interpreter.CLOSE_PAREN:
+			depth--
+		}
+	}
+	return depth > 0
+}
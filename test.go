@@ -0,0 +1,196 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Bananenpro/crab/interpreter"
+)
+
+// runTests executes the 'test' subcommand and returns the exit code.
+func runTests(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	engine := flags.String("engine", "tree", "The execution engine: 'tree' (tree-walking interpreter) or 'vm' (bytecode virtual machine).")
+	run := flags.String("run", "", "Only run tests whose name matches the regular expression.")
+	coveragePath := flags.String("coverage", "", "Write the statement and branch coverage of the modules imported by the test files to this file (only with -engine=tree).")
+	noOptimizations := flags.Bool("O0", false, "Disable optimizations like constant folding and the removal of unreachable code.")
+	limits := limitFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s test [options] [files or directories]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nRuns all functions starting with 'test' in files ending with '_test.cb'.\n")
+		fmt.Fprintf(os.Stderr, "Directories are searched recursively. Defaults to the current directory.\n")
+		fmt.Fprintf(os.Stderr, "\nOptions:\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if (*engine != "tree" && *engine != "vm") || (*coveragePath != "" && *engine != "tree") {
+		flags.Usage()
+		return 1
+	}
+
+	filter, err := regexp.Compile(*run)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -run pattern: %s\n", err)
+		return 1
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := findFiles(paths, "_test.cb")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(files) == 0 {
+		fmt.Println("No test files found.")
+		return 0
+	}
+
+	var coverage *interpreter.Coverage
+	if *coveragePath != "" {
+		coverage = interpreter.NewCoverage()
+	}
+
+	passed, failed, failedFiles := 0, 0, 0
+	for _, file := range files {
+		start := time.Now()
+		// unreachable code has to be kept to be reported as not covered
+		optimize := !*noOptimizations && coverage == nil
+		p, f, err := runTestFile(file, *engine, filter, *limits, coverage, optimize)
+		passed += p
+		failed += f
+		if err != nil {
+			failedFiles++
+			fmt.Printf("FAIL\t%s\n%s\n", file, indent(err.Error()))
+		} else if f > 0 {
+			failedFiles++
+			fmt.Printf("FAIL\t%s\t(%s)\n", file, formatDuration(time.Since(start)))
+		} else {
+			fmt.Printf("ok\t%s\t(%s)\n", file, formatDuration(time.Since(start)))
+		}
+	}
+
+	fmt.Printf("\n%d passed, %d failed\n", passed, failed)
+	if coverage != nil {
+		fmt.Printf("coverage: %s\n", summarizeCoverage(coverage.Files()...))
+		if err := writeCoverage(coverage, *coveragePath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	if failed > 0 || failedFiles > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runTestFile runs all tests of file matching filter and returns the number of passed and failed tests.
+// The limits apply to each test separately. An error is returned if the file could not be loaded.
+// If coverage is not nil, the coverage of the modules imported by the file is added to it.
+func runTestFile(file, engine string, filter *regexp.Regexp, limits interpreter.Limits, coverage *interpreter.Coverage, optimize bool) (passed, failed int, err error) {
+	program, err := loadTestFile(file)
+	if err != nil {
+		return 0, 0, err
+	}
+	if optimize {
+		program = interpreter.Optimize(program)
+	}
+	if coverage != nil {
+		coverage.AddModules(program)
+	}
+
+	var bytecode *interpreter.Bytecode
+	if engine == "vm" {
+		bytecode, err = interpreter.Compile(program)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	for _, stmt := range program {
+		funcDecl, ok := stmt.(*interpreter.StmtFuncDecl)
+		if !ok || !interpreter.IsTestFunction(funcDecl) || !filter.MatchString(funcDecl.Name.Lexeme) {
+			continue
+		}
+		name := funcDecl.Name.Lexeme
+
+		start := time.Now()
+		// every test gets a fresh interpreter
+		if bytecode != nil {
+			err = interpreter.RunBytecodeFunction(bytecode, name, limits)
+		} else if coverage != nil {
+			err = interpreter.InterpretFunctionWithCoverage(program, name, limits, coverage)
+		} else {
+			err = interpreter.InterpretFunction(program, name, limits)
+		}
+		duration := formatDuration(time.Since(start))
+
+		if err != nil {
+			failed++
+			fmt.Printf("--- FAIL: %s (%s)\n%s\n", name, duration, indent(err.Error()))
+		} else {
+			passed++
+			fmt.Printf("--- PASS: %s (%s)\n", name, duration)
+		}
+	}
+	return passed, failed, nil
+}
+
+func loadTestFile(file string) ([]interpreter.Stmt, error) {
+	_, program, diagnostics := interpreter.LoadFile(file, true)
+	for _, d := range diagnostics {
+		if d.Severity == interpreter.SeverityWarning {
+			fmt.Fprintln(os.Stderr, d)
+		}
+	}
+	if err := interpreter.Errors(diagnostics); err != nil {
+		return nil, err
+	}
+	return program, nil
+}
+
+// findFiles returns all files in paths. Directories are searched recursively for files ending with suffix.
+func findFiles(paths []string, suffix string) ([]string, error) {
+	files := make([]string, 0)
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(d.Name(), suffix) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func formatDuration(duration time.Duration) string {
+	return duration.Round(time.Microsecond).String()
+}
+
+func indent(text string) string {
+	return "    " + strings.ReplaceAll(text, "\n", "\n    ")
+}